@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"forum/internal/db"
+)
+
+const usage = `usage:
+  main                              start the server
+  main promote-admin <username>     make the first admin (username or email)`
+
+// runCommand runs a maintenance command given on the command line instead of
+// starting the server.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := db.PromoteFirstAdmin(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now an admin\n", args[1])
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
@@ -3,11 +3,35 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"forum/internal/account"
+	"forum/internal/api"
 	"forum/internal/auth"
 	"forum/internal/db"
+	"forum/internal/digest"
 	"forum/internal/handlers"
+	"forum/internal/ratelimit"
+)
+
+// Rate limits per route. They are counted per user behind the session middleware
+// and per client IP in front of it. The JSON API shares the buckets of the
+// matching pages.
+var (
+	postLimit    = ratelimit.PerMinute(5, 3)
+	commentLimit = ratelimit.PerMinute(20, 5)
+	likeLimit    = ratelimit.PerMinute(60, 20)
+	reportLimit  = ratelimit.PerMinute(10, 5)
+	messageLimit = ratelimit.PerMinute(20, 5)
+	globalLimit  = ratelimit.PerMinute(300, 100)
+)
+
+const (
+	// limiterIdle is how long the bucket of a client that stopped sending is kept.
+	limiterIdle = 10 * time.Minute
+	// limiterCleanup is how often buckets idle for limiterIdle are dropped.
+	limiterCleanup = 5 * time.Minute
 )
 
 func main() {
@@ -16,7 +40,32 @@ func main() {
 		log.Println("error:", err)
 	}
 
-	go db.ScheduleSessionCleanup(1*time.Hour, db.CleanupExpiredSessions)
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	go db.Schedule(1*time.Hour, db.CleanupExpiredSessions)
+	go db.Schedule(1*time.Hour, auth.CleanupLoginAttempts)
+
+	// Email digests are checked every minute, so immediate ones go out promptly
+	digest.LoadConfig()
+	go db.Schedule(1*time.Minute, func() error { return digest.SendDue(time.Now()) })
+
+	go db.Schedule(1*time.Hour, func() error { return account.DeleteDue(time.Now()) })
+
+	limiter := ratelimit.NewMemoryStore(limiterIdle)
+	go db.Schedule(limiterCleanup, limiter.Cleanup)
+
+	limitPosts := ratelimit.Middleware(limiter, "post", postLimit)
+	limitComments := ratelimit.Middleware(limiter, "comment", commentLimit)
+	limitLikes := ratelimit.Middleware(limiter, "like", likeLimit)
+	limitBookmarks := ratelimit.Middleware(limiter, "bookmark", likeLimit)
+	limitReports := ratelimit.Middleware(limiter, "report", reportLimit)
+	limitMessages := ratelimit.Middleware(limiter, "message", messageLimit)
 
 	mux := http.NewServeMux()
 
@@ -24,14 +73,81 @@ func main() {
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Set up routes
-	mux.HandleFunc("/", handlers.HomeHandler)
+	mux.Handle("/", auth.SessionMiddleware(http.HandlerFunc(handlers.HomeHandler)))
+	mux.Handle("/c/", auth.SessionMiddleware(http.HandlerFunc(handlers.CategoryHandler)))
+	mux.Handle("/u/", auth.SessionMiddleware(http.HandlerFunc(handlers.ProfileHandler)))
+	mux.Handle("/events", auth.SessionMiddleware(http.HandlerFunc(handlers.EventsHandler)))
+	mux.Handle("/chat/", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.ChatHandler))))
 	mux.Handle("/login", auth.SessionMiddleware(auth.RedirectIfAuthenticated(http.HandlerFunc(handlers.LoginHandler))))
 	mux.Handle("/register", auth.SessionMiddleware(auth.RedirectIfAuthenticated(http.HandlerFunc(handlers.RegisterHandler))))
-	mux.Handle("/post/create", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.CreatePostHandler))))
-	mux.Handle("/comment/create", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.CreateCommentHandler))))
-	mux.Handle("/like", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.LikeHandler))))
+	mux.Handle("/post/", auth.SessionMiddleware(http.HandlerFunc(handlers.PostHandler)))
+	mux.Handle("/posts/read", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.MarkPostsReadHandler))))
+	mux.Handle("/post/create", auth.SessionMiddleware(auth.RequireAuth(limitPosts(http.HandlerFunc(handlers.CreatePostHandler)))))
+	mux.Handle("/comment/create", auth.SessionMiddleware(auth.RequireAuth(limitComments(http.HandlerFunc(handlers.CreateCommentHandler)))))
+	mux.Handle("/like", auth.SessionMiddleware(auth.RequireAuth(limitLikes(http.HandlerFunc(handlers.LikeHandler)))))
+	mux.Handle("/bookmark", auth.SessionMiddleware(auth.RequireAuth(limitBookmarks(http.HandlerFunc(handlers.BookmarkHandler)))))
+	mux.Handle("/report", auth.SessionMiddleware(auth.RequireAuth(limitReports(http.HandlerFunc(handlers.ReportHandler)))))
+	mux.Handle("/tokens", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.TokensHandler))))
+	mux.Handle("/tokens/create", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.CreateTokenHandler))))
+	mux.Handle("/tokens/revoke", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.RevokeTokenHandler))))
+	mux.Handle("/messages", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.MessagesHandler))))
+	mux.Handle("/messages/", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.ConversationHandler))))
+	mux.Handle("/messages/new", auth.SessionMiddleware(auth.RequireAuth(limitMessages(http.HandlerFunc(handlers.NewConversationHandler)))))
+	mux.Handle("/messages/send", auth.SessionMiddleware(auth.RequireAuth(limitMessages(http.HandlerFunc(handlers.SendMessageHandler)))))
+	mux.Handle("/messages/mute", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.MuteConversationHandler))))
+	mux.Handle("/notifications", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.NotificationsHandler))))
+	mux.Handle("/notifications/read", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.MarkNotificationsReadHandler))))
+	mux.Handle("/notifications/email", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.EmailPreferencesHandler))))
+	mux.Handle("/unsubscribe", auth.SessionMiddleware(http.HandlerFunc(handlers.UnsubscribeHandler)))
+	mux.Handle("/follow/category", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.FollowCategoryHandler))))
+	mux.Handle("/unfollow/category", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.UnfollowCategoryHandler))))
+	mux.Handle("/settings", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.SettingsHandler))))
+	mux.Handle("/settings/profile", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.UpdateProfileHandler))))
+	mux.Handle("/settings/account", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.UpdateAccountHandler))))
+	mux.Handle("/settings/password", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.ChangePasswordHandler))))
+	mux.Handle("/settings/export", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.ExportHandler))))
+	mux.Handle("/settings/delete", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.DeleteAccountHandler))))
+	mux.Handle("/settings/delete/cancel", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.CancelDeletionHandler))))
+	mux.Handle("/settings/email/verify", auth.SessionMiddleware(http.HandlerFunc(handlers.VerifyEmailHandler)))
+	mux.Handle("/follow/user", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.FollowUserHandler))))
+	mux.Handle("/unfollow/user", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.UnfollowUserHandler))))
+	mux.Handle("/blocks/add", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.BlockUserHandler))))
+	mux.Handle("/blocks/remove", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.UnblockUserHandler))))
 	mux.Handle("/logout", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.LogoutHandler))))
 
+	// JSON API, sharing the rate limit buckets of the matching pages. Requests are
+	// authenticated by session cookie or API token.
+	apiLimits := api.Limits{
+		Posts:     ratelimit.MiddlewareWithError(limiter, "post", postLimit, api.Error),
+		Comments:  ratelimit.MiddlewareWithError(limiter, "comment", commentLimit, api.Error),
+		Reactions: ratelimit.MiddlewareWithError(limiter, "like", likeLimit, api.Error),
+	}
+	mux.HandleFunc(api.SpecPath, api.SpecHandler)
+	mux.Handle(api.Prefix+"/", auth.SessionMiddleware(auth.TokenMiddleware(api.Error)(api.Handler(apiLimits))))
+
+	// Post moderation is also open to category moderators, the handlers check per post
+	mux.Handle("/mod/post/move", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.MovePostHandler))))
+	mux.Handle("/mod/post/", auth.SessionMiddleware(auth.RequireAuth(http.HandlerFunc(handlers.ModeratePostHandler))))
+
+	// Moderator routes
+	requireModerator := auth.RequireRole(auth.RoleModerator)
+	mux.Handle("/mod/reports", auth.SessionMiddleware(requireModerator(http.HandlerFunc(handlers.ReportsQueueHandler))))
+	mux.Handle("/mod/reports/", auth.SessionMiddleware(requireModerator(http.HandlerFunc(handlers.ReviewReportHandler))))
+	mux.Handle("/mod/bans", auth.SessionMiddleware(requireModerator(http.HandlerFunc(handlers.BansHandler))))
+	mux.Handle("/mod/bans/ban", auth.SessionMiddleware(requireModerator(http.HandlerFunc(handlers.BanUserHandler))))
+	mux.Handle("/mod/bans/lift", auth.SessionMiddleware(requireModerator(http.HandlerFunc(handlers.LiftBanHandler))))
+
+	// Admin routes
+	requireAdmin := auth.RequireRole(auth.RoleAdmin)
+	mux.Handle("/admin/users", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.AdminUsersHandler))))
+	mux.Handle("/admin/users/role", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.ChangeRoleHandler))))
+	mux.Handle("/admin/categories", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.AdminCategoriesHandler))))
+	mux.Handle("/admin/categories/", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.CategoryActionHandler))))
+	mux.Handle("/admin/groups", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.GroupsHandler))))
+	mux.Handle("/admin/groups/", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.GroupActionHandler))))
+	mux.Handle("/admin/audit", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.AuditLogHandler))))
+	mux.Handle("/admin/audit.csv", auth.SessionMiddleware(requireAdmin(http.HandlerFunc(handlers.AuditExportHandler))))
+
 	// Register GitHub OAuth routes with the same mux
 	mux.HandleFunc("/auth/github", handlers.GitHubLoginHandler)
 	mux.HandleFunc("/oauth2/callback/github", handlers.GitHubCallbackHandler)
@@ -40,9 +156,12 @@ func main() {
 	mux.HandleFunc("/auth/google", handlers.GoogleLoginHandler)
     mux.HandleFunc("/auth/callback/google", handlers.GoogleCallbackHandler)
 
+	// Global limit per client IP in front of every route
+	limitGlobal := ratelimit.Middleware(limiter, "global", globalLimit)
+
 	server := http.Server{
 		Addr:    ":8080",
-		Handler: mux,
+		Handler: limitGlobal(mux),
 	}
 
 	log.Println("Server started at http://localhost:8080")
@@ -50,3 +169,4 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
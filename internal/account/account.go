@@ -0,0 +1,49 @@
+// Package account lets users take their data with them and leave: it exports an
+// account as a ZIP of JSON files and deletes accounts once their grace period
+// is over.
+package account
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"forum/internal/db"
+	"forum/internal/utils"
+)
+
+// GracePeriod is how long after asking for it an account is deleted. Until then
+// its owner can sign back in and cancel.
+const GracePeriod = 14 * 24 * time.Hour
+
+// DeleteDue anonymizes the accounts whose grace period is over at now and deletes
+// their uploaded profile pictures. Failures for one account are logged and do not
+// stop the others.
+func DeleteDue(now time.Time) error {
+	userIDs, err := db.DueAccountDeletions(now)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		picture, err := db.AnonymizeUser(userID)
+		if err != nil {
+			log.Printf("Failed to delete account %d: %v", userID, err)
+			continue
+		}
+		removeUpload(picture)
+	}
+	return nil
+}
+
+// removeUpload deletes an image stored by utils.SaveImage, given its URL.
+func removeUpload(url string) {
+	name := strings.TrimPrefix(url, "/static/images/")
+	if name == url || name == "" || strings.ContainsAny(name, `/\`) {
+		return
+	}
+	if err := os.Remove(filepath.Join(utils.UploadDir, name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to delete upload %s: %v", name, err)
+	}
+}
@@ -0,0 +1,168 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/db"
+	"forum/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	// db.Init reads the schema relative to the project root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// setupAccounts opens a fresh database with alice (1) and bob (2). Alice has a
+// post that bob commented on and liked, and a session.
+func setupAccounts(t *testing.T) {
+	t.Helper()
+	if err := db.Init("file:" + t.Name() + "?mode=memory&cache=shared"); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	for _, stmt := range []string{
+		`INSERT INTO users (user_id, username, email, password, bio) VALUES (1, 'alice', 'alice@example.com', 'x', 'Hi'), (2, 'bob', 'bob@example.com', 'x', '')`,
+		`INSERT INTO posts (post_id, user_id, title, content) VALUES (1, 1, 'Hello', 'First post'), (2, 2, 'Reply', 'Bob writes')`,
+		`INSERT INTO post_categories (post_id, category_id) VALUES (1, 1)`,
+		`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (1, 1, 2, 'Nice'), (2, 2, 1, 'Thanks')`,
+		`INSERT INTO likes (user_id, post_id, like_type) VALUES (1, 2, 'like'), (2, 1, 'like')`,
+		`INSERT INTO likes (user_id, comment_id, like_type) VALUES (1, 1, 'dislike')`,
+		`INSERT INTO bookmarks (user_id, post_id, folder) VALUES (1, 2, 'Later'), (2, 1, '')`,
+		`INSERT INTO sessions (session_id, user_id, expires_at) VALUES ('secret-session', 1, '2030-01-01 00:00:00')`,
+	} {
+		if _, err := db.DB.Exec(stmt); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	setupAccounts(t)
+
+	var buf bytes.Buffer
+	if err := Export(&buf, 1); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Export is not a ZIP archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if !json.Valid(data) {
+			t.Errorf("expected %s to be JSON", f.Name)
+		}
+		files[f.Name] = string(data)
+	}
+
+	for name, want := range map[string][]string{
+		"profile.json":   {`"username": "alice"`, `"email": "alice@example.com"`, `"bio": "Hi"`},
+		"posts.json":     {`"title": "Hello"`, `"categories": [`},
+		"comments.json":  {`"content": "Thanks"`},
+		"reactions.json": {`"type": "like"`, `"post_id": 2`, `"type": "dislike"`, `"comment_id": 1`},
+		"bookmarks.json": {`"post_id": 2`, `"folder": "Later"`},
+		"sessions.json":  {`"expires_at": "2030-01-01T00:00:00Z"`},
+	} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("expected %s in the export", name)
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(content, w) {
+				t.Errorf("expected %s in %s, got %s", w, name, content)
+			}
+		}
+	}
+	for name, content := range files {
+		if strings.Contains(content, "Bob writes") || strings.Contains(content, "Nice") {
+			t.Errorf("expected only alice's data, found bob's in %s", name)
+		}
+		if strings.Contains(content, "secret-session") || strings.Contains(content, `"password"`) {
+			t.Errorf("expected no credentials in %s", name)
+		}
+	}
+}
+
+func TestDeleteDue(t *testing.T) {
+	setupAccounts(t)
+
+	dir := t.TempDir()
+	saved := utils.UploadDir
+	utils.UploadDir = dir
+	defer func() { utils.UploadDir = saved }()
+	os.WriteFile(filepath.Join(dir, "alice.png"), []byte("png"), 0o644)
+	db.DB.Exec(`UPDATE users SET profile_picture = '/static/images/alice.png' WHERE user_id = 1`)
+
+	now := time.Now()
+	if err := db.ScheduleAccountDeletion(1, now.Add(GracePeriod)); err != nil {
+		t.Fatalf("Failed to schedule deletion: %v", err)
+	}
+	var sessions int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 1`).Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("expected scheduling to sign alice out, got %d sessions", sessions)
+	}
+
+	DeleteDue(now.Add(GracePeriod - time.Hour))
+	if user, _ := db.UserByID(1); user.Username != "alice" {
+		t.Fatalf("expected alice to stay during the grace period, got %q", user.Username)
+	}
+
+	db.DB.Exec(`INSERT INTO login_attempts (account_key, ip_address, attempted_at) VALUES ('user:1', '203.0.113.7', ?), ('user:2', '198.51.100.2', ?)`, now, now)
+	db.DB.Exec(`INSERT INTO reports (reporter_id, post_id, reason, details) VALUES (1, 1, 'other', 'My neighbour wrote this')`)
+
+	DeleteDue(now.Add(GracePeriod + time.Hour))
+	user, err := db.UserByID(1)
+	if err != nil {
+		t.Fatalf("expected the user row to stay for the content: %v", err)
+	}
+	if user.Username != "[deleted-1]" || user.Email == "alice@example.com" || user.Bio != "" || user.ProfilePicture != "" {
+		t.Errorf("expected alice to be anonymized, got %+v", user)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice.png")); !os.IsNotExist(err) {
+		t.Errorf("expected the profile picture to be deleted, got %v", err)
+	}
+	if at, _ := db.AccountDeletion(1); !at.IsZero() {
+		t.Error("expected the deletion to be done")
+	}
+
+	// The discussion stays, reactions go
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM posts WHERE user_id = 1`:                     1,
+		`SELECT COUNT(*) FROM comments`:                                    2,
+		`SELECT COUNT(*) FROM likes WHERE user_id = 1`:                     0,
+		`SELECT COUNT(*) FROM likes WHERE user_id = 2`:                     1,
+		`SELECT COUNT(*) FROM bookmarks WHERE user_id = 1`:                 0,
+		`SELECT COUNT(*) FROM users WHERE username = 'bob'`:                1,
+		`SELECT COUNT(*) FROM login_attempts WHERE account_key = 'user:1'`: 0,
+		`SELECT COUNT(*) FROM login_attempts WHERE account_key = 'user:2'`: 1,
+		`SELECT COUNT(*) FROM reports WHERE reporter_id = 1`:               1,
+		`SELECT COUNT(*) FROM reports WHERE details IS NOT NULL`:           0,
+	} {
+		var got int
+		if err := db.DB.QueryRow(query).Scan(&got); err != nil || got != want {
+			t.Errorf("%s: expected %d, got %d (%v)", query, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package account
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"forum/internal/db"
+)
+
+type exportPost struct {
+	PostID     int       `json:"post_id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	ImageURL   string    `json:"image_url,omitempty"`
+	Categories []string  `json:"categories"`
+	Removed    bool      `json:"removed"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type exportComment struct {
+	CommentID int       `json:"comment_id"`
+	PostID    int       `json:"post_id"`
+	Content   string    `json:"content"`
+	Removed   bool      `json:"removed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportReaction struct {
+	Type      string    `json:"type"`
+	PostID    *int      `json:"post_id,omitempty"`
+	CommentID *int      `json:"comment_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportBookmark struct {
+	PostID    int       `json:"post_id"`
+	Folder    string    `json:"folder,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportSession leaves out the session ID, which would sign in as the user.
+type exportSession struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Export writes the data of a user as a ZIP archive of JSON files: their profile,
+// posts, comments, reactions, bookmarks and sessions. Removed posts and comments are
+// included and marked as such.
+func Export(w io.Writer, userID int) error {
+	user, err := db.UserByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user: %v", err)
+	}
+	posts, err := exportPosts(userID)
+	if err != nil {
+		return err
+	}
+	comments, err := exportComments(userID)
+	if err != nil {
+		return err
+	}
+	reactions, err := exportReactions(userID)
+	if err != nil {
+		return err
+	}
+	bookmarks, err := exportBookmarks(userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := exportSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"reactions.json", reactions},
+		{"bookmarks.json", bookmarks},
+		{"sessions.json", sessions},
+	} {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return fmt.Errorf("failed to write export: %v", err)
+		}
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return fmt.Errorf("failed to write %s: %v", f.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	return nil
+}
+
+func exportPosts(userID int) ([]exportPost, error) {
+	rows, err := db.DB.Query(`
+		SELECT p.post_id, p.title, p.content, COALESCE(p.imgurl, ''), p.removed, p.created_at, p.updated_at,
+			COALESCE((SELECT GROUP_CONCAT(c.name, '|') FROM post_categories pc
+				JOIN categories c ON pc.category_id = c.category_id WHERE pc.post_id = p.post_id), '')
+		FROM posts p WHERE p.user_id = ? ORDER BY p.post_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts: %v", err)
+	}
+	defer rows.Close()
+
+	posts := []exportPost{}
+	for rows.Next() {
+		var p exportPost
+		var categories string
+		if err := rows.Scan(&p.PostID, &p.Title, &p.Content, &p.ImageURL, &p.Removed, &p.CreatedAt, &p.UpdatedAt, &categories); err != nil {
+			return nil, fmt.Errorf("failed to scan post: %v", err)
+		}
+		p.Categories = []string{}
+		if categories != "" {
+			p.Categories = strings.Split(categories, "|")
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func exportComments(userID int) ([]exportComment, error) {
+	rows, err := db.DB.Query(`SELECT comment_id, post_id, content, removed, created_at, updated_at
+		FROM comments WHERE user_id = ? ORDER BY comment_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query comments: %v", err)
+	}
+	defer rows.Close()
+
+	comments := []exportComment{}
+	for rows.Next() {
+		var c exportComment
+		if err := rows.Scan(&c.CommentID, &c.PostID, &c.Content, &c.Removed, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %v", err)
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func exportReactions(userID int) ([]exportReaction, error) {
+	rows, err := db.DB.Query(`SELECT like_type, post_id, comment_id, created_at FROM likes WHERE user_id = ? ORDER BY like_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %v", err)
+	}
+	defer rows.Close()
+
+	reactions := []exportReaction{}
+	for rows.Next() {
+		var r exportReaction
+		var postID, commentID sql.NullInt64
+		if err := rows.Scan(&r.Type, &postID, &commentID, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %v", err)
+		}
+		if postID.Valid {
+			id := int(postID.Int64)
+			r.PostID = &id
+		}
+		if commentID.Valid {
+			id := int(commentID.Int64)
+			r.CommentID = &id
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+func exportBookmarks(userID int) ([]exportBookmark, error) {
+	rows, err := db.DB.Query(`SELECT post_id, folder, created_at FROM bookmarks WHERE user_id = ? ORDER BY created_at, post_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %v", err)
+	}
+	defer rows.Close()
+
+	bookmarks := []exportBookmark{}
+	for rows.Next() {
+		var b exportBookmark
+		if err := rows.Scan(&b.PostID, &b.Folder, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark: %v", err)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+func exportSessions(userID int) ([]exportSession, error) {
+	rows, err := db.DB.Query(`SELECT expires_at FROM sessions WHERE user_id = ? ORDER BY expires_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []exportSession{}
+	for rows.Next() {
+		var s exportSession
+		if err := rows.Scan(&s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %v", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
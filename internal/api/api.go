@@ -0,0 +1,248 @@
+// Package api serves the versioned JSON API under /api/v1. It shares the session
+// cookie, permissions and rate limits of the HTML pages but answers every request,
+// errors included, with JSON.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+)
+
+// Prefix is the path the API is mounted at.
+const Prefix = "/api/v1"
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Limits are the rate limits applied to API writes. They should share their buckets
+// with the matching HTML routes so the API is no way around them. Nil means no limit.
+type Limits struct {
+	Posts     func(http.Handler) http.Handler
+	Comments  func(http.Handler) http.Handler
+	Reactions func(http.Handler) http.Handler
+}
+
+// route maps a path to its handlers by method. In pattern, {id} matches a
+// positive integer which handlers read with routeID.
+type route struct {
+	pattern string
+	methods map[string]http.Handler
+}
+
+type handler struct {
+	routes []route
+}
+
+type contextKey string
+
+const idKey contextKey = "id"
+
+// Handler returns the API handler, to be mounted at Prefix + "/" behind the
+// session middleware.
+func Handler(limits Limits) http.Handler {
+	limit := func(l func(http.Handler) http.Handler, h http.HandlerFunc) http.Handler {
+		if l == nil {
+			return requireUser(h)
+		}
+		return requireUser(l(h))
+	}
+
+	return &handler{routes: []route{
+		{"/posts", map[string]http.Handler{
+			http.MethodGet:  http.HandlerFunc(listPosts),
+			http.MethodPost: limit(limits.Posts, createPost),
+		}},
+		{"/posts/{id}", map[string]http.Handler{
+			http.MethodGet:    http.HandlerFunc(getPost),
+			http.MethodPatch:  requireUser(http.HandlerFunc(updatePost)),
+			http.MethodDelete: requireUser(http.HandlerFunc(deletePost)),
+		}},
+		{"/posts/{id}/comments", map[string]http.Handler{
+			http.MethodGet:  http.HandlerFunc(listComments),
+			http.MethodPost: limit(limits.Comments, createComment),
+		}},
+		{"/comments/{id}", map[string]http.Handler{
+			http.MethodGet:    http.HandlerFunc(getComment),
+			http.MethodPatch:  requireUser(http.HandlerFunc(updateComment)),
+			http.MethodDelete: requireUser(http.HandlerFunc(deleteComment)),
+		}},
+		{"/categories", map[string]http.Handler{
+			http.MethodGet: http.HandlerFunc(listCategories),
+		}},
+		{"/reactions", map[string]http.Handler{
+			http.MethodPost: limit(limits.Reactions, react),
+		}},
+		{"/users", map[string]http.Handler{
+			http.MethodGet: requireUser(http.HandlerFunc(searchUsers)),
+		}},
+		{"/me", map[string]http.Handler{
+			http.MethodGet: requireUser(http.HandlerFunc(me)),
+		}},
+	}}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, Prefix), "/")
+	for _, rt := range h.routes {
+		id, ok := match(rt.pattern, path)
+		if !ok {
+			continue
+		}
+		next, ok := rt.methods[r.Method]
+		if !ok {
+			allowed := make([]string, 0, len(rt.methods))
+			for method := range rt.methods {
+				allowed = append(allowed, method)
+			}
+			sort.Strings(allowed)
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), idKey, id)))
+		return
+	}
+	Error(w, http.StatusNotFound, "Not found")
+}
+
+// match reports whether path matches pattern and returns the {id} it holds.
+func match(pattern, path string) (int, bool) {
+	want := strings.Split(pattern, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return 0, false
+	}
+	id := 0
+	for i := range want {
+		if want[i] == "{id}" {
+			n, err := strconv.Atoi(got[i])
+			if err != nil || n <= 0 {
+				return 0, false
+			}
+			id = n
+		} else if want[i] != got[i] {
+			return 0, false
+		}
+	}
+	return id, true
+}
+
+// routeID returns the {id} of the matched route.
+func routeID(r *http.Request) int {
+	id, _ := r.Context().Value(idKey).(int)
+	return id
+}
+
+// requireUser answers 401 to anonymous requests instead of redirecting them to the
+// login page like auth.RequireAuth.
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.GetCurrentUserID(r) == 0 {
+			Error(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errorBody is the body of every error response.
+type errorBody struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Error writes a JSON error. It has the signature of utils.DisplayError so it can
+// stand in for it, for example in ratelimit.MiddlewareWithError.
+func Error(w http.ResponseWriter, code int, message string) {
+	var body errorBody
+	body.Error.Status = code
+	body.Error.Message = message
+	writeJSON(w, code, body)
+}
+
+// Pagination describes the page of a list response.
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// envelope wraps every successful response.
+type envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// writeData writes data as a successful response.
+func writeData(w http.ResponseWriter, code int, data interface{}) {
+	writeJSON(w, code, envelope{Data: data})
+}
+
+// writeList writes one page of a list.
+func writeList(w http.ResponseWriter, data interface{}, page Pagination, total int) {
+	page.Total = total
+	page.TotalPages = int(math.Ceil(float64(total) / float64(page.PerPage)))
+	writeJSON(w, http.StatusOK, envelope{Data: data, Pagination: &page})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// internalError logs err and answers with a generic 500.
+func internalError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	Error(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// readPage reads the page and per_page query parameters.
+func readPage(r *http.Request) (Pagination, bool) {
+	page := Pagination{Page: 1, PerPage: defaultPerPage}
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return page, false
+		}
+		page.Page = n
+	}
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerPage {
+			return page, false
+		}
+		page.PerPage = n
+	}
+	return page, true
+}
+
+func (p Pagination) offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// decode reads a JSON request body into v, rejecting unknown fields.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		Error(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
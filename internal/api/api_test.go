@@ -0,0 +1,409 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	// db.Init reads the schema relative to the project root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// setupAPI opens a fresh database with the real schema and two users, alice (1)
+// and bob (2).
+func setupAPI(t *testing.T) {
+	t.Helper()
+	if err := db.Init("file:" + t.Name() + "?mode=memory&cache=shared"); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	_, err := db.DB.Exec(`INSERT INTO users (user_id, username, email, password) VALUES
+		(1, 'alice', 'alice@example.com', 'x'), (2, 'bob', 'bob@example.com', 'x')`)
+	if err != nil {
+		t.Fatalf("Failed to insert users: %v", err)
+	}
+}
+
+// call sends a request to the API as userID, 0 for anonymous, and decodes the
+// JSON response into out when it is not nil.
+func call(t *testing.T, method, target string, userID int, body string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, Prefix+target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req = auth.SetUserID(req, strconv.Itoa(userID))
+	}
+	rr := httptest.NewRecorder()
+	Handler(Limits{}).ServeHTTP(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusNoContent && ct != "application/json" {
+		t.Fatalf("%s %s: expected a JSON response, got %q: %s", method, target, ct, rr.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, target, rr.Body.String(), err)
+		}
+	}
+	return rr
+}
+
+type postResponse struct {
+	Data struct {
+		PostID     int      `json:"post_id"`
+		Title      string   `json:"title"`
+		Content    string   `json:"content"`
+		Username   string   `json:"username"`
+		Categories []string `json:"categories"`
+	} `json:"data"`
+}
+
+type listResponse struct {
+	Data       []json.RawMessage `json:"data"`
+	Pagination Pagination        `json:"pagination"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func TestPostsAPI(t *testing.T) {
+	setupAPI(t)
+
+	var created postResponse
+	rr := call(t, http.MethodPost, "/posts", 1, `{"title": "Hello", "content": "First post", "category_ids": [1]}`, &created)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if created.Data.Title != "Hello" || created.Data.Username != "alice" || len(created.Data.Categories) != 1 {
+		t.Errorf("Unexpected created post: %+v", created.Data)
+	}
+	if loc := rr.Header().Get("Location"); loc != fmt.Sprintf("%s/posts/%d", Prefix, created.Data.PostID) {
+		t.Errorf("Unexpected Location %q", loc)
+	}
+	postPath := fmt.Sprintf("/posts/%d", created.Data.PostID)
+
+	var errBody errorResponse
+	if rr := call(t, http.MethodPost, "/posts", 0, `{"title": "Hi", "content": "Anon"}`, &errBody); rr.Code != http.StatusUnauthorized || errBody.Error.Status != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 JSON error for anonymous posts, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(t, http.MethodPost, "/posts", 1, `{"title": " ", "content": "x"}`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a blank title, got %d", rr.Code)
+	}
+	if rr := call(t, http.MethodPost, "/posts", 1, `{"title": "x", "content": "x", "bogus": 1}`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown fields, got %d", rr.Code)
+	}
+
+	// Only the author edits and deletes
+	if rr := call(t, http.MethodPatch, postPath, 2, `{"title": "Mine now"}`, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 editing someone else's post, got %d", rr.Code)
+	}
+	var updated postResponse
+	if rr := call(t, http.MethodPatch, postPath, 1, `{"title": "Hello again"}`, &updated); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 editing own post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if updated.Data.Title != "Hello again" || updated.Data.Content != "First post" {
+		t.Errorf("Expected only the title to change, got %+v", updated.Data)
+	}
+
+	if rr := call(t, http.MethodDelete, postPath, 2, "", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 deleting someone else's post, got %d", rr.Code)
+	}
+	if rr := call(t, http.MethodDelete, postPath, 1, "", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 deleting own post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(t, http.MethodGet, postPath, 1, "", &errBody); rr.Code != http.StatusNotFound || errBody.Error.Message != "Post not found" {
+		t.Errorf("Expected a 404 JSON error for a deleted post, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPostsAPIPagination(t *testing.T) {
+	setupAPI(t)
+
+	for i := 1; i <= 5; i++ {
+		body := fmt.Sprintf(`{"title": "Post %d", "content": "Body", "category_ids": [%d]}`, i, 1+i%2)
+		if rr := call(t, http.MethodPost, "/posts", 1, body, nil); rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create post: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	var list listResponse
+	call(t, http.MethodGet, "/posts?per_page=2&page=3", 0, "", &list)
+	want := Pagination{Page: 3, PerPage: 2, Total: 5, TotalPages: 3}
+	if list.Pagination != want || len(list.Data) != 1 {
+		t.Errorf("Expected the last page of one post with %+v, got %d posts with %+v", want, len(list.Data), list.Pagination)
+	}
+
+	call(t, http.MethodGet, "/posts?category=health&author=alice", 0, "", &list)
+	if list.Pagination.Total != 3 {
+		t.Errorf("Expected 3 posts in Health, got %d", list.Pagination.Total)
+	}
+
+	if rr := call(t, http.MethodGet, "/posts?per_page=1000", 0, "", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an oversized page, got %d", rr.Code)
+	}
+	if rr := call(t, http.MethodGet, "/posts?author=nobody", 0, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown author, got %d", rr.Code)
+	}
+}
+
+func TestCommentsAPI(t *testing.T) {
+	setupAPI(t)
+
+	var post postResponse
+	call(t, http.MethodPost, "/posts", 1, `{"title": "Hello", "content": "Body"}`, &post)
+	commentsPath := fmt.Sprintf("/posts/%d/comments", post.Data.PostID)
+
+	var comment struct {
+		Data struct {
+			CommentID int    `json:"comment_id"`
+			Content   string `json:"content"`
+		} `json:"data"`
+	}
+	if rr := call(t, http.MethodPost, commentsPath, 2, `{"content": "Nice"}`, &comment); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a comment, got %d: %s", rr.Code, rr.Body.String())
+	}
+	call(t, http.MethodPost, commentsPath, 1, `{"content": "Thanks"}`, nil)
+
+	var list listResponse
+	call(t, http.MethodGet, commentsPath+"?per_page=1", 0, "", &list)
+	if list.Pagination.Total != 2 || list.Pagination.TotalPages != 2 || len(list.Data) != 1 {
+		t.Errorf("Unexpected comment page: %d comments, %+v", len(list.Data), list.Pagination)
+	}
+
+	commentPath := fmt.Sprintf("/comments/%d", comment.Data.CommentID)
+	if rr := call(t, http.MethodPatch, commentPath, 1, `{"content": "Edited"}`, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 editing someone else's comment, got %d", rr.Code)
+	}
+	call(t, http.MethodPatch, commentPath, 2, `{"content": "Very nice"}`, &comment)
+	if comment.Data.Content != "Very nice" {
+		t.Errorf("Expected the comment to be edited, got %q", comment.Data.Content)
+	}
+	if rr := call(t, http.MethodDelete, commentPath, 2, "", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting own comment, got %d", rr.Code)
+	}
+	if rr := call(t, http.MethodGet, commentPath, 2, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted comment, got %d", rr.Code)
+	}
+
+	db.DB.Exec(`UPDATE posts SET locked = 1 WHERE post_id = ?`, post.Data.PostID)
+	if rr := call(t, http.MethodPost, commentsPath, 2, `{"content": "Late"}`, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 commenting on a locked post, got %d", rr.Code)
+	}
+}
+
+func TestPrivateContentAPI(t *testing.T) {
+	setupAPI(t)
+
+	db.DB.Exec(`UPDATE categories SET private = 1 WHERE category_id = 1`)
+	db.DB.Exec(`UPDATE users SET role = 'admin' WHERE user_id = 1`)
+
+	var post postResponse
+	if rr := call(t, http.MethodPost, "/posts", 1, `{"title": "Secret", "content": "Body", "category_ids": [1]}`, &post); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the admin to post in a private category, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(t, http.MethodPost, "/posts", 2, `{"title": "Sneaky", "content": "Body", "category_ids": [1]}`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 posting in a category bob cannot see, got %d", rr.Code)
+	}
+
+	var list listResponse
+	call(t, http.MethodGet, "/posts", 2, "", &list)
+	if list.Pagination.Total != 0 {
+		t.Errorf("Expected the private post to be hidden from bob, got %d posts", list.Pagination.Total)
+	}
+	postPath := fmt.Sprintf("/posts/%d", post.Data.PostID)
+	if rr := call(t, http.MethodGet, postPath, 2, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a private post, got %d", rr.Code)
+	}
+	body := fmt.Sprintf(`{"post_id": %d, "like_type": "like"}`, post.Data.PostID)
+	if rr := call(t, http.MethodPost, "/reactions", 2, body, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 reacting to a private post, got %d", rr.Code)
+	}
+	if rr := call(t, http.MethodGet, "/posts?category=technology", 2, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 filtering by a private category, got %d", rr.Code)
+	}
+}
+
+func TestMentionsAPI(t *testing.T) {
+	setupAPI(t)
+	db.DB.Exec(`INSERT INTO users (user_id, username, email, password) VALUES
+		(3, 'Bobby', 'bobby@example.com', 'x'), (4, 'carol', 'carol@example.com', 'x')`)
+
+	var matches struct {
+		Data []userMatch `json:"data"`
+	}
+	call(t, http.MethodGet, "/users?prefix=BO", 1, "", &matches)
+	if len(matches.Data) != 2 || matches.Data[0].Username != "bob" || matches.Data[1].Username != "Bobby" {
+		t.Errorf("Expected bob and Bobby, got %+v", matches.Data)
+	}
+	if rr := call(t, http.MethodGet, "/users?prefix=a", 0, "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 searching users anonymously, got %d", rr.Code)
+	}
+
+	mentions := func(userID int) int {
+		var count int
+		db.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'mention'`, userID).Scan(&count)
+		return count
+	}
+
+	// Editing a post notifies the newly mentioned only
+	var post postResponse
+	call(t, http.MethodPost, "/posts", 1, `{"title": "Hello", "content": "Hey @bob"}`, &post)
+	postPath := fmt.Sprintf("/posts/%d", post.Data.PostID)
+	call(t, http.MethodPatch, postPath, 1, `{"content": "Hey @bob and @carol, @alice"}`, nil)
+	if mentions(2) != 1 || mentions(4) != 1 || mentions(1) != 0 {
+		t.Errorf("Expected one mention each for bob and carol, got %d and %d, and %d for alice", mentions(2), mentions(4), mentions(1))
+	}
+
+	// The post author is told of the comment rather than the mention
+	call(t, http.MethodPost, postPath+"/comments", 2, `{"content": "@alice @Bobby thanks"}`, nil)
+	if mentions(1) != 0 || mentions(3) != 1 {
+		t.Errorf("Expected only Bobby to be mentioned, got %d for alice and %d for Bobby", mentions(1), mentions(3))
+	}
+}
+
+func TestReactionsAPI(t *testing.T) {
+	setupAPI(t)
+
+	var post postResponse
+	call(t, http.MethodPost, "/posts", 1, `{"title": "Hello", "content": "Body"}`, &post)
+
+	var result struct {
+		Data reaction `json:"data"`
+	}
+	// user_id in the body does not change who reacts
+	body := fmt.Sprintf(`{"user_id": 1, "post_id": %d, "like_type": "like"}`, post.Data.PostID)
+	call(t, http.MethodPost, "/reactions", 2, body, &result)
+	if result.Data.Likes != 1 || result.Data.Reaction != "like" {
+		t.Errorf("Expected one like, got %+v", result.Data)
+	}
+	var owner int
+	db.DB.QueryRow(`SELECT user_id FROM likes`).Scan(&owner)
+	if owner != 2 {
+		t.Errorf("Expected the like to belong to bob, got user %d", owner)
+	}
+
+	body = fmt.Sprintf(`{"post_id": %d, "like_type": "dislike"}`, post.Data.PostID)
+	call(t, http.MethodPost, "/reactions", 2, body, &result)
+	if result.Data.Likes != 0 || result.Data.Dislikes != 1 || result.Data.Reaction != "dislike" {
+		t.Errorf("Expected the like to switch to a dislike, got %+v", result.Data)
+	}
+	call(t, http.MethodPost, "/reactions", 2, body, &result)
+	if result.Data.Dislikes != 0 || result.Data.Reaction != "" {
+		t.Errorf("Expected the dislike to be taken back, got %+v", result.Data)
+	}
+
+	if rr := call(t, http.MethodPost, "/reactions", 2, `{"like_type": "like"}`, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a target, got %d", rr.Code)
+	}
+}
+
+func TestRoutingAPI(t *testing.T) {
+	setupAPI(t)
+
+	var errBody errorResponse
+	if rr := call(t, http.MethodGet, "/nothing", 0, "", &errBody); rr.Code != http.StatusNotFound || errBody.Error.Status != http.StatusNotFound {
+		t.Errorf("Expected a 404 JSON error, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(t, http.MethodGet, "/posts/abc", 0, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a non-numeric ID, got %d", rr.Code)
+	}
+	rr := call(t, http.MethodPut, "/posts", 1, "", &errBody)
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("Expected 405 allowing GET, POST, got %d allowing %q", rr.Code, rr.Header().Get("Allow"))
+	}
+
+	var me struct {
+		Data struct {
+			Username string `json:"username"`
+		} `json:"data"`
+	}
+	call(t, http.MethodGet, "/me", 2, "", &me)
+	if me.Data.Username != "bob" {
+		t.Errorf("Expected /me to be bob, got %q", me.Data.Username)
+	}
+	if rr := call(t, http.MethodGet, "/me", 0, "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for anonymous /me, got %d", rr.Code)
+	}
+
+	var categories struct {
+		Data []struct {
+			Slug string `json:"slug"`
+		} `json:"data"`
+	}
+	call(t, http.MethodGet, "/categories", 0, "", &categories)
+	if len(categories.Data) != 6 || categories.Data[0].Slug != "technology" {
+		t.Errorf("Expected the 6 seeded categories, got %+v", categories.Data)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	setupAPI(t)
+
+	readToken, _ := db.CreateAPIToken(1, "read", models.ScopeRead, nil)
+	writeToken, _ := db.CreateAPIToken(1, "write", models.ScopeWrite, nil)
+	past := time.Now().Add(-time.Hour)
+	expiredToken, _ := db.CreateAPIToken(1, "old", models.ScopeWrite, &past)
+
+	withToken := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, Prefix+target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		auth.TokenMiddleware(Error)(Handler(Limits{})).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := withToken(http.MethodGet, "/me", readToken, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"username":"alice"`) {
+		t.Errorf("Expected a read token to authenticate as alice, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var lastUsed sql.NullTime
+	db.DB.QueryRow(`SELECT last_used_at FROM api_tokens WHERE name = 'read'`).Scan(&lastUsed)
+	if !lastUsed.Valid {
+		t.Error("Expected the token use to be recorded")
+	}
+
+	post := `{"title": "Automated", "content": "Body"}`
+	if rr := withToken(http.MethodPost, "/posts", readToken, post); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 writing with a read token, got %d", rr.Code)
+	}
+	if rr := withToken(http.MethodPost, "/posts", writeToken, post); rr.Code != http.StatusCreated {
+		t.Errorf("Expected 201 writing with a write token, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for name, token := range map[string]string{"expired": expiredToken, "unknown": "forum_nope"} {
+		rr := withToken(http.MethodGet, "/me", token, "")
+		var errBody errorResponse
+		json.Unmarshal(rr.Body.Bytes(), &errBody)
+		if rr.Code != http.StatusUnauthorized || errBody.Error.Status != http.StatusUnauthorized {
+			t.Errorf("Expected a 401 JSON error for an %s token, got %d: %s", name, rr.Code, rr.Body.String())
+		}
+	}
+
+	db.DB.Exec(`INSERT INTO bans (user_id, banned_by, reason) VALUES (1, 2, 'Spam')`)
+	if rr := withToken(http.MethodGet, "/me", writeToken, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a banned user's token, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+
+	"forum/internal/auth"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// listCategories serves GET /categories: the categories the current user may see,
+// each followed by its subcategories.
+func listCategories(w http.ResponseWriter, r *http.Request) {
+	categories := utils.FetchCategories(auth.GetCurrentUserID(r))
+	if categories == nil {
+		categories = []models.Categories{}
+	}
+	writeData(w, http.StatusOK, categories)
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/feed"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// commentInput is the body of comment creation and updates.
+type commentInput struct {
+	Content string `json:"content"`
+}
+
+// listComments serves GET /posts/{id}/comments, oldest first.
+func listComments(w http.ResponseWriter, r *http.Request) {
+	page, ok := readPage(r)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Invalid page or per_page")
+		return
+	}
+	post, ok := loadPost(w, r, routeID(r))
+	if !ok {
+		return
+	}
+
+	comments, total, err := feed.CommentPage(post.PostID, page.PerPage, page.offset())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	writeList(w, comments, page, total)
+}
+
+// createComment serves POST /posts/{id}/comments with the same checks as the
+// comment form.
+func createComment(w http.ResponseWriter, r *http.Request) {
+	post, ok := loadPost(w, r, routeID(r))
+	if !ok {
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	access, err := db.PostAccess(userID, post.PostID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if !access.Comment {
+		Error(w, http.StatusForbidden, "You are not allowed to comment on this post")
+		return
+	}
+	if post.Locked {
+		Error(w, http.StatusForbidden, "This post is locked, new comments are not allowed")
+		return
+	}
+
+	var in commentInput
+	if !decode(w, r, &in) {
+		return
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		Error(w, http.StatusBadRequest, "Content cannot be empty")
+		return
+	}
+
+	commentID, err := db.CreateComment(post.PostID, userID, in.Content)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	events.PublishComment(events.CommentCreated, post.PostID, commentID)
+	if err := db.NotifyComment(userID, post.PostID, commentID); err != nil {
+		log.Println(err)
+	}
+	if err := db.NotifyMentions(userID, post.PostID, &commentID, utils.Mentions(in.Content)); err != nil {
+		log.Println(err)
+	}
+	comment, err := feed.Comment(commentID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/comments/%d", Prefix, commentID))
+	writeData(w, http.StatusCreated, comment)
+}
+
+// getComment serves GET /comments/{id}.
+func getComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := loadComment(w, r)
+	if !ok {
+		return
+	}
+	writeData(w, http.StatusOK, comment)
+}
+
+// updateComment serves PATCH /comments/{id}. Only the author may edit a comment.
+func updateComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := loadOwnComment(w, r)
+	if !ok {
+		return
+	}
+
+	var in commentInput
+	if !decode(w, r, &in) {
+		return
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		Error(w, http.StatusBadRequest, "Content cannot be empty")
+		return
+	}
+
+	if err := db.UpdateComment(comment.CommentID, in.Content); err != nil {
+		internalError(w, err)
+		return
+	}
+	events.PublishComment(events.CommentUpdated, comment.PostID, comment.CommentID)
+	if err := db.NotifyMentions(comment.UserID, comment.PostID, &comment.CommentID, utils.Mentions(in.Content)); err != nil {
+		log.Println(err)
+	}
+	comment, err := feed.Comment(comment.CommentID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, comment)
+}
+
+// deleteComment serves DELETE /comments/{id}. Only the author may delete a comment.
+func deleteComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := loadOwnComment(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteComment(comment.CommentID); err != nil {
+		internalError(w, err)
+		return
+	}
+	events.PublishComment(events.CommentDeleted, comment.PostID, comment.CommentID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadComment loads the comment of the route when the current user may see its
+// post, answering 404 otherwise.
+func loadComment(w http.ResponseWriter, r *http.Request) (models.Comment, bool) {
+	comment, err := feed.Comment(routeID(r))
+	if err == sql.ErrNoRows {
+		Error(w, http.StatusNotFound, "Comment not found")
+		return comment, false
+	} else if err != nil {
+		internalError(w, err)
+		return comment, false
+	}
+
+	access, err := db.PostAccess(auth.GetCurrentUserID(r), comment.PostID)
+	if err != nil && err != sql.ErrNoRows {
+		internalError(w, err)
+		return comment, false
+	}
+	if !access.View {
+		Error(w, http.StatusNotFound, "Comment not found")
+		return comment, false
+	}
+	return comment, true
+}
+
+// loadOwnComment loads the comment of the route, answering 403 when the current
+// user did not write it.
+func loadOwnComment(w http.ResponseWriter, r *http.Request) (models.Comment, bool) {
+	comment, ok := loadComment(w, r)
+	if !ok {
+		return comment, false
+	}
+	if comment.UserID != auth.GetCurrentUserID(r) {
+		Error(w, http.StatusForbidden, "You can only change your own comments")
+		return comment, false
+	}
+	return comment, true
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+)
+
+// SpecPath is where the OpenAPI document of the API is served.
+const SpecPath = "/api/openapi.json"
+
+// object is a JSON object of the OpenAPI document.
+type object = map[string]interface{}
+
+// schemaTypes are the types described under components/schemas. Their schemas are
+// generated from the json tags so the document follows the models.
+var schemaTypes = []struct {
+	name string
+	typ  reflect.Type
+}{
+	{"Post", reflect.TypeOf(models.Post{})},
+	{"Comment", reflect.TypeOf(models.Comment{})},
+	{"LikeRequest", reflect.TypeOf(models.LikeRequest{})},
+	{"Category", reflect.TypeOf(models.Categories{})},
+	{"User", reflect.TypeOf(models.User{})},
+	{"UserMatch", reflect.TypeOf(userMatch{})},
+	{"Reaction", reflect.TypeOf(reaction{})},
+	{"PostInput", reflect.TypeOf(postInput{})},
+	{"CommentInput", reflect.TypeOf(commentInput{})},
+	{"Pagination", reflect.TypeOf(Pagination{})},
+	{"Error", reflect.TypeOf(errorBody{})},
+}
+
+// SpecHandler serves the OpenAPI document.
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(Spec()); err != nil {
+		log.Println(err)
+	}
+}
+
+// Spec returns the OpenAPI 3 document describing every route of Handler.
+func Spec() object {
+	schemas := object{}
+	for _, s := range schemaTypes {
+		schemas[s.name] = schemaOf(s.typ)
+	}
+
+	idParam := object{"name": "id", "in": "path", "required": true, "schema": object{"type": "integer", "minimum": 1}}
+	pageParams := []interface{}{
+		object{"name": "page", "in": "query", "schema": object{"type": "integer", "minimum": 1, "default": 1}},
+		object{"name": "per_page", "in": "query", "schema": object{"type": "integer", "minimum": 1, "maximum": maxPerPage, "default": defaultPerPage}},
+	}
+	public := []interface{}{object{}, object{"cookieAuth": []string{}}, object{"bearerAuth": []string{}}}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Forum API",
+			"version":     "1.0.0",
+			"description": "JSON API of the forum. Requests are authenticated by the session cookie or a personal API token; read-only tokens may only make GET requests.",
+		},
+		"servers":  []interface{}{object{"url": Prefix}},
+		"security": []interface{}{object{"cookieAuth": []string{}}, object{"bearerAuth": []string{}}},
+		"paths": object{
+			"/posts": object{
+				"get": operation("listPosts", "List posts", "Posts the user may see, pinned first and then newest first.", public,
+					append([]interface{}{
+						object{"name": "category", "in": "query", "description": "Category slug, includes its subcategories", "schema": object{"type": "string"}},
+						object{"name": "author", "in": "query", "description": "Username of the author", "schema": object{"type": "string"}},
+					}, pageParams...), nil,
+					responses(http.StatusOK, list("Post"), http.StatusBadRequest, http.StatusNotFound)),
+				"post": operation("createPost", "Create a post", "", nil, nil, ref("PostInput"),
+					responses(http.StatusCreated, data("Post"), http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests)),
+			},
+			"/posts/{id}": object{
+				"parameters": []interface{}{idParam},
+				"get": operation("getPost", "Get a post", "The comments are listed separately.", public, nil, nil,
+					responses(http.StatusOK, data("Post"), http.StatusNotFound)),
+				"patch": operation("updatePost", "Edit a post", "Only the author may edit a post, and its categories cannot be changed.", nil, nil, ref("PostInput"),
+					responses(http.StatusOK, data("Post"), http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound)),
+				"delete": operation("deletePost", "Delete a post", "Only the author may delete a post.", nil, nil, nil,
+					responses(http.StatusNoContent, nil, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound)),
+			},
+			"/posts/{id}/comments": object{
+				"parameters": []interface{}{idParam},
+				"get": operation("listComments", "List the comments of a post", "Oldest first.", public, pageParams, nil,
+					responses(http.StatusOK, list("Comment"), http.StatusBadRequest, http.StatusNotFound)),
+				"post": operation("createComment", "Comment on a post", "Locked posts take no new comments.", nil, nil, ref("CommentInput"),
+					responses(http.StatusCreated, data("Comment"), http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests)),
+			},
+			"/comments/{id}": object{
+				"parameters": []interface{}{idParam},
+				"get": operation("getComment", "Get a comment", "", public, nil, nil,
+					responses(http.StatusOK, data("Comment"), http.StatusNotFound)),
+				"patch": operation("updateComment", "Edit a comment", "Only the author may edit a comment.", nil, nil, ref("CommentInput"),
+					responses(http.StatusOK, data("Comment"), http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound)),
+				"delete": operation("deleteComment", "Delete a comment", "Only the author may delete a comment.", nil, nil, nil,
+					responses(http.StatusNoContent, nil, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound)),
+			},
+			"/categories": object{
+				"get": operation("listCategories", "List categories", "Categories the user may see, each followed by its subcategories.", public, nil, nil,
+					responses(http.StatusOK, object{"type": "object", "required": []string{"data"}, "additionalProperties": false, "properties": object{
+						"data": object{"type": "array", "items": ref("Category")},
+					}})),
+			},
+			"/reactions": object{
+				"post": operation("react", "Like or dislike a post or comment",
+					"Toggles the reaction of the current user: reacting the same way again takes it back. Exactly one of post_id and comment_id is required; user_id is ignored.",
+					nil, nil, ref("LikeRequest"),
+					responses(http.StatusOK, data("Reaction"), http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusTooManyRequests)),
+			},
+			"/users": object{
+				"get": operation("searchUsers", "Find users by username prefix", "For @mention autocomplete, ignoring case, at most 10 in alphabetical order.", nil,
+					[]interface{}{object{"name": "prefix", "in": "query", "required": true, "description": "Start of the username", "schema": object{"type": "string"}}}, nil,
+					responses(http.StatusOK, object{"type": "object", "required": []string{"data"}, "additionalProperties": false, "properties": object{
+						"data": object{"type": "array", "items": ref("UserMatch")},
+					}}, http.StatusBadRequest, http.StatusUnauthorized)),
+			},
+			"/me": object{
+				"get": operation("getMe", "Get the current user", "", nil, nil, nil,
+					responses(http.StatusOK, data("User"), http.StatusUnauthorized)),
+			},
+		},
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"cookieAuth": object{"type": "apiKey", "in": "cookie", "name": "session_id"},
+				"bearerAuth": object{"type": "http", "scheme": "bearer", "description": "Personal API token created at /tokens"},
+			},
+		},
+	}
+}
+
+// operation describes one method of a path. Security is left to the document
+// default when nil.
+func operation(id, summary, description string, security, parameters []interface{}, body object, resp object) object {
+	op := object{"operationId": id, "summary": summary, "responses": resp}
+	if description != "" {
+		op["description"] = description
+	}
+	if security != nil {
+		op["security"] = security
+	}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+	if body != nil {
+		op["requestBody"] = object{"required": true, "content": object{"application/json": object{"schema": body}}}
+	}
+	return op
+}
+
+// responses describes the successful response with its schema, nil for no body,
+// followed by the error statuses of an operation.
+func responses(status int, schema object, errors ...int) object {
+	resp := object{}
+	success := object{"description": http.StatusText(status)}
+	if schema != nil {
+		success["content"] = object{"application/json": object{"schema": schema}}
+	}
+	resp[strconv.Itoa(status)] = success
+	for _, code := range errors {
+		resp[strconv.Itoa(code)] = object{
+			"description": http.StatusText(code),
+			"content":     object{"application/json": object{"schema": ref("Error")}},
+		}
+	}
+	return resp
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// data is the envelope of a single resource.
+func data(name string) object {
+	return object{"type": "object", "required": []string{"data"}, "additionalProperties": false, "properties": object{
+		"data": ref(name),
+	}}
+}
+
+// list is the envelope of a page of resources.
+func list(name string) object {
+	return object{"type": "object", "required": []string{"data", "pagination"}, "additionalProperties": false, "properties": object{
+		"data":       object{"type": "array", "items": ref(name)},
+		"pagination": ref("Pagination"),
+	}}
+}
+
+// schemaOf generates the schema of the JSON encoding of t. Fields without
+// omitempty are required, pointers are nullable, and types listed in schemaTypes
+// are referred to by name.
+func schemaOf(t reflect.Type) object {
+	if t == reflect.TypeOf(time.Time{}) {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaOf(t.Elem())
+		s["nullable"] = true
+		return s
+	case reflect.Slice:
+		return object{"type": "array", "items": refOrSchema(t.Elem())}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Struct:
+		properties := object{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = refOrSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return object{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	}
+	panic("openapi: no schema for " + t.String())
+}
+
+// refOrSchema refers to t by name when it is one of schemaTypes and generates its
+// schema otherwise.
+func refOrSchema(t reflect.Type) object {
+	for _, s := range schemaTypes {
+		if s.typ == t {
+			return ref(s.name)
+		}
+	}
+	return schemaOf(t)
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/db"
+)
+
+// loadSpec returns the document as a client decodes it.
+func loadSpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	SpecHandler(rr, httptest.NewRequest(http.MethodGet, SpecPath, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected the document as JSON, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Invalid document: %v", err)
+	}
+	return spec
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	spec := loadSpec(t)
+	paths := spec["paths"].(map[string]interface{})
+
+	routes := Handler(Limits{}).(*handler).routes
+	if len(paths) != len(routes) {
+		t.Errorf("Expected %d paths, the document has %d", len(routes), len(paths))
+	}
+	for _, rt := range routes {
+		path, ok := paths[rt.pattern].(map[string]interface{})
+		if !ok {
+			t.Errorf("Route %s is missing from the document", rt.pattern)
+			continue
+		}
+		documented := 0
+		for method := range rt.methods {
+			if _, ok := path[strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is missing from the document", method, rt.pattern)
+			}
+			documented++
+		}
+		for key := range path {
+			if key != "parameters" {
+				documented--
+			}
+		}
+		if documented != 0 {
+			t.Errorf("The document lists methods of %s the API does not serve", rt.pattern)
+		}
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"Post", "Comment", "LikeRequest"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("Schema %s is missing", name)
+		}
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	setupAPI(t)
+	spec := loadSpec(t)
+	if validate(spec, ref("Post"), map[string]interface{}{"title": 1}, "post") == nil {
+		t.Fatal("Expected the validator to reject an invalid post")
+	}
+
+	// check sends a request and validates the response against the document entry of
+	// pattern, returning the decoded body.
+	check := func(method, pattern, target string, userID int, body string) map[string]interface{} {
+		t.Helper()
+		rr := call(t, method, target, userID, body, nil)
+		op, ok := lookup(spec, "paths", pattern, strings.ToLower(method)).(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s %s is not documented", method, pattern)
+		}
+		resp, ok := lookup(op, "responses", strconv.Itoa(rr.Code)).(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s: status %d is not documented: %s", method, target, rr.Code, rr.Body.String())
+			return nil
+		}
+		schema, ok := lookup(resp, "content", "application/json", "schema").(map[string]interface{})
+		if !ok {
+			if rr.Body.Len() != 0 {
+				t.Errorf("%s %s: expected no body for status %d", method, target, rr.Code)
+			}
+			return nil
+		}
+		var v interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s %s: invalid JSON: %v", method, target, err)
+		}
+		if err := validate(spec, schema, v, "body"); err != nil {
+			t.Errorf("%s %s (%d): %v\n%s", method, target, rr.Code, err, rr.Body.String())
+		}
+		out, _ := v.(map[string]interface{})
+		return out
+	}
+
+	created := check(http.MethodPost, "/posts", "/posts", 1, `{"title": "Hello", "content": "Body", "category_ids": [1, 2]}`)
+	postID := int(created["data"].(map[string]interface{})["post_id"].(float64))
+	postPath := fmt.Sprintf("/posts/%d", postID)
+
+	check(http.MethodPost, "/posts", "/posts", 0, `{}`)
+	check(http.MethodPost, "/posts", "/posts", 1, `{"title": ""}`)
+	check(http.MethodGet, "/posts", "/posts?per_page=5", 0, "")
+	check(http.MethodGet, "/posts", "/posts?category=nowhere", 0, "")
+	check(http.MethodGet, "/posts/{id}", postPath, 2, "")
+	check(http.MethodGet, "/posts/{id}", "/posts/999", 2, "")
+	check(http.MethodPatch, "/posts/{id}", postPath, 1, `{"content": "Edited"}`)
+	check(http.MethodPatch, "/posts/{id}", postPath, 2, `{"content": "Mine"}`)
+
+	comment := check(http.MethodPost, "/posts/{id}/comments", postPath+"/comments", 2, `{"content": "Nice"}`)
+	commentID := int(comment["data"].(map[string]interface{})["comment_id"].(float64))
+	commentPath := fmt.Sprintf("/comments/%d", commentID)
+	check(http.MethodGet, "/posts/{id}/comments", postPath+"/comments", 0, "")
+	check(http.MethodGet, "/comments/{id}", commentPath, 0, "")
+	check(http.MethodPatch, "/comments/{id}", commentPath, 2, `{"content": "Very nice"}`)
+
+	check(http.MethodPost, "/reactions", "/reactions", 2, fmt.Sprintf(`{"post_id": %d, "like_type": "like"}`, postID))
+	check(http.MethodPost, "/reactions", "/reactions", 1, fmt.Sprintf(`{"comment_id": %d, "like_type": "dislike"}`, commentID))
+	check(http.MethodPost, "/reactions", "/reactions", 1, `{"like_type": "meh"}`)
+
+	// A post with its comments and reactions, as listed
+	check(http.MethodGet, "/posts", "/posts", 1, "")
+	check(http.MethodGet, "/categories", "/categories", 0, "")
+	check(http.MethodGet, "/me", "/me", 1, "")
+	check(http.MethodGet, "/users", "/users?prefix=a", 1, "")
+	check(http.MethodGet, "/users", "/users", 1, "")
+	check(http.MethodGet, "/users", "/users?prefix=a", 0, "")
+	check(http.MethodGet, "/me", "/me", 0, "")
+
+	db.DB.Exec(`UPDATE posts SET locked = 1 WHERE post_id = ?`, postID)
+	check(http.MethodPost, "/posts/{id}/comments", postPath+"/comments", 2, `{"content": "Late"}`)
+
+	check(http.MethodDelete, "/comments/{id}", commentPath, 2, "")
+	check(http.MethodDelete, "/posts/{id}", postPath, 1, "")
+}
+
+// lookup walks nested objects of the document by key.
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// validate checks v against the subset of OpenAPI schemas the document uses.
+func validate(spec, schema map[string]interface{}, v interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := lookup(spec, "components", "schemas", name).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, ref)
+		}
+		return validate(spec, resolved, v, path)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", path)
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", path, v)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := properties[key].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: undocumented property %s", path, key)
+				}
+				continue
+			}
+			if err := validate(spec, prop, obj[key], path+"."+key); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", path, v)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range arr {
+			if err := validate(spec, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %T", path, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", path, s)
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: expected an integer, got %v", path, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected a number, got %T", path, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", path, v)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %v", path, schema["type"])
+	}
+	return nil
+}
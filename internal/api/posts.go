@@ -0,0 +1,221 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/feed"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// postInput is the body of post creation and updates. New posts need a title and
+// content; updates leave out the fields they do not change.
+type postInput struct {
+	Title       *string `json:"title,omitempty"`
+	Content     *string `json:"content,omitempty"`
+	CategoryIDs []int   `json:"category_ids,omitempty"`
+}
+
+// listPosts serves GET /posts, filtered by the category (slug) and author
+// (username) query parameters.
+func listPosts(w http.ResponseWriter, r *http.Request) {
+	page, ok := readPage(r)
+	if !ok {
+		Error(w, http.StatusBadRequest, "Invalid page or per_page")
+		return
+	}
+
+	viewerID := auth.GetCurrentUserID(r)
+	opts := feed.Options{ViewerID: viewerID, Limit: page.PerPage, Offset: page.offset(), SkipComments: true}
+
+	if slug := r.URL.Query().Get("category"); slug != "" {
+		category, err := db.CategoryBySlug(slug)
+		if err == sql.ErrNoRows {
+			Error(w, http.StatusNotFound, "Category not found")
+			return
+		} else if err != nil {
+			internalError(w, err)
+			return
+		}
+		access, err := db.CategoryAccess(viewerID, category.CategoryID)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		if !access.View {
+			Error(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		opts.CategoryID = category.CategoryID
+	}
+	if username := r.URL.Query().Get("author"); username != "" {
+		authorID, err := db.UserIDByUsername(username)
+		if err == sql.ErrNoRows {
+			Error(w, http.StatusNotFound, "User not found")
+			return
+		} else if err != nil {
+			internalError(w, err)
+			return
+		}
+		opts.AuthorID = authorID
+	}
+
+	total, err := feed.CountPosts(opts)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	posts, err := feed.ListPosts(opts)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if posts == nil {
+		posts = []models.Post{}
+	}
+	writeList(w, posts, page, total)
+}
+
+// getPost serves GET /posts/{id}. The comments are listed separately.
+func getPost(w http.ResponseWriter, r *http.Request) {
+	post, ok := loadPost(w, r, routeID(r))
+	if !ok {
+		return
+	}
+	writeData(w, http.StatusOK, post)
+}
+
+// createPost serves POST /posts with the same checks as the post form.
+func createPost(w http.ResponseWriter, r *http.Request) {
+	var in postInput
+	if !decode(w, r, &in) {
+		return
+	}
+	if in.Title == nil || in.Content == nil || strings.TrimSpace(*in.Title) == "" || strings.TrimSpace(*in.Content) == "" {
+		Error(w, http.StatusBadRequest, "Title and content are required")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	for _, catID := range in.CategoryIDs {
+		access, err := db.CategoryAccess(userID, catID)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		if !access.View {
+			Error(w, http.StatusBadRequest, fmt.Sprintf("Invalid category ID: %d", catID))
+			return
+		}
+		if !access.Post {
+			Error(w, http.StatusForbidden, "You are not allowed to post in this category")
+			return
+		}
+	}
+
+	postID, err := db.CreatePost(userID, *in.Title, *in.Content, "", in.CategoryIDs)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	post, ok := loadPost(w, r, postID)
+	if !ok {
+		return
+	}
+	events.PublishPost(events.PostCreated, postID)
+	if err := db.NotifyMentions(userID, postID, nil, utils.Mentions(*in.Content)); err != nil {
+		log.Println(err)
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/posts/%d", Prefix, postID))
+	writeData(w, http.StatusCreated, post)
+}
+
+// updatePost serves PATCH /posts/{id}. Only the author may edit a post.
+func updatePost(w http.ResponseWriter, r *http.Request) {
+	post, ok := loadOwnPost(w, r)
+	if !ok {
+		return
+	}
+
+	var in postInput
+	if !decode(w, r, &in) {
+		return
+	}
+	if in.CategoryIDs != nil {
+		Error(w, http.StatusBadRequest, "Categories cannot be changed, ask a moderator to move the post")
+		return
+	}
+	title, content := post.Title, post.Content
+	if in.Title != nil {
+		title = *in.Title
+	}
+	if in.Content != nil {
+		content = *in.Content
+	}
+	if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+		Error(w, http.StatusBadRequest, "Title and content cannot be empty")
+		return
+	}
+
+	if err := db.UpdatePost(post.PostID, title, content); err != nil {
+		internalError(w, err)
+		return
+	}
+	events.PublishPost(events.PostUpdated, post.PostID)
+	if err := db.NotifyMentions(post.UserID, post.PostID, nil, utils.Mentions(content)); err != nil {
+		log.Println(err)
+	}
+	if post, ok = loadPost(w, r, post.PostID); ok {
+		writeData(w, http.StatusOK, post)
+	}
+}
+
+// deletePost serves DELETE /posts/{id}. Only the author may delete a post.
+func deletePost(w http.ResponseWriter, r *http.Request) {
+	post, ok := loadOwnPost(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeletePost(post.PostID); err != nil {
+		internalError(w, err)
+		return
+	}
+	events.PublishPost(events.PostDeleted, post.PostID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadPost loads a post the current user may see, answering 404 otherwise.
+func loadPost(w http.ResponseWriter, r *http.Request, postID int) (models.Post, bool) {
+	posts, err := feed.ListPosts(feed.Options{ViewerID: auth.GetCurrentUserID(r), PostID: postID, SkipComments: true})
+	if err != nil {
+		internalError(w, err)
+		return models.Post{}, false
+	}
+	if len(posts) == 0 {
+		Error(w, http.StatusNotFound, "Post not found")
+		return models.Post{}, false
+	}
+	return posts[0], true
+}
+
+// loadOwnPost loads the post of the route, answering 403 when the current user
+// did not write it.
+func loadOwnPost(w http.ResponseWriter, r *http.Request) (models.Post, bool) {
+	post, ok := loadPost(w, r, routeID(r))
+	if !ok {
+		return post, false
+	}
+	if post.UserID != auth.GetCurrentUserID(r) {
+		Error(w, http.StatusForbidden, "You can only change your own posts")
+		return post, false
+	}
+	return post, true
+}
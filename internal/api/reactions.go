@@ -0,0 +1,85 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/models"
+)
+
+// reaction is the response to POST /reactions.
+type reaction struct {
+	PostID    *int   `json:"post_id,omitempty"`
+	CommentID *int   `json:"comment_id,omitempty"`
+	Likes     int    `json:"likes"`
+	Dislikes  int    `json:"dislikes"`
+	Reaction  string `json:"reaction"` // like, dislike or empty when taken back
+}
+
+// react serves POST /reactions, which toggles a like or dislike of the current user
+// on a post or a comment like the buttons on the pages do. The user_id of the body
+// is ignored.
+func react(w http.ResponseWriter, r *http.Request) {
+	var in models.LikeRequest
+	if !decode(w, r, &in) {
+		return
+	}
+	if (in.PostID == nil) == (in.CommentID == nil) {
+		Error(w, http.StatusBadRequest, "Exactly one of post_id and comment_id is required")
+		return
+	}
+	if in.LikeType != "like" && in.LikeType != "dislike" {
+		Error(w, http.StatusBadRequest, "like_type must be like or dislike")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	postID := 0
+	if in.PostID != nil {
+		postID = *in.PostID
+	} else {
+		id, err := db.CommentPostID(*in.CommentID)
+		if err == sql.ErrNoRows {
+			Error(w, http.StatusNotFound, "Comment not found")
+			return
+		} else if err != nil {
+			internalError(w, err)
+			return
+		}
+		postID = id
+	}
+	access, err := db.PostAccess(userID, postID)
+	if err != nil && err != sql.ErrNoRows {
+		internalError(w, err)
+		return
+	}
+	if !access.View {
+		Error(w, http.StatusNotFound, "Content not found")
+		return
+	}
+
+	result, err := db.React(userID, in.PostID, in.CommentID, in.LikeType)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	commentID := 0
+	if in.CommentID != nil {
+		commentID = *in.CommentID
+	}
+	events.PublishReaction(postID, commentID, result.Likes, result.Dislikes)
+	if err := db.NotifyReaction(userID, in.PostID, in.CommentID, result.Current); err != nil {
+		log.Println(err)
+	}
+	writeData(w, http.StatusOK, reaction{
+		PostID:    in.PostID,
+		CommentID: in.CommentID,
+		Likes:     result.Likes,
+		Dislikes:  result.Dislikes,
+		Reaction:  result.Current,
+	})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+)
+
+// me serves GET /me, the account of the current user.
+func me(w http.ResponseWriter, r *http.Request) {
+	user, err := db.UserByID(auth.GetCurrentUserID(r))
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, user)
+}
+
+// maxUserMatches is how many users searchUsers returns.
+const maxUserMatches = 10
+
+// userMatch is a user found by searchUsers.
+type userMatch struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// searchUsers serves GET /users?prefix=, the users whose username starts with
+// prefix, for @mention autocomplete.
+func searchUsers(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimSpace(r.URL.Query().Get("prefix"))
+	if prefix == "" {
+		Error(w, http.StatusBadRequest, "The prefix parameter is required")
+		return
+	}
+	users, err := db.UsersByPrefix(prefix, maxUserMatches)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	matches := []userMatch{}
+	for _, user := range users {
+		matches = append(matches, userMatch{UserID: user.UserID, Username: user.Username})
+	}
+	writeData(w, http.StatusOK, matches)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"forum/internal/db"
+)
+
+const (
+	// attemptWindow is how long a failed login keeps counting against an account or IP.
+	attemptWindow = 15 * time.Minute
+
+	// accountFreeAttempts and ipFreeAttempts are the failures allowed before backoff kicks in.
+	accountFreeAttempts = 3
+	ipFreeAttempts      = 20
+
+	// lockoutThreshold is the number of failures that locks an account for lockoutDuration.
+	lockoutThreshold = 10
+	lockoutDuration  = 15 * time.Minute
+
+	maxBackoff = 15 * time.Minute
+)
+
+// attemptsMu serializes the writes to login_attempts, so that parallel logins wait
+// for each other instead of failing on a locked table.
+var attemptsMu sync.Mutex
+
+// AccountKey returns the key failed logins are counted under. Known users are keyed
+// by ID so email and username share a counter, unknown identifiers by their text so
+// they are throttled exactly like real accounts.
+func AccountKey(userID int, identifier string) string {
+	if userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "id:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// BeginLoginAttempt counts a login attempt against the account and IP before the
+// password is checked, and returns how long the caller has to wait when earlier
+// failures refuse it. Zero means the attempt may proceed. Refused attempts are not
+// counted. The attempt is stored before the earlier ones are counted, in one
+// transaction, so that parallel requests cannot all pass the check; a successful
+// login clears it again with ClearLoginFailures.
+func BeginLoginAttempt(accountKey, ip string) (time.Duration, error) {
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO login_attempts (account_key, ip_address, attempted_at) VALUES (?, ?, ?)`, accountKey, ip, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	attemptID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	accountWait, err := backoff(tx, attemptID, "account_key", accountKey, accountFreeAttempts, true)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := backoff(tx, attemptID, "ip_address", ip, ipFreeAttempts, false)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait > accountWait {
+		accountWait = ipWait
+	}
+	if accountWait > 0 {
+		return accountWait, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	return 0, nil
+}
+
+// backoff computes the remaining wait for the failures recorded under column =
+// value before the attempt with ID attemptID.
+func backoff(tx *sql.Tx, attemptID int64, column, value string, freeAttempts int, lockable bool) (time.Duration, error) {
+	since := time.Now().UTC().Add(-attemptWindow)
+
+	var failures int
+	query := `SELECT COUNT(*) FROM login_attempts WHERE ` + column + ` = ? AND attempted_at > ? AND attempt_id != ?`
+	if err := tx.QueryRow(query, value, since, attemptID).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to count login attempts: %w", err)
+	}
+	if failures < freeAttempts {
+		return 0, nil
+	}
+
+	var last time.Time
+	query = `SELECT attempted_at FROM login_attempts WHERE ` + column + ` = ? AND attempt_id != ? ORDER BY attempted_at DESC LIMIT 1`
+	if err := tx.QueryRow(query, value, attemptID).Scan(&last); err != nil {
+		return 0, fmt.Errorf("failed to read last login attempt: %w", err)
+	}
+
+	wait := backoffDelay(failures - freeAttempts)
+	if lockable && failures >= lockoutThreshold {
+		wait = lockoutDuration
+	}
+	return time.Until(last.Add(wait)), nil
+}
+
+// backoffDelay doubles the delay for every failure past the free attempts.
+func backoffDelay(excess int) time.Duration {
+	delay := time.Duration(math.Pow(2, float64(excess))) * time.Second
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// RecordLoginFailure keeps the attempt BeginLoginAttempt counted as a failure and
+// notifies the owner of an existing account when it becomes locked. Parallel
+// failures can pass the threshold together, so the owner is notified once per
+// window rather than at an exact count.
+func RecordLoginFailure(accountKey string, userID int) error {
+	if userID == 0 {
+		return nil
+	}
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+
+	since := time.Now().UTC().Add(-attemptWindow)
+	var failures int
+	err := db.DB.QueryRow(`SELECT COUNT(*) FROM login_attempts WHERE account_key = ? AND attempted_at > ?`, accountKey, since).Scan(&failures)
+	if err != nil {
+		return fmt.Errorf("failed to count login attempts: %w", err)
+	}
+	if failures >= lockoutThreshold {
+		notified, err := db.NotifyLockout(userID, since)
+		if err != nil {
+			return err
+		}
+		if notified {
+			log.Printf("Account %d locked after %d failed logins until %s", userID, failures, time.Now().Add(lockoutDuration).Format(time.RFC1123))
+		}
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failures of an account after a successful login.
+func ClearLoginFailures(accountKey string) error {
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+	_, err := db.DB.Exec(`DELETE FROM login_attempts WHERE account_key = ?`, accountKey)
+	return err
+}
+
+// CleanupLoginAttempts deletes attempts that no longer count towards any backoff.
+func CleanupLoginAttempts() error {
+	attemptsMu.Lock()
+	defer attemptsMu.Unlock()
+	_, err := db.DB.Exec(`DELETE FROM login_attempts WHERE attempted_at < ?`, time.Now().UTC().Add(-attemptWindow))
+	return err
+}
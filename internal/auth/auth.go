@@ -2,13 +2,20 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
 
 	"forum/internal/db"
 )
 
-// Add this in your auth handlers file (e.g., auth.go)
+// GetCurrentUserID returns the ID of the logged in user, or 0 for anonymous requests.
+// The user set by SessionMiddleware is used when present, the session cookie otherwise.
 func GetCurrentUserID(r *http.Request) int {
-	// Example implementation using session cookie
+	if id, ok := GetUserID(r); ok {
+		if userID, err := strconv.Atoi(id); err == nil {
+			return userID
+		}
+	}
+
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		return 0 // Not logged in
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/http"
+
+	"forum/internal/db"
+	"forum/internal/utils"
+)
+
+// Role is the role stored on a user. Each role includes everything the roles
+// below it may do.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// Permission names a privileged action that handlers check before acting.
+type Permission string
+
+const (
+	PermModeratePosts    Permission = "moderate_posts"
+	PermBanUsers         Permission = "ban_users"
+	PermManageUsers      Permission = "manage_users"
+	PermViewAuditLog     Permission = "view_audit_log"
+	PermManageCategories Permission = "manage_categories"
+	PermManageGroups     Permission = "manage_groups"
+)
+
+// permissionRole is the lowest role granted each permission.
+var permissionRole = map[Permission]Role{
+	PermModeratePosts:    RoleModerator,
+	PermBanUsers:         RoleModerator,
+	PermManageUsers:      RoleAdmin,
+	PermViewAuditLog:     RoleAdmin,
+	PermManageCategories: RoleAdmin,
+	PermManageGroups:     RoleAdmin,
+}
+
+// ParseRole validates a role name.
+func ParseRole(name string) (Role, bool) {
+	role := Role(name)
+	_, ok := roleRank[role]
+	return role, ok
+}
+
+// AtLeast reports whether r is the same as or above other.
+func (r Role) AtLeast(other Role) bool {
+	return roleRank[r] >= roleRank[other]
+}
+
+// Can reports whether the role is granted permission p.
+func (r Role) Can(p Permission) bool {
+	min, ok := permissionRole[p]
+	return ok && r.AtLeast(min)
+}
+
+// UserRole looks up the role of a user. Anonymous and unknown users get no role.
+func UserRole(userID int) Role {
+	if userID == 0 {
+		return ""
+	}
+	var role string
+	if err := db.DB.QueryRow(`SELECT role FROM users WHERE user_id = ?`, userID).Scan(&role); err != nil {
+		return ""
+	}
+	return Role(role)
+}
+
+// Can reports whether the user making the request has permission p.
+func Can(r *http.Request, p Permission) bool {
+	return UserRole(GetCurrentUserID(r)).Can(p)
+}
+
+// RequireRole only lets users with at least the given role through. It must run
+// after SessionMiddleware.
+func RequireRole(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := GetCurrentUserID(r)
+			if userID == 0 {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			if !UserRole(userID).AtLeast(role) {
+				utils.DisplayError(w, http.StatusForbidden, "You are not allowed to access this page")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
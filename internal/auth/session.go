@@ -3,10 +3,13 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"forum/internal/db"
+	"forum/internal/utils"
 )
 
 type contextKey string
@@ -29,23 +32,42 @@ func SessionMiddleware(next http.Handler) http.Handler {
 		err = db.DB.QueryRow(query, cookie.Value).Scan(&userID, &expiresAt)
 		if err == sql.ErrNoRows || time.Now().After(expiresAt) {
 			// Invalid or expired session, clear the cookie
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session_id",
-				Value:    "",
-				Expires:  time.Now().Add(-time.Hour),
-				Path:     "/",
-				HttpOnly: true,
-			})
+			clearSessionCookie(w)
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// Banned users lose all their sessions and only get to see why
+		if id, err := strconv.Atoi(userID); err == nil {
+			ban, err := db.ActiveBan(id)
+			if err != nil {
+				log.Printf("Ban lookup error: %v", err)
+			} else if ban != nil {
+				if _, err := db.DB.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+					log.Printf("Session delete error: %v", err)
+				}
+				clearSessionCookie(w)
+				utils.DisplayBanned(w, ban)
+				return
+			}
+		}
+
 		// Add userID to the request context
 		ctx := context.WithValue(r.Context(), userIDKey, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
+
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value(userIDKey)
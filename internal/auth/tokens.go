@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/db"
+	"forum/internal/models"
+)
+
+// TokenMiddleware authenticates requests carrying an `Authorization: Bearer` API
+// token, setting the same user as SessionMiddleware would for the token's owner.
+// Requests without the header pass through unchanged, so it can run after
+// SessionMiddleware. Read tokens are limited to GET and HEAD requests. Failures are
+// answered with displayError, so JSON routes can keep answering JSON.
+func TokenMiddleware(displayError func(w http.ResponseWriter, code int, message string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, token, found := strings.Cut(header, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				displayError(w, http.StatusUnauthorized, "Malformed Authorization header")
+				return
+			}
+
+			t, err := db.UseAPIToken(strings.TrimSpace(token))
+			if err != nil {
+				log.Printf("Token lookup error: %v", err)
+				displayError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if t == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				displayError(w, http.StatusUnauthorized, "Invalid or expired token")
+				return
+			}
+
+			ban, err := db.ActiveBan(t.UserID)
+			if err != nil {
+				log.Printf("Ban lookup error: %v", err)
+				displayError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if ban != nil {
+				displayError(w, http.StatusForbidden, "Your account is banned")
+				return
+			}
+
+			if t.Scope != models.ScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				displayError(w, http.StatusForbidden, "This token is read-only")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDKey, strconv.Itoa(t.UserID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
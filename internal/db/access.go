@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"forum/internal/models"
+)
+
+// viewableCategory holds for a category c the given user may see on its own:
+// public categories, every category for admins, and private categories a group of
+// the user is allowed to view. It takes the user ID twice.
+const viewableCategory = `(c.private = 0
+		OR EXISTS (SELECT 1 FROM users vu WHERE vu.user_id = ? AND vu.role = 'admin')
+		OR EXISTS (SELECT 1 FROM category_permissions cp JOIN group_members gm ON cp.group_id = gm.group_id
+			WHERE cp.category_id = c.category_id AND gm.user_id = ? AND cp.can_view = 1))`
+
+// VisibleCategoryIDs selects the IDs of the categories a user may see. A subcategory
+// is only visible when every category above it is, so private sections stay private
+// all the way down. Use it as `category_id IN (` + VisibleCategoryIDs + `)` with
+// VisibilityArgs(userID).
+const VisibleCategoryIDs = `WITH RECURSIVE visible(id) AS (
+		SELECT c.category_id FROM categories c WHERE c.parent_id IS NULL AND ` + viewableCategory + `
+		UNION
+		SELECT c.category_id FROM categories c JOIN visible v ON c.parent_id = v.id WHERE ` + viewableCategory + `
+	) SELECT id FROM visible`
+
+// PostVisible is a condition on posts aliased p that holds when the user may see
+// the post, that is when every category of the post is visible to them.
+// Uncategorized posts are visible to everyone. Use it with VisibilityArgs(userID).
+const PostVisible = `NOT EXISTS (SELECT 1 FROM post_categories vpc
+		WHERE vpc.post_id = p.post_id AND vpc.category_id NOT IN (` + VisibleCategoryIDs + `))`
+
+// VisibilityArgs returns the parameters VisibleCategoryIDs and PostVisible take
+// for a user, 0 for anonymous visitors.
+func VisibilityArgs(userID int) []interface{} {
+	return []interface{}{userID, userID, userID, userID}
+}
+
+// CategoryAccess returns what a user may do in a category. Anyone who can see a
+// public category may post and comment once logged in; private categories need a
+// group grant. Archived categories take no new posts. Admins may do everything.
+func CategoryAccess(userID, categoryID int) (models.Access, error) {
+	var access models.Access
+
+	var private, archived bool
+	err := DB.QueryRow(`SELECT private, archived FROM categories WHERE category_id = ?`, categoryID).Scan(&private, &archived)
+	if err == sql.ErrNoRows {
+		return access, nil
+	} else if err != nil {
+		return access, fmt.Errorf("failed to load category: %v", err)
+	}
+
+	args := append([]interface{}{categoryID}, VisibilityArgs(userID)...)
+	if err := DB.QueryRow(`SELECT ? IN (`+VisibleCategoryIDs+`)`, args...).Scan(&access.View); err != nil {
+		return access, fmt.Errorf("failed to check category visibility: %v", err)
+	}
+	if !access.View {
+		return access, nil
+	}
+
+	var admin bool
+	if err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE user_id = ? AND role = 'admin')`, userID).Scan(&admin); err != nil {
+		return access, fmt.Errorf("failed to load role: %v", err)
+	}
+	if admin {
+		return models.Access{View: true, Post: !archived, Comment: true, Moderate: true}, nil
+	}
+
+	var canPost, canComment, canModerate bool
+	err = DB.QueryRow(`
+		SELECT COALESCE(MAX(cp.can_post), 0), COALESCE(MAX(cp.can_comment), 0), COALESCE(MAX(cp.can_moderate), 0)
+		FROM category_permissions cp
+		JOIN group_members gm ON cp.group_id = gm.group_id
+		WHERE cp.category_id = ? AND gm.user_id = ?`, categoryID, userID).Scan(&canPost, &canComment, &canModerate)
+	if err != nil {
+		return access, fmt.Errorf("failed to load category permissions: %v", err)
+	}
+
+	loggedIn := userID != 0
+	access.Post = loggedIn && !archived && (!private || canPost)
+	access.Comment = loggedIn && (!private || canComment)
+	access.Moderate = loggedIn && canModerate
+	return access, nil
+}
+
+// PostAccess returns what a user may do with a post: seeing and commenting need
+// access to every category of the post, moderating to any of them. Post is always
+// false. It returns sql.ErrNoRows when the post does not exist or was removed.
+func PostAccess(userID, postID int) (models.Access, error) {
+	return postAccess(userID, postID, false)
+}
+
+// ModerationAccess is PostAccess for moderators, who also act on removed posts.
+func ModerationAccess(userID, postID int) (models.Access, error) {
+	return postAccess(userID, postID, true)
+}
+
+func postAccess(userID, postID int, includeRemoved bool) (models.Access, error) {
+	var access models.Access
+
+	var removed bool
+	err := DB.QueryRow(`SELECT removed FROM posts WHERE post_id = ?`, postID).Scan(&removed)
+	if err == sql.ErrNoRows || (removed && !includeRemoved) {
+		return access, sql.ErrNoRows
+	} else if err != nil {
+		return access, fmt.Errorf("failed to load post: %v", err)
+	}
+
+	categoryIDs, err := PostCategoryIDs(postID)
+	if err != nil {
+		return access, err
+	}
+
+	access.View = true
+	access.Comment = userID != 0
+	for _, id := range categoryIDs {
+		c, err := CategoryAccess(userID, id)
+		if err != nil {
+			return access, err
+		}
+		access.View = access.View && c.View
+		access.Comment = access.Comment && c.Comment
+		access.Moderate = access.Moderate || c.Moderate
+	}
+	if !access.View {
+		return models.Access{}, nil
+	}
+	return access, nil
+}
+
+// PostCategoryIDs returns the IDs of the categories a post is filed under.
+func PostCategoryIDs(postID int) ([]int, error) {
+	rows, err := DB.Query(`SELECT category_id FROM post_categories WHERE post_id = ? ORDER BY category_id`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load post categories: %v", err)
+	}
+	defer rows.Close()
+
+	var categoryIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan post category: %v", err)
+		}
+		categoryIDs = append(categoryIDs, id)
+	}
+	return categoryIDs, rows.Err()
+}
+
+// CommentPostID returns the post a comment belongs to.
+func CommentPostID(commentID int) (int, error) {
+	var postID int
+	err := DB.QueryRow(`SELECT post_id FROM comments WHERE comment_id = ? AND removed = 0`, commentID).Scan(&postID)
+	return postID, err
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx so audit entries can be written
+// in the same transaction as the change they describe.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// RecordAudit appends an entry to the audit log.
+func RecordAudit(ex Execer, entry models.AuditEntry) error {
+	_, err := ex.Exec(`
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, before_state, after_state, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, entry.Before, entry.After, entry.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %v", err)
+	}
+	return nil
+}
+
+// Snapshot encodes v as JSON for the before and after columns of the audit log.
+func Snapshot(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	}
+	return string(b)
+}
+
+// AuditFilter narrows down the entries returned by ListAudit. Zero values match everything.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   int
+	From       time.Time
+	To         time.Time
+}
+
+// where builds the WHERE clause and its parameters for the filter.
+func (f AuditFilter) where() (string, []interface{}) {
+	conditions := []string{}
+	params := []interface{}{}
+
+	if f.Actor != "" {
+		conditions = append(conditions, "u.username = ?")
+		params = append(params, f.Actor)
+	}
+	if f.Action != "" {
+		conditions = append(conditions, "a.action = ?")
+		params = append(params, f.Action)
+	}
+	if f.TargetType != "" {
+		conditions = append(conditions, "a.target_type = ?")
+		params = append(params, f.TargetType)
+	}
+	if f.TargetID != 0 {
+		conditions = append(conditions, "a.target_id = ?")
+		params = append(params, f.TargetID)
+	}
+	if !f.From.IsZero() {
+		conditions = append(conditions, "a.created_at >= ?")
+		params = append(params, f.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "a.created_at < ?")
+		params = append(params, f.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// ListAudit returns the entries matching filter, newest first. A limit of 0 returns all of them.
+func ListAudit(filter AuditFilter, limit, offset int) ([]models.AuditEntry, error) {
+	where, params := filter.where()
+	query := `
+	SELECT a.audit_id, a.actor_id, COALESCE(u.username, ''), a.action, a.target_type, a.target_id,
+		COALESCE(a.before_state, ''), COALESCE(a.after_state, ''), COALESCE(a.reason, ''), a.created_at
+	FROM audit_log a
+	LEFT JOIN users u ON a.actor_id = u.user_id` + where + `
+	ORDER BY a.audit_id DESC`
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		params = append(params, limit, offset)
+	}
+
+	rows, err := DB.Query(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.AuditID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID, &e.Before, &e.After, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// AuditActions returns the distinct actions in the audit log for filtering.
+func AuditActions() ([]string, error) {
+	rows, err := DB.Query(`SELECT DISTINCT action FROM audit_log ORDER BY action`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit actions: %v", err)
+	}
+	defer rows.Close()
+
+	var actions []string
+	for rows.Next() {
+		var action string
+		if err := rows.Scan(&action); err != nil {
+			return nil, fmt.Errorf("failed to scan audit action: %v", err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"forum/internal/models"
+)
+
+// activeBanCondition matches bans that are neither lifted nor expired.
+const activeBanCondition = `b.lifted_at IS NULL AND (b.expires_at IS NULL OR b.expires_at > ?)`
+
+// ActiveBan returns the ban currently in force for a user, or nil if there is none.
+func ActiveBan(userID int) (*models.Ban, error) {
+	query := `
+	SELECT b.ban_id, b.user_id, b.reason, b.expires_at, b.created_at
+	FROM bans b
+	WHERE b.user_id = ? AND ` + activeBanCondition + `
+	ORDER BY b.expires_at IS NULL DESC, b.expires_at DESC
+	LIMIT 1`
+
+	var ban models.Ban
+	var expiresAt sql.NullTime
+	err := DB.QueryRow(query, userID, time.Now().UTC()).Scan(&ban.BanID, &ban.UserID, &ban.Reason, &expiresAt, &ban.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up ban: %v", err)
+	}
+	if expiresAt.Valid {
+		ban.ExpiresAt = &expiresAt.Time
+	}
+	return &ban, nil
+}
+
+// ActiveBans lists every ban currently in force, newest first.
+func ActiveBans() ([]models.Ban, error) {
+	query := `
+	SELECT b.ban_id, b.user_id, u.username, COALESCE(m.username, ''), b.reason, b.expires_at, b.created_at
+	FROM bans b
+	JOIN users u ON b.user_id = u.user_id
+	LEFT JOIN users m ON b.banned_by = m.user_id
+	WHERE ` + activeBanCondition + `
+	ORDER BY b.created_at DESC`
+
+	rows, err := DB.Query(query, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bans: %v", err)
+	}
+	defer rows.Close()
+
+	var bans []models.Ban
+	for rows.Next() {
+		var ban models.Ban
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&ban.BanID, &ban.UserID, &ban.Username, &ban.BannedBy, &ban.Reason, &expiresAt, &ban.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ban: %v", err)
+		}
+		if expiresAt.Valid {
+			ban.ExpiresAt = &expiresAt.Time
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+// BanUser lifts any ban in force for the user, adds the new one and revokes the
+// user's sessions, all within tx. A nil expiresAt bans the user permanently.
+func BanUser(tx *sql.Tx, userID, bannedBy int, reason string, expiresAt *time.Time) error {
+	now := time.Now().UTC()
+	if err := LiftBans(tx, userID, bannedBy); err != nil {
+		return err
+	}
+
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+	_, err := tx.Exec(`INSERT INTO bans (user_id, banned_by, reason, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, bannedBy, reason, expires, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert ban: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return nil
+}
+
+// LiftBans ends every ban in force for the user.
+func LiftBans(tx *sql.Tx, userID, liftedBy int) error {
+	_, err := tx.Exec(`UPDATE bans SET lifted_at = ?, lifted_by = ? WHERE user_id = ? AND lifted_at IS NULL`,
+		time.Now().UTC(), liftedBy, userID)
+	if err != nil {
+		return fmt.Errorf("failed to lift bans: %v", err)
+	}
+	return nil
+}
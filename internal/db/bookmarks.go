@@ -0,0 +1,54 @@
+package db
+
+import "fmt"
+
+// ToggleBookmark saves a post for a user, or unsaves it when it was saved, and
+// reports whether it is saved now. Inserting first leaves concurrent toggles
+// nothing to conflict on: whichever finds the bookmark there removes it.
+func ToggleBookmark(userID, postID int) (bool, error) {
+	res, err := DB.Exec(`INSERT INTO bookmarks (user_id, post_id) VALUES (?, ?) ON CONFLICT (user_id, post_id) DO NOTHING`, userID, postID)
+	if err != nil {
+		return false, fmt.Errorf("failed to save bookmark: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("failed to save bookmark: %v", err)
+	} else if n > 0 {
+		return true, nil
+	}
+	if _, err := DB.Exec(`DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?`, userID, postID); err != nil {
+		return false, fmt.Errorf("failed to remove bookmark: %v", err)
+	}
+	return false, nil
+}
+
+// SaveBookmark saves a post for a user into a folder, moving it there when it was
+// already saved. The folder "" is the default one.
+func SaveBookmark(userID, postID int, folder string) error {
+	_, err := DB.Exec(`
+		INSERT INTO bookmarks (user_id, post_id, folder) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET folder = excluded.folder`, userID, postID, folder)
+	if err != nil {
+		return fmt.Errorf("failed to save bookmark: %v", err)
+	}
+	return nil
+}
+
+// BookmarkFolders returns the named folders a user saved posts into, in
+// alphabetical order.
+func BookmarkFolders(userID int) ([]string, error) {
+	rows, err := DB.Query(`SELECT DISTINCT folder FROM bookmarks WHERE user_id = ? AND folder != '' ORDER BY folder COLLATE NOCASE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmark folders: %v", err)
+	}
+	defer rows.Close()
+
+	var folders []string
+	for rows.Next() {
+		var folder string
+		if err := rows.Scan(&folder); err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark folder: %v", err)
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
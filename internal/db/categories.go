@@ -0,0 +1,189 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"forum/internal/models"
+)
+
+// Queryer is satisfied by both *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Slugify turns a category name into the lowercase, dash separated form used in URLs.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return "category"
+	}
+	return slug
+}
+
+// SlugTaken reports whether a category other than exceptID already uses slug.
+func SlugTaken(q Queryer, slug string, exceptID int) (bool, error) {
+	var taken bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE slug = ? AND category_id != ?)`, slug, exceptID).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check slug: %v", err)
+	}
+	return taken, nil
+}
+
+// UniqueSlug returns the slug for name, adding a numeric suffix when another
+// category already uses it.
+func UniqueSlug(q Queryer, name string, exceptID int) (string, error) {
+	base := Slugify(name)
+	slug := base
+	for n := 2; ; n++ {
+		taken, err := SlugTaken(q, slug, exceptID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// backfillCategorySlugs gives a slug to categories created before slugs existed.
+func backfillCategorySlugs() error {
+	rows, err := DB.Query(`SELECT category_id, name FROM categories WHERE slug IS NULL OR slug = ''`)
+	if err != nil {
+		return fmt.Errorf("failed to read categories: %v", err)
+	}
+	type category struct {
+		id   int
+		name string
+	}
+	var missing []category
+	for rows.Next() {
+		var c category
+		if err := rows.Scan(&c.id, &c.name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan category: %v", err)
+		}
+		missing = append(missing, c)
+	}
+	rows.Close()
+
+	for _, c := range missing {
+		slug, err := UniqueSlug(DB, c.name, c.id)
+		if err != nil {
+			return err
+		}
+		if _, err := DB.Exec(`UPDATE categories SET slug = ? WHERE category_id = ?`, slug, c.id); err != nil {
+			return fmt.Errorf("failed to set slug of category %d: %v", c.id, err)
+		}
+	}
+	return nil
+}
+
+// SubcategoryIDs selects the ID bound to its single parameter together with the
+// IDs of all categories nested below it. Use it as `category_id IN (` + SubcategoryIDs + `)`.
+const SubcategoryIDs = `WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION
+		SELECT c.category_id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	) SELECT id FROM subtree`
+
+// IsSubcategory reports whether categoryID is ancestorID or nested below it.
+func IsSubcategory(q Queryer, categoryID, ancestorID int) (bool, error) {
+	var nested bool
+	err := q.QueryRow(`SELECT ? IN (`+SubcategoryIDs+`)`, categoryID, ancestorID).Scan(&nested)
+	if err != nil {
+		return false, fmt.Errorf("failed to walk category tree: %v", err)
+	}
+	return nested, nil
+}
+
+// categoryColumns are the columns scanned by scanCategory.
+const categoryColumns = `c.category_id, COALESCE(c.parent_id, 0), c.name, COALESCE(c.slug, ''), COALESCE(c.description, ''), c.sort_order, c.archived, c.private`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategory(s scanner) (models.Categories, error) {
+	var c models.Categories
+	err := s.Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Slug, &c.Description, &c.SortOrder, &c.Archived, &c.Private)
+	return c, err
+}
+
+// CategoryBySlug looks up a category by slug, or by name for links made before
+// slugs existed. It returns sql.ErrNoRows when there is no such category.
+func CategoryBySlug(slug string) (models.Categories, error) {
+	row := DB.QueryRow(`SELECT `+categoryColumns+` FROM categories c WHERE c.slug = ? OR c.name = ? ORDER BY c.slug = ? DESC LIMIT 1`, slug, slug, slug)
+	return scanCategory(row)
+}
+
+// CategoryByID looks up a category by ID. It returns sql.ErrNoRows when there is
+// no such category.
+func CategoryByID(id int) (models.Categories, error) {
+	return scanCategory(DB.QueryRow(`SELECT `+categoryColumns+` FROM categories c WHERE c.category_id = ?`, id))
+}
+
+// ChildCategories returns the direct subcategories of a category in display order,
+// leaving out archived ones and those the user may not see.
+func ChildCategories(parentID, userID int) ([]models.Categories, error) {
+	args := append([]interface{}{parentID}, VisibilityArgs(userID)...)
+	rows, err := DB.Query(`SELECT `+categoryColumns+` FROM categories c
+		WHERE c.parent_id = ? AND c.archived = 0 AND c.category_id IN (`+VisibleCategoryIDs+`)
+		ORDER BY c.sort_order, c.name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subcategories: %v", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Categories
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subcategory: %v", err)
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// CategoryActivity counts the posts in a category and its subcategories that the
+// user may see and returns when the latest of them was posted or commented on. The
+// time is zero when there are no such posts.
+func CategoryActivity(categoryID, userID int) (int, time.Time, error) {
+	query := `
+	SELECT COUNT(*), CAST(strftime('%s', MAX(latest)) AS INTEGER)
+	FROM (
+		SELECT MAX(p.created_at, COALESCE((SELECT MAX(cm.created_at) FROM comments cm WHERE cm.post_id = p.post_id AND cm.removed = 0), p.created_at)) AS latest
+		FROM posts p
+		WHERE p.removed = 0
+		AND p.post_id IN (SELECT post_id FROM post_categories WHERE category_id IN (` + SubcategoryIDs + `))
+		AND ` + PostVisible + `
+	)`
+
+	var count int
+	var latest sql.NullInt64
+	args := append([]interface{}{categoryID}, VisibilityArgs(userID)...)
+	if err := DB.QueryRow(query, args...).Scan(&count, &latest); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to read category activity: %v", err)
+	}
+	if !latest.Valid {
+		return count, time.Time{}, nil
+	}
+	return count, time.Unix(latest.Int64, 0), nil
+}
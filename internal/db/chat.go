@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+
+	"forum/internal/models"
+)
+
+// SaveChatMessage stores a chat message and returns it as it was saved.
+func SaveChatMessage(categoryID, userID int, content string) (models.ChatMessage, error) {
+	var m models.ChatMessage
+	result, err := DB.Exec(`INSERT INTO chat_messages (category_id, user_id, content) VALUES (?, ?, ?)`, categoryID, userID, content)
+	if err != nil {
+		return m, fmt.Errorf("failed to save chat message: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return m, fmt.Errorf("failed to retrieve chat message ID: %v", err)
+	}
+	messages, err := chatMessages(`m.message_id = ?`, id)
+	if err != nil {
+		return m, err
+	}
+	if len(messages) == 0 {
+		return m, fmt.Errorf("chat message %d not found after saving", id)
+	}
+	return messages[0], nil
+}
+
+// ChatHistory returns the latest messages of a category's chat room, oldest first.
+func ChatHistory(categoryID, limit int) ([]models.ChatMessage, error) {
+	return chatMessages(`m.message_id IN (
+		SELECT message_id FROM chat_messages WHERE category_id = ? ORDER BY message_id DESC LIMIT ?)`, categoryID, limit)
+}
+
+func chatMessages(condition string, args ...interface{}) ([]models.ChatMessage, error) {
+	rows, err := DB.Query(`
+		SELECT m.message_id, m.category_id, m.user_id, u.username, m.content, m.created_at
+		FROM chat_messages m
+		JOIN users u ON u.user_id = m.user_id
+		WHERE `+condition+`
+		ORDER BY m.message_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []models.ChatMessage
+	for rows.Next() {
+		var m models.ChatMessage
+		if err := rows.Scan(&m.MessageID, &m.CategoryID, &m.UserID, &m.Username, &m.Content, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read chat message: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // Import SQLite3 driver
@@ -13,10 +14,18 @@ import (
 
 var DB *sql.DB // Global variable to hold the database connection
 
+// busyTimeout is how long, in milliseconds, a write waits for another one to finish
+// before failing with a lock error.
+const busyTimeout = 5000
+
 // Init initializes the database and returns any error encountered.
 func Init(dbPath string) error {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	DB, err = sql.Open("sqlite3", fmt.Sprintf("%s%s_busy_timeout=%d", dbPath, separator, busyTimeout))
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %v", err)
 	}
@@ -25,6 +34,10 @@ func Init(dbPath string) error {
 		return fmt.Errorf("failed to create tables: %v", err)
 	}
 
+	if err = migrate(); err != nil {
+		return fmt.Errorf("failed to migrate tables: %v", err)
+	}
+
 	if err = createCategories(); err != nil {
 		return fmt.Errorf("failed to create categories: %v", err)
 	}
@@ -53,8 +66,17 @@ func createTables() error {
 	return nil
 }
 
-// createCategories inserts predefined categories, returns error on failure.
+// createCategories inserts the predefined categories into a new database, returns
+// error on failure. Once any category exists they are managed from the admin pages.
 func createCategories() error {
+	var count int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM categories`).Scan(&count); err != nil {
+		return fmt.Errorf("error counting categories: '%v'", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
 	categories := []struct {
 		Name, Description string
 	}{
@@ -66,8 +88,8 @@ func createCategories() error {
 		{"Travel", "Exploring the world, sharing travel experiences"},
 	}
 
-	for _, c := range categories {
-		_, err := DB.Exec(`INSERT OR IGNORE INTO categories (name, description) VALUES (?, ?)`, c.Name, c.Description)
+	for i, c := range categories {
+		_, err := DB.Exec(`INSERT OR IGNORE INTO categories (name, slug, description, sort_order) VALUES (?, ?, ?, ?)`, c.Name, Slugify(c.Name), c.Description, i+1)
 		if err != nil {
 			return fmt.Errorf("error inserting category '%s': '%v'", c.Name, err)
 		}
@@ -83,30 +105,37 @@ func CleanupExpiredSessions() error {
 	return err
 }
 
-// ScheduleSessionCleanup starts a ticker to periodically clean up sessions.
-func ScheduleSessionCleanup(interval time.Duration, cleanupFunc func() error) {
+// Schedule runs a background job, such as a cleanup, every interval and logs its
+// failures. It never returns.
+func Schedule(interval time.Duration, job func() error) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if err := cleanupFunc(); err != nil {
-			log.Printf("error: session cleanup failed: %v", err)
+		if err := job(); err != nil {
+			log.Printf("error: scheduled job failed: %v", err)
 		}
 	}
 }
 
-func GetUser(id int) ([]string, error) {
-	var name string
-	var img string
-	var bio string
-	var output []string
-
-	qry := `
-	SELECT username, COALESCE(bio, "") AS bio, COALESCE(profile_picture, "") AS profile_picture FROM users WHERE user_id = ?
-	`
-	
-	err := DB.QueryRow(qry, id).Scan(&name, &bio, &img)
-	output = append(output, name, bio, img)
+// PromoteFirstAdmin gives the admin role to the user with the given username or
+// email. It refuses to run once an admin exists; later admins are appointed from
+// the admin pages.
+func PromoteFirstAdmin(identifier string) error {
+	var admins int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM users WHERE role = 'admin'`).Scan(&admins); err != nil {
+		return fmt.Errorf("failed to count admins: %v", err)
+	}
+	if admins > 0 {
+		return fmt.Errorf("an admin already exists, use the admin pages to change roles")
+	}
 
-	return output, err
+	result, err := DB.Exec(`UPDATE users SET role = 'admin', updated_at = CURRENT_TIMESTAMP WHERE username = ? OR email = ?`, identifier, identifier)
+	if err != nil {
+		return fmt.Errorf("failed to promote user: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no user found with username or email %q", identifier)
+	}
+	return nil
 }
@@ -68,6 +68,25 @@ func TestInit(t *testing.T) {
 	}
 }
 
+func TestAuditLogAppendOnly(t *testing.T) {
+	setupTestDB(t)
+	defer teardownTestDB()
+
+	if err := Init(testDBPath); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := DB.Exec(`INSERT INTO audit_log (actor_id, action, target_type, target_id) VALUES (1, 'post.lock', 'post', 1)`); err != nil {
+		t.Fatalf("failed to insert audit entry: %v", err)
+	}
+	if _, err := DB.Exec(`UPDATE audit_log SET reason = 'tampered'`); err == nil {
+		t.Error("expected updating the audit log to fail")
+	}
+	if _, err := DB.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("expected deleting from the audit log to fail")
+	}
+}
+
 func TestCreateTables(t *testing.T) {
 	setupTestDB(t)
 	defer teardownTestDB()
@@ -139,14 +158,14 @@ func TestCleanupExpiredSessions(t *testing.T) {
 	}
 }
 
-func TestScheduleSessionCleanup(t *testing.T) {
+func TestSchedule(t *testing.T) {
 	cleanupTriggered := false
 	mockCleanup := func() error {
 		cleanupTriggered = true
 		return nil
 	}
 
-	go ScheduleSessionCleanup(10*time.Millisecond, mockCleanup)
+	go Schedule(10*time.Millisecond, mockCleanup)
 	time.Sleep(15 * time.Millisecond)
 	if !cleanupTriggered {
 		t.Error("expected cleanup to be triggered but it was not")
@@ -161,3 +180,18 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Technology":      "technology",
+		"  Go & Rust  ":   "go-rust",
+		"Café Talk!":      "café-talk",
+		"--":              "category",
+		"Movies, TV 2024": "movies-tv-2024",
+	}
+	for name, want := range tests {
+		if got := Slugify(name); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
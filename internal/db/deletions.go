@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ScheduleAccountDeletion schedules a user's account to be deleted at the given
+// time and signs them out everywhere. Signing back in before then lets them
+// cancel it.
+func ScheduleAccountDeletion(userID int, at time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO account_deletions (user_id, delete_at) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET delete_at = excluded.delete_at`, userID, at.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to schedule account deletion: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to end sessions: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to schedule account deletion: %v", err)
+	}
+	return nil
+}
+
+// CancelAccountDeletion keeps a user's account that was scheduled for deletion.
+func CancelAccountDeletion(userID int) error {
+	if _, err := DB.Exec(`DELETE FROM account_deletions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to cancel account deletion: %v", err)
+	}
+	return nil
+}
+
+// AccountDeletion returns when a user's account is scheduled to be deleted, or the
+// zero time when it is not.
+func AccountDeletion(userID int) (time.Time, error) {
+	var at time.Time
+	err := DB.QueryRow(`SELECT delete_at FROM account_deletions WHERE user_id = ?`, userID).Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch account deletion: %v", err)
+	}
+	return at, nil
+}
+
+// DueAccountDeletions returns the users whose accounts are due to be deleted at now.
+func DueAccountDeletions(now time.Time) ([]int, error) {
+	rows, err := DB.Query(`SELECT user_id FROM account_deletions WHERE delete_at <= ?`, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account deletions: %v", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan account deletion: %v", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// DeletedUsername is the name a deleted account's posts, comments and messages
+// are shown under.
+func DeletedUsername(userID int) string {
+	return fmt.Sprintf("[deleted-%d]", userID)
+}
+
+// personalData lists the rows deleting an account removes, each a table and the
+// condition on the user's ID.
+var personalData = []struct{ table, condition string }{
+	{"sessions", "user_id = ?"},
+	{"api_tokens", "user_id = ?"},
+	{"likes", "user_id = ?"},
+	{"bookmarks", "user_id = ?"},
+	{"post_reads", "user_id = ?"},
+	{"read_marks", "user_id = ?"},
+	{"notifications", "user_id = ?1 OR actor_id = ?1"},
+	{"category_follows", "user_id = ?"},
+	{"user_follows", "follower_id = ?1 OR followed_id = ?1"},
+	{"email_digests", "user_id = ?"},
+	{"email_changes", "user_id = ?"},
+	{"group_members", "user_id = ?"},
+	{"user_blocks", "blocker_id = ?1 OR blocked_id = ?1"},
+	{"conversation_members", "user_id = ?"},
+	{"account_deletions", "user_id = ?"},
+	{"login_attempts", "account_key = 'user:' || ?"},
+}
+
+// AnonymizeUser deletes a user's account. Their posts, comments and messages stay
+// so that discussions keep making sense, but are shown under DeletedUsername; the
+// rest of their personal data, including their reactions, is deleted. It returns
+// the profile picture the account had, for the caller to delete.
+func AnonymizeUser(userID int) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var picture string
+	if err := tx.QueryRow(`SELECT COALESCE(profile_picture, '') FROM users WHERE user_id = ?`, userID).Scan(&picture); err != nil {
+		return "", fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	// The password cannot match any bcrypt hash and the email cannot receive mail,
+	// so the account cannot be signed in to again
+	_, err = tx.Exec(`
+		UPDATE users SET username = ?, email = ?, password = '', auth_type = 'deleted', provider_id = NULL,
+			bio = NULL, profile_picture = NULL, role = 'user', updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ?`,
+		DeletedUsername(userID), fmt.Sprintf("deleted-%d@invalid", userID), userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to anonymize user: %v", err)
+	}
+	for _, d := range personalData {
+		if _, err := tx.Exec(`DELETE FROM `+d.table+` WHERE `+d.condition, userID); err != nil {
+			return "", fmt.Errorf("failed to delete %s: %v", d.table, err)
+		}
+	}
+	// Reports stay for the moderators, under the anonymized reporter and without
+	// the reporter's own words
+	if _, err := tx.Exec(`UPDATE reports SET details = NULL WHERE reporter_id = ?`, userID); err != nil {
+		return "", fmt.Errorf("failed to anonymize reports: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to anonymize user: %v", err)
+	}
+	return picture, nil
+}
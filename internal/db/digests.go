@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"forum/internal/models"
+)
+
+// DigestFrequency returns how often a user is emailed, models.DigestOff when
+// they never chose.
+func DigestFrequency(userID int) (string, error) {
+	var frequency string
+	err := DB.QueryRow(`SELECT frequency FROM email_digests WHERE user_id = ?`, userID).Scan(&frequency)
+	if err == sql.ErrNoRows {
+		return models.DigestOff, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load digest frequency: %v", err)
+	}
+	return frequency, nil
+}
+
+// SetDigestFrequency changes how often a user is emailed. The first digest after
+// subscribing covers what happens from then on.
+func SetDigestFrequency(userID int, frequency string) error {
+	_, err := DB.Exec(`
+		INSERT INTO email_digests (user_id, frequency, sent_at, last_notification_id)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(notification_id), 0) FROM notifications WHERE user_id = ?))
+		ON CONFLICT(user_id) DO UPDATE SET frequency = excluded.frequency`,
+		userID, frequency, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to save digest frequency: %v", err)
+	}
+	return nil
+}
+
+// DigestSubscribers returns the users who get digests, whether or not one is due.
+// Users banned at now, and those who never confirmed their email address, are
+// left out.
+func DigestSubscribers(now time.Time) ([]models.DigestSubscriber, error) {
+	rows, err := DB.Query(`
+		SELECT d.user_id, u.username, u.email, d.frequency, d.sent_at, d.last_notification_id
+		FROM email_digests d
+		JOIN users u ON u.user_id = d.user_id
+		WHERE d.frequency != 'off' AND u.email_verified = 1
+			AND NOT EXISTS (SELECT 1 FROM bans b WHERE b.user_id = u.user_id AND `+activeBanCondition+`)
+		ORDER BY d.user_id`, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load digest subscribers: %v", err)
+	}
+	defer rows.Close()
+
+	var subscribers []models.DigestSubscriber
+	for rows.Next() {
+		var s models.DigestSubscriber
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Email, &s.Frequency, &s.SentAt, &s.LastNotificationID); err != nil {
+			return nil, fmt.Errorf("failed to read digest subscriber: %v", err)
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+// EmailVerified reports whether a user has confirmed their email address, by a
+// link sent to it or by signing in with GitHub or Google.
+func EmailVerified(userID int) (bool, error) {
+	var verified bool
+	if err := DB.QueryRow(`SELECT email_verified FROM users WHERE user_id = ?`, userID).Scan(&verified); err != nil {
+		return false, fmt.Errorf("failed to check email verification: %v", err)
+	}
+	return verified, nil
+}
+
+// MarkDigestSent records that a user's digest was sent at sentAt, covering their
+// notifications up to lastNotificationID.
+func MarkDigestSent(userID int, sentAt time.Time, lastNotificationID int) error {
+	_, err := DB.Exec(`UPDATE email_digests SET sent_at = ?, last_notification_id = ? WHERE user_id = ?`,
+		sentAt.UTC(), lastNotificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark digest sent: %v", err)
+	}
+	return nil
+}
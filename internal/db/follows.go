@@ -0,0 +1,83 @@
+package db
+
+import "fmt"
+
+// FollowedCategoryIDs selects the IDs of the categories followed by the user
+// bound to its single parameter, together with the IDs of all categories nested
+// below them. Use it as `category_id IN (` + FollowedCategoryIDs + `)`.
+const FollowedCategoryIDs = `WITH RECURSIVE followed(id) AS (
+		SELECT category_id FROM category_follows WHERE user_id = ?
+		UNION
+		SELECT c.category_id FROM categories c JOIN followed f ON c.parent_id = f.id
+	) SELECT id FROM followed`
+
+// FollowCategory makes a user follow a category. Following it again is a no-op.
+func FollowCategory(userID, categoryID int) error {
+	_, err := DB.Exec(`INSERT OR IGNORE INTO category_follows (user_id, category_id) VALUES (?, ?)`, userID, categoryID)
+	if err != nil {
+		return fmt.Errorf("failed to follow category: %v", err)
+	}
+	return nil
+}
+
+// UnfollowCategory stops a user following a category.
+func UnfollowCategory(userID, categoryID int) error {
+	_, err := DB.Exec(`DELETE FROM category_follows WHERE user_id = ? AND category_id = ?`, userID, categoryID)
+	if err != nil {
+		return fmt.Errorf("failed to unfollow category: %v", err)
+	}
+	return nil
+}
+
+// FollowsCategory reports whether a user follows a category.
+func FollowsCategory(userID, categoryID int) (bool, error) {
+	var follows bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM category_follows WHERE user_id = ? AND category_id = ?)`, userID, categoryID).Scan(&follows)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow: %v", err)
+	}
+	return follows, nil
+}
+
+// FollowedUserIDs selects the IDs of the users followed by the user bound to its
+// single parameter. Use it as `user_id IN (` + FollowedUserIDs + `)`.
+const FollowedUserIDs = `SELECT followed_id FROM user_follows WHERE follower_id = ?`
+
+// FollowUser makes a user follow another. Following them again is a no-op.
+func FollowUser(followerID, followedID int) error {
+	_, err := DB.Exec(`INSERT OR IGNORE INTO user_follows (follower_id, followed_id) VALUES (?, ?)`, followerID, followedID)
+	if err != nil {
+		return fmt.Errorf("failed to follow user: %v", err)
+	}
+	return nil
+}
+
+// UnfollowUser stops a user following another.
+func UnfollowUser(followerID, followedID int) error {
+	_, err := DB.Exec(`DELETE FROM user_follows WHERE follower_id = ? AND followed_id = ?`, followerID, followedID)
+	if err != nil {
+		return fmt.Errorf("failed to unfollow user: %v", err)
+	}
+	return nil
+}
+
+// FollowsUser reports whether a user follows another.
+func FollowsUser(followerID, followedID int) (bool, error) {
+	var follows bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_follows WHERE follower_id = ? AND followed_id = ?)`, followerID, followedID).Scan(&follows)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow: %v", err)
+	}
+	return follows, nil
+}
+
+// FollowCounts returns how many users follow a user and how many users they follow.
+func FollowCounts(userID int) (followers, following int, err error) {
+	err = DB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM user_follows WHERE followed_id = ?),
+		(SELECT COUNT(*) FROM user_follows WHERE follower_id = ?)`, userID, userID).Scan(&followers, &following)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count follows: %v", err)
+	}
+	return followers, following, nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+
+	"forum/internal/models"
+)
+
+// Groups lists every group with the usernames of its members, by name.
+func Groups() ([]models.Group, error) {
+	rows, err := DB.Query(`SELECT group_id, name, COALESCE(description, '') FROM groups ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %v", err)
+	}
+	var groups []models.Group
+	for rows.Next() {
+		var g models.Group
+		if err := rows.Scan(&g.GroupID, &g.Name, &g.Description); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan group: %v", err)
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+
+	for i := range groups {
+		members, err := DB.Query(`
+			SELECT u.username FROM group_members gm JOIN users u ON gm.user_id = u.user_id
+			WHERE gm.group_id = ? ORDER BY u.username`, groups[i].GroupID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query group members: %v", err)
+		}
+		for members.Next() {
+			var username string
+			if err := members.Scan(&username); err != nil {
+				members.Close()
+				return nil, fmt.Errorf("failed to scan group member: %v", err)
+			}
+			groups[i].Members = append(groups[i].Members, username)
+		}
+		members.Close()
+	}
+	return groups, nil
+}
+
+// CategoryGrants returns the group permissions of every category, keyed by category ID.
+func CategoryGrants() (map[int][]models.CategoryGrant, error) {
+	rows, err := DB.Query(`
+		SELECT cp.category_id, cp.group_id, g.name, cp.can_view, cp.can_post, cp.can_comment, cp.can_moderate
+		FROM category_permissions cp
+		JOIN groups g ON cp.group_id = g.group_id
+		ORDER BY g.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category permissions: %v", err)
+	}
+	defer rows.Close()
+
+	grants := make(map[int][]models.CategoryGrant)
+	for rows.Next() {
+		var g models.CategoryGrant
+		if err := rows.Scan(&g.CategoryID, &g.GroupID, &g.GroupName, &g.CanView, &g.CanPost, &g.CanComment, &g.CanModerate); err != nil {
+			return nil, fmt.Errorf("failed to scan category permission: %v", err)
+		}
+		grants[g.CategoryID] = append(grants[g.CategoryID], g)
+	}
+	return grants, rows.Err()
+}
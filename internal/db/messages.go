@@ -0,0 +1,326 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"forum/internal/models"
+)
+
+// ErrBlocked is returned when a block between users stops a conversation from
+// being started or a message from being sent.
+var ErrBlocked = errors.New("a block prevents messaging this user")
+
+// Blocked reports whether either user has blocked the other.
+func Blocked(a, b int) (bool, error) {
+	var blocked bool
+	err := DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`, a, b, b, a).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blocks: %v", err)
+	}
+	return blocked, nil
+}
+
+// BlockUser stops blockedID from sending private messages to blockerID.
+func BlockUser(blockerID, blockedID int) error {
+	_, err := DB.Exec(`INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %v", err)
+	}
+	return nil
+}
+
+// UnblockUser lifts a block.
+func UnblockUser(blockerID, blockedID int) error {
+	_, err := DB.Exec(`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %v", err)
+	}
+	return nil
+}
+
+// BlockedUsers lists the users a user has blocked, by username.
+func BlockedUsers(userID int) ([]models.User, error) {
+	rows, err := DB.Query(`
+		SELECT u.user_id, u.username
+		FROM user_blocks b
+		JOIN users u ON u.user_id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY u.username`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocked users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.UserID, &u.Username); err != nil {
+			return nil, fmt.Errorf("failed to read blocked user: %v", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// StartConversation sends a first message from creatorID to memberIDs and returns
+// the conversation it went to. A message to a single user without a title goes to
+// their existing one-to-one conversation, if there is one. It returns ErrBlocked
+// when the creator and any member have blocked one another.
+func StartConversation(creatorID int, memberIDs []int, title, content string) (int, error) {
+	for _, id := range memberIDs {
+		blocked, err := Blocked(creatorID, id)
+		if err != nil {
+			return 0, err
+		}
+		if blocked {
+			return 0, ErrBlocked
+		}
+	}
+
+	if len(memberIDs) == 1 && title == "" {
+		var conversationID int
+		err := DB.QueryRow(`
+			SELECT c.conversation_id
+			FROM conversations c
+			WHERE c.title = ''
+			AND (SELECT COUNT(*) FROM conversation_members m WHERE m.conversation_id = c.conversation_id) = 2
+			AND EXISTS (SELECT 1 FROM conversation_members m WHERE m.conversation_id = c.conversation_id AND m.user_id = ?)
+			AND EXISTS (SELECT 1 FROM conversation_members m WHERE m.conversation_id = c.conversation_id AND m.user_id = ?)`,
+			creatorID, memberIDs[0]).Scan(&conversationID)
+		if err == nil {
+			if _, err := SendMessage(conversationID, creatorID, content); err != nil {
+				return 0, err
+			}
+			return conversationID, nil
+		} else if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to look up conversation: %v", err)
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO conversations (title, created_by) VALUES (?, ?)`, title, creatorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create conversation: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve conversation ID: %v", err)
+	}
+	for _, userID := range append([]int{creatorID}, memberIDs...) {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO conversation_members (conversation_id, user_id) VALUES (?, ?)`, id, userID); err != nil {
+			return 0, fmt.Errorf("failed to add conversation member: %v", err)
+		}
+	}
+	if _, err := addMessage(tx, int(id), creatorID, content); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit conversation: %v", err)
+	}
+	return int(id), nil
+}
+
+// SendMessage adds a message to a conversation the sender is a member of and
+// returns its ID. It returns ErrBlocked when another member has blocked the
+// sender or, in a one-to-one conversation, the sender has blocked the other.
+func SendMessage(conversationID, userID int, content string) (int, error) {
+	var blocked bool
+	err := DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM conversation_members m
+			JOIN user_blocks b ON b.blocker_id = m.user_id AND b.blocked_id = ?
+			WHERE m.conversation_id = ? AND m.user_id != ?
+		) OR (
+			(SELECT COUNT(*) FROM conversation_members WHERE conversation_id = ?) = 2
+			AND EXISTS(
+				SELECT 1 FROM conversation_members m
+				JOIN user_blocks b ON b.blocked_id = m.user_id AND b.blocker_id = ?
+				WHERE m.conversation_id = ?
+			)
+		)`, userID, conversationID, userID, conversationID, userID, conversationID).Scan(&blocked)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check blocks: %v", err)
+	}
+	if blocked {
+		return 0, ErrBlocked
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	id, err := addMessage(tx, conversationID, userID, content)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit message: %v", err)
+	}
+	return id, nil
+}
+
+// addMessage stores a message, bumps its conversation and marks it read for the
+// sender.
+func addMessage(tx *sql.Tx, conversationID, userID int, content string) (int, error) {
+	result, err := tx.Exec(`INSERT INTO messages (conversation_id, user_id, content) VALUES (?, ?, ?)`, conversationID, userID, content)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert message: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve message ID: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE conversation_id = ?`, conversationID); err != nil {
+		return 0, fmt.Errorf("failed to update conversation: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE conversation_members SET last_read_id = ? WHERE conversation_id = ? AND user_id = ?`, id, conversationID, userID); err != nil {
+		return 0, fmt.Errorf("failed to mark message read: %v", err)
+	}
+	return int(id), nil
+}
+
+// Conversations lists the conversations of a user, latest activity first.
+func Conversations(userID int) ([]models.Conversation, error) {
+	return conversations(userID, `1 = 1`)
+}
+
+// Conversation returns a conversation as one of its members sees it. It returns
+// sql.ErrNoRows when the user is not a member.
+func Conversation(userID, conversationID int) (models.Conversation, error) {
+	list, err := conversations(userID, `c.conversation_id = ?`, conversationID)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+	if len(list) == 0 {
+		return models.Conversation{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func conversations(userID int, condition string, args ...interface{}) ([]models.Conversation, error) {
+	query := `
+		SELECT c.conversation_id, c.title, c.updated_at, m.muted,
+			(SELECT COUNT(*) FROM messages x
+			 WHERE x.conversation_id = c.conversation_id AND x.message_id > m.last_read_id AND x.user_id != m.user_id),
+			COALESCE(last.content, ''), COALESCE(u.username, '')
+		FROM conversations c
+		JOIN conversation_members m ON m.conversation_id = c.conversation_id AND m.user_id = ?
+		LEFT JOIN messages last ON last.message_id =
+			(SELECT MAX(message_id) FROM messages WHERE conversation_id = c.conversation_id)
+		LEFT JOIN users u ON u.user_id = last.user_id
+		WHERE ` + condition + `
+		ORDER BY c.updated_at DESC, c.conversation_id DESC`
+	rows, err := DB.Query(query, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %v", err)
+	}
+	defer rows.Close()
+
+	var list []models.Conversation
+	index := make(map[int]int)
+	for rows.Next() {
+		var c models.Conversation
+		if err := rows.Scan(&c.ConversationID, &c.Title, &c.Updated, &c.Muted, &c.Unread, &c.LastMessage, &c.LastSender); err != nil {
+			return nil, fmt.Errorf("failed to read conversation: %v", err)
+		}
+		index[c.ConversationID] = len(list)
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %v", err)
+	}
+
+	members, err := DB.Query(`
+		SELECT m.conversation_id, u.username
+		FROM conversation_members m
+		JOIN users u ON u.user_id = m.user_id
+		WHERE m.user_id != ? AND m.conversation_id IN (SELECT conversation_id FROM conversation_members WHERE user_id = ?)
+		ORDER BY u.username`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation members: %v", err)
+	}
+	defer members.Close()
+	for members.Next() {
+		var id int
+		var username string
+		if err := members.Scan(&id, &username); err != nil {
+			return nil, fmt.Errorf("failed to read conversation member: %v", err)
+		}
+		if i, ok := index[id]; ok {
+			list[i].Members = append(list[i].Members, username)
+		}
+	}
+	return list, members.Err()
+}
+
+// Messages returns the messages of a conversation, oldest first.
+func Messages(conversationID int) ([]models.Message, error) {
+	rows, err := DB.Query(`
+		SELECT m.message_id, m.conversation_id, m.user_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.user_id = m.user_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.message_id`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.MessageID, &m.ConversationID, &m.UserID, &m.Username, &m.Content, &m.Created); err != nil {
+			return nil, fmt.Errorf("failed to read message: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// MarkConversationRead marks every message of a conversation as seen by a member.
+func MarkConversationRead(conversationID, userID int) error {
+	_, err := DB.Exec(`
+		UPDATE conversation_members
+		SET last_read_id = COALESCE((SELECT MAX(message_id) FROM messages WHERE conversation_id = ?), 0)
+		WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark conversation read: %v", err)
+	}
+	return nil
+}
+
+// SetConversationMuted mutes or unmutes a conversation for a member.
+func SetConversationMuted(conversationID, userID int, muted bool) error {
+	_, err := DB.Exec(`UPDATE conversation_members SET muted = ? WHERE conversation_id = ? AND user_id = ?`, muted, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mute conversation: %v", err)
+	}
+	return nil
+}
+
+// UnreadMessages counts the messages a user has not seen in conversations they
+// have not muted.
+func UnreadMessages(userID int) (int, error) {
+	var count int
+	err := DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM conversation_members m
+		JOIN messages x ON x.conversation_id = m.conversation_id
+		WHERE m.user_id = ? AND m.muted = 0 AND x.message_id > m.last_read_id AND x.user_id != m.user_id`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread messages: %v", err)
+	}
+	return count, nil
+}
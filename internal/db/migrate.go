@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+)
+
+// columnMigrations lists columns added to tables after they were first created.
+// schema.sql already contains them for new databases; migrate adds them to older ones.
+// Backfill, when set, runs once right after the column is added.
+var columnMigrations = []struct {
+	Table, Column, Definition, Backfill string
+}{
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'))", ""},
+	{"posts", "pinned", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"posts", "locked", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"posts", "removed", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"comments", "removed", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"categories", "slug", "TEXT", ""},
+	{"categories", "sort_order", "INTEGER NOT NULL DEFAULT 0", "UPDATE categories SET sort_order = category_id"},
+	{"categories", "archived", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"categories", "parent_id", "INTEGER REFERENCES categories(category_id)", ""},
+	{"categories", "private", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"users", "email_verified", "INTEGER NOT NULL DEFAULT 0", "UPDATE users SET email_verified = 1 WHERE auth_type IN ('github', 'google')"},
+}
+
+// indexMigrations are indexes on migrated columns. They cannot live in schema.sql,
+// which runs before the columns exist on older databases.
+var indexMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories(slug)`,
+	`CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id)`,
+}
+
+// migrate adds any missing columns from columnMigrations, then creates the
+// indexes that depend on them.
+func migrate() error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(m.Table, m.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", m.Table, m.Column, err)
+		}
+		if m.Backfill == "" {
+			continue
+		}
+		if _, err := DB.Exec(m.Backfill); err != nil {
+			return fmt.Errorf("failed to backfill column %s.%s: %v", m.Table, m.Column, err)
+		}
+	}
+
+	if err := backfillCategorySlugs(); err != nil {
+		return err
+	}
+
+	for _, stmt := range indexMigrations {
+		if _, err := DB.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create index: %v", err)
+		}
+	}
+	return nil
+}
+
+// columnExists reports whether table has a column with the given name.
+func columnExists(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, ctyp string
+			notNull    int
+			dflt       interface{}
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &ctyp, &notNull, &dflt, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan columns of %s: %v", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"forum/internal/models"
+)
+
+// NotifyComment notifies the author of a post of a new comment on it, and the
+// others who commented on the post of a reply.
+func NotifyComment(actorID, postID, commentID int) error {
+	_, err := DB.Exec(`
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+		SELECT user_id, ?, 'comment', post_id, ? FROM posts WHERE post_id = ? AND user_id != ?`,
+		actorID, commentID, postID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to notify post author: %v", err)
+	}
+	_, err = DB.Exec(`
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+		SELECT DISTINCT c.user_id, ?, 'reply', c.post_id, ?
+		FROM comments c
+		JOIN posts p ON p.post_id = c.post_id
+		WHERE c.post_id = ? AND c.removed = 0 AND c.user_id != ? AND c.user_id != p.user_id`,
+		actorID, commentID, postID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to notify commenters: %v", err)
+	}
+	return nil
+}
+
+// NotifyReaction notifies the author of a post or, when commentID is set, a
+// comment that the actor liked it. Taking the like back removes the notification
+// if it has not been read yet. current is the actor's reaction after the change.
+func NotifyReaction(actorID int, postID, commentID *int, current string) error {
+	var ownerID, targetPostID int
+	var err error
+	if commentID != nil {
+		err = DB.QueryRow(`SELECT user_id, post_id FROM comments WHERE comment_id = ?`, *commentID).Scan(&ownerID, &targetPostID)
+	} else {
+		targetPostID = *postID
+		ownerID, err = PostAuthor(targetPostID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find author: %v", err)
+	}
+	if ownerID == actorID {
+		return nil
+	}
+
+	if current != "like" {
+		_, err = DB.Exec(`
+			DELETE FROM notifications
+			WHERE user_id = ? AND actor_id = ? AND type = 'like' AND post_id = ? AND comment_id IS ? AND read_at IS NULL`,
+			ownerID, actorID, targetPostID, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to remove notification: %v", err)
+		}
+		return nil
+	}
+
+	// Liking again after taking a like back does not notify twice
+	_, err = DB.Exec(`
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+		SELECT ?, ?, 'like', ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM notifications
+			WHERE user_id = ? AND actor_id = ? AND type = 'like' AND post_id = ? AND comment_id IS ?)`,
+		ownerID, actorID, targetPostID, commentID, ownerID, actorID, targetPostID, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to notify author: %v", err)
+	}
+	return nil
+}
+
+// NotifyMentions notifies the users named in a post or, when commentID is set, a
+// comment that the actor mentioned them. Users who cannot see the post, unknown
+// names and the actor are skipped, and nobody is notified twice about the same
+// post or comment, so it can run again after an edit.
+func NotifyMentions(actorID, postID int, commentID *int, usernames []string) error {
+	for _, username := range usernames {
+		userID, err := UserIDByUsername(username)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to find mentioned user: %v", err)
+		}
+		if userID == actorID {
+			continue
+		}
+		args := []interface{}{userID, actorID, commentID, postID}
+		args = append(args, VisibilityArgs(userID)...)
+		args = append(args, userID, postID, commentID)
+		_, err = DB.Exec(`
+			INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+			SELECT ?, ?, 'mention', p.post_id, ?
+			FROM posts p
+			WHERE p.post_id = ? AND p.removed = 0 AND `+PostVisible+`
+			AND NOT EXISTS (SELECT 1 FROM notifications n
+				WHERE n.user_id = ? AND n.post_id = ? AND n.comment_id IS ? AND n.type IN ('mention', 'comment', 'reply'))`,
+			args...)
+		if err != nil {
+			return fmt.Errorf("failed to notify mention: %v", err)
+		}
+	}
+	return nil
+}
+
+// NotifyLockout tells a user their account was locked after failed logins, unless
+// they were already told since the given time. It reports whether they were
+// notified.
+func NotifyLockout(userID int, since time.Time) (bool, error) {
+	result, err := DB.Exec(`
+		INSERT INTO notifications (user_id, type)
+		SELECT ?, 'lockout'
+		WHERE NOT EXISTS (SELECT 1 FROM notifications WHERE user_id = ? AND type = 'lockout' AND created_at > ?)`,
+		userID, userID, since.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return false, fmt.Errorf("failed to notify lockout: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// notificationGroups groups the notifications of a user: comments and replies per
+// post, others per post or comment, read and unread apart. Notifications about
+// posts the user can no longer see, or from users they blocked, are left out.
+// It takes the user ID followed by VisibilityArgs.
+const notificationGroups = `
+	SELECT g.type, g.post_id, g.comment_id, g.actors, g.actor_count, g.unread, g.latest_id, l.created_at, COALESCE(p.title, '')
+	FROM (
+		SELECT n.type, n.post_id,
+			MAX(n.comment_id) AS comment_id,
+			COALESCE(GROUP_CONCAT(DISTINCT u.username), '') AS actors,
+			COUNT(DISTINCT n.actor_id) AS actor_count,
+			n.read_at IS NULL AS unread,
+			MAX(n.notification_id) AS latest_id
+		FROM notifications n
+		LEFT JOIN users u ON u.user_id = n.actor_id
+		WHERE n.user_id = ?
+		AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = n.user_id AND b.blocked_id = n.actor_id)
+		GROUP BY n.type, n.post_id, CASE WHEN n.type IN ('comment', 'reply') THEN 0 ELSE n.comment_id END, n.read_at IS NULL
+	) g
+	JOIN notifications l ON l.notification_id = g.latest_id
+	LEFT JOIN posts p ON p.post_id = g.post_id
+	WHERE (g.post_id IS NULL OR (p.removed = 0 AND ` + PostVisible + `))`
+
+// Notifications returns a page of a user's grouped notifications, unread first,
+// then newest first.
+func Notifications(userID, limit, offset int) ([]models.Notification, error) {
+	args := append([]interface{}{userID}, VisibilityArgs(userID)...)
+	return queryNotifications(notificationGroups+` ORDER BY g.unread DESC, g.latest_id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+}
+
+// UnseenNotifications returns a user's unread notification groups with a
+// notification newer than afterID, newest first.
+func UnseenNotifications(userID, afterID int) ([]models.Notification, error) {
+	args := append([]interface{}{userID}, VisibilityArgs(userID)...)
+	return queryNotifications(notificationGroups+` AND g.unread AND g.latest_id > ? ORDER BY g.latest_id DESC`, append(args, afterID)...)
+}
+
+func queryNotifications(query string, args ...interface{}) ([]models.Notification, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notifications: %v", err)
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var postID, commentID *int
+		var actors string
+		if err := rows.Scan(&n.Type, &postID, &commentID, &actors, &n.ActorCount, &n.Unread, &n.NotificationID, &n.Created, &n.PostTitle); err != nil {
+			return nil, fmt.Errorf("failed to read notification: %v", err)
+		}
+		if postID != nil {
+			n.PostID = *postID
+		}
+		if commentID != nil {
+			n.CommentID = *commentID
+		}
+		if actors != "" {
+			n.Actors = strings.Split(actors, ",")
+			sort.Strings(n.Actors)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadNotifications counts the groups of unread notifications of a user.
+func UnreadNotifications(userID int) (int, error) {
+	var count int
+	args := append([]interface{}{userID}, VisibilityArgs(userID)...)
+	err := DB.QueryRow(`SELECT COUNT(*) FROM (`+notificationGroups+` AND g.unread)`, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %v", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks the unread notifications grouped with the given one
+// as read.
+func MarkNotificationRead(userID, notificationID int) error {
+	_, err := DB.Exec(`
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE read_at IS NULL AND notification_id IN (
+			SELECT n.notification_id
+			FROM notifications n
+			JOIN notifications t ON t.notification_id = ? AND t.user_id = ?
+			WHERE n.user_id = t.user_id AND n.type = t.type AND n.post_id IS t.post_id
+			AND (n.type IN ('comment', 'reply') OR n.comment_id IS t.comment_id))`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %v", err)
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every notification of a user as read.
+func MarkAllNotificationsRead(userID int) error {
+	_, err := DB.Exec(`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"forum/internal/models"
+)
+
+// CreatePost stores a new post in the given categories and returns its ID. The
+// caller checks that the user may post in those categories.
+func CreatePost(userID int, title, content, imgurl string, categoryIDs []int) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO posts (user_id, title, content, imgurl) VALUES (?, ?, ?, NULLIF(?, ''))`, userID, title, content, imgurl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert post: %v", err)
+	}
+	postID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve post ID: %v", err)
+	}
+
+	for _, catID := range categoryIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)`, postID, catID); err != nil {
+			return 0, fmt.Errorf("failed to link category to post: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit post: %v", err)
+	}
+	return int(postID), nil
+}
+
+// PostAuthor returns the ID of the user who wrote a post. It returns sql.ErrNoRows
+// when there is no such post.
+func PostAuthor(postID int) (int, error) {
+	var userID int
+	err := DB.QueryRow(`SELECT user_id FROM posts WHERE post_id = ?`, postID).Scan(&userID)
+	return userID, err
+}
+
+// UpdatePost replaces the title and content of a post.
+func UpdatePost(postID int, title, content string) error {
+	_, err := DB.Exec(`UPDATE posts SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE post_id = ?`, title, content, postID)
+	if err != nil {
+		return fmt.Errorf("failed to update post: %v", err)
+	}
+	return nil
+}
+
+// DeletePost hides a post the same way moderators remove it, so reports and
+// reactions that refer to it stay intact.
+func DeletePost(postID int) error {
+	_, err := DB.Exec(`UPDATE posts SET removed = 1, updated_at = CURRENT_TIMESTAMP WHERE post_id = ?`, postID)
+	if err != nil {
+		return fmt.Errorf("failed to delete post: %v", err)
+	}
+	return nil
+}
+
+// RemovedPosts returns up to limit posts that were removed, most recently changed
+// first, so that moderators can restore them. Only PostID, UserID, Username,
+// Title, Content and UpdatedAt are set.
+func RemovedPosts(limit int) ([]models.Post, error) {
+	rows, err := DB.Query(`
+		SELECT p.post_id, p.user_id, u.username, p.title, p.content, p.updated_at
+		FROM posts p JOIN users u ON p.user_id = u.user_id
+		WHERE p.removed = 1
+		ORDER BY p.updated_at DESC, p.post_id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query removed posts: %v", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var p models.Post
+		if err := rows.Scan(&p.PostID, &p.UserID, &p.Username, &p.Title, &p.Content, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan removed post: %v", err)
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// CreateComment stores a new comment and returns its ID. The caller checks that
+// the user may comment on the post.
+func CreateComment(postID, userID int, content string) (int, error) {
+	result, err := DB.Exec(`INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)`, postID, userID, content)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert comment: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve comment ID: %v", err)
+	}
+	return int(id), nil
+}
+
+// UpdateComment replaces the content of a comment.
+func UpdateComment(commentID int, content string) error {
+	_, err := DB.Exec(`UPDATE comments SET content = ?, updated_at = CURRENT_TIMESTAMP WHERE comment_id = ?`, content, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to update comment: %v", err)
+	}
+	return nil
+}
+
+// DeleteComment hides a comment the same way moderators remove it.
+func DeleteComment(commentID int) error {
+	_, err := DB.Exec(`UPDATE comments SET removed = 1, updated_at = CURRENT_TIMESTAMP WHERE comment_id = ?`, commentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %v", err)
+	}
+	return nil
+}
+
+// Reaction is the outcome of React: the new counts of the post or comment and the
+// reaction the user now has on it, empty when they took it back.
+type Reaction struct {
+	Likes    int
+	Dislikes int
+	Current  string
+}
+
+// React toggles a like or dislike of a user on a post or, when commentID is set, a
+// comment. Reacting the same way twice takes the reaction back, reacting the other
+// way switches it.
+func React(userID int, postID, commentID *int, likeType string) (Reaction, error) {
+	var reaction Reaction
+
+	var existing string
+	err := DB.QueryRow(`SELECT like_type FROM likes WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`, userID, postID, commentID).Scan(&existing)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = DB.Exec(`INSERT INTO likes (user_id, post_id, comment_id, like_type) VALUES (?, ?, ?, ?)`, userID, postID, commentID, likeType)
+		reaction.Current = likeType
+	case err != nil:
+		return reaction, fmt.Errorf("failed to load reaction: %v", err)
+	case existing == likeType:
+		_, err = DB.Exec(`DELETE FROM likes WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`, userID, postID, commentID)
+	default:
+		_, err = DB.Exec(`UPDATE likes SET like_type = ? WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`, likeType, userID, postID, commentID)
+		reaction.Current = likeType
+	}
+	if err != nil {
+		return reaction, fmt.Errorf("failed to save reaction: %v", err)
+	}
+
+	err = DB.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN like_type = 'like' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN like_type = 'dislike' THEN 1 ELSE 0 END), 0)
+		FROM likes
+		WHERE post_id IS ? AND comment_id IS ?`, postID, commentID).Scan(&reaction.Likes, &reaction.Dislikes)
+	if err != nil {
+		return reaction, fmt.Errorf("failed to count reactions: %v", err)
+	}
+	return reaction, nil
+}
@@ -0,0 +1,30 @@
+package db
+
+import "fmt"
+
+// MarkPostRead records that a user has seen every comment of a post so far.
+func MarkPostRead(userID, postID int) error {
+	_, err := DB.Exec(`
+		INSERT INTO post_reads (user_id, post_id, last_read_id, read_at)
+		VALUES (?1, ?2, COALESCE((SELECT MAX(comment_id) FROM comments WHERE post_id = ?2), 0), CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET last_read_id = excluded.last_read_id, read_at = excluded.read_at`,
+		userID, postID)
+	if err != nil {
+		return fmt.Errorf("failed to mark post read: %v", err)
+	}
+	return nil
+}
+
+// MarkAllPostsRead marks every comment so far as read by a user, so that only
+// comments added afterwards show as new on the posts they opened.
+func MarkAllPostsRead(userID int) error {
+	_, err := DB.Exec(`
+		INSERT INTO read_marks (user_id, last_read_id, marked_at)
+		VALUES (?, (SELECT COALESCE(MAX(comment_id), 0) FROM comments), CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET last_read_id = excluded.last_read_id, marked_at = excluded.marked_at`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark posts read: %v", err)
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ CREATE TABLE IF NOT EXISTS users (
 	 provider_id TEXT, -- New colum
     profile_picture TEXT,
     bio TEXT,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    email_verified INTEGER NOT NULL DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -23,8 +25,13 @@ CREATE TABLE IF NOT EXISTS post_categories (
 
 CREATE TABLE IF NOT EXISTS categories (
 	category_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	parent_id INTEGER REFERENCES categories(category_id),
 	name TEXT NOT NULL UNIQUE,
+	slug TEXT,
 	description TEXT,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	archived INTEGER NOT NULL DEFAULT 0,
+	private INTEGER NOT NULL DEFAULT 0,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -35,6 +42,9 @@ CREATE TABLE IF NOT EXISTS posts (
 	title TEXT NOT NULL,
 	content TEXT NOT NULL,
 	imgurl TEXT,
+	pinned INTEGER NOT NULL DEFAULT 0,
+	locked INTEGER NOT NULL DEFAULT 0,
+	removed INTEGER NOT NULL DEFAULT 0,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
@@ -45,6 +55,7 @@ CREATE TABLE IF NOT EXISTS comments (
 	post_id INTEGER NOT NULL,
 	user_id INTEGER NOT NULL,
 	content TEXT NOT NULL,
+	removed INTEGER NOT NULL DEFAULT 0,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 	FOREIGN KEY (post_id) REFERENCES posts(post_id) ON DELETE CASCADE,
@@ -76,3 +87,302 @@ CREATE TABLE IF NOT EXISTS sessions (
 
 
 
+
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	attempt_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_key TEXT NOT NULL,
+	ip_address TEXT NOT NULL,
+	attempted_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_account ON login_attempts(account_key, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, attempted_at);
+
+CREATE TABLE IF NOT EXISTS reports (
+	report_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reporter_id INTEGER NOT NULL,
+	post_id INTEGER,
+	comment_id INTEGER,
+	reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'misinformation', 'off_topic', 'other')),
+	details TEXT,
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+	resolved_by INTEGER,
+	resolved_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (reporter_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts(post_id) ON DELETE CASCADE,
+	FOREIGN KEY (comment_id) REFERENCES comments(comment_id) ON DELETE CASCADE,
+	FOREIGN KEY (resolved_by) REFERENCES users(user_id) ON DELETE SET NULL,
+	CONSTRAINT check_report_target CHECK (
+		(post_id IS NOT NULL AND comment_id IS NULL) OR
+		(post_id IS NULL AND comment_id IS NOT NULL)
+	)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status, created_at);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id INTEGER NOT NULL,
+	before_state TEXT,
+	after_state TEXT,
+	reason TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- The audit log is append-only
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TABLE IF NOT EXISTS bans (
+	ban_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	banned_by INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	expires_at DATETIME, -- NULL for permanent bans
+	lifted_at DATETIME,
+	lifted_by INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bans_user ON bans(user_id, lifted_at);
+
+CREATE TABLE IF NOT EXISTS groups (
+	group_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+	group_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, user_id),
+	FOREIGN KEY (group_id) REFERENCES groups(group_id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);
+
+-- What the members of a group may do in a category. Private categories are only
+-- visible to groups granted can_view; can_moderate also applies to public ones.
+CREATE TABLE IF NOT EXISTS category_permissions (
+	category_id INTEGER NOT NULL,
+	group_id INTEGER NOT NULL,
+	can_view INTEGER NOT NULL DEFAULT 1,
+	can_post INTEGER NOT NULL DEFAULT 0,
+	can_comment INTEGER NOT NULL DEFAULT 0,
+	can_moderate INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (category_id, group_id),
+	FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE,
+	FOREIGN KEY (group_id) REFERENCES groups(group_id) ON DELETE CASCADE
+);
+
+-- Personal API tokens. Only a SHA-256 hash of the token is kept; prefix is the start
+-- of the token, shown so users can tell their tokens apart.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	prefix TEXT NOT NULL,
+	scope TEXT NOT NULL DEFAULT 'read' CHECK (scope IN ('read', 'write')),
+	expires_at DATETIME, -- NULL for tokens that never expire
+	last_used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
+
+-- Chat messages of the per-category chat rooms.
+CREATE TABLE IF NOT EXISTS chat_messages (
+	message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_category ON chat_messages(category_id, message_id);
+
+-- Private conversations between two or more users. updated_at is the time of the
+-- latest message, so inboxes can be sorted by it.
+CREATE TABLE IF NOT EXISTS conversations (
+	conversation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL DEFAULT '', -- empty for one-to-one conversations
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Members of a conversation. last_read_id is the latest message they have seen;
+-- muted conversations do not count towards their unread total.
+CREATE TABLE IF NOT EXISTS conversation_members (
+	conversation_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	last_read_id INTEGER NOT NULL DEFAULT 0,
+	muted INTEGER NOT NULL DEFAULT 0,
+	joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (conversation_id, user_id),
+	FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user ON conversation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+	message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (conversation_id) REFERENCES conversations(conversation_id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, message_id);
+
+-- Users someone does not want private messages from.
+CREATE TABLE IF NOT EXISTS user_blocks (
+	blocker_id INTEGER NOT NULL,
+	blocked_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (blocker_id, blocked_id),
+	FOREIGN KEY (blocker_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (blocked_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Notifications of activity on a user's content. Each row is one event; pages
+-- group them by type and target, so likes on the same post show as one entry.
+CREATE TABLE IF NOT EXISTS notifications (
+	notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL, -- who is notified
+	actor_id INTEGER, -- who acted, NULL for notices from the forum itself
+	type TEXT NOT NULL CHECK (type IN ('comment', 'reply', 'like', 'mention', 'lockout')),
+	post_id INTEGER,
+	comment_id INTEGER,
+	read_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (actor_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts(post_id) ON DELETE CASCADE,
+	FOREIGN KEY (comment_id) REFERENCES comments(comment_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, read_at);
+
+-- Categories a user follows, whose top posts go into their email digest.
+CREATE TABLE IF NOT EXISTS category_follows (
+	user_id INTEGER NOT NULL,
+	category_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, category_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+);
+
+-- How often a user is emailed about their notifications. Users without a row
+-- get no email. last_notification_id is the latest notification already sent.
+CREATE TABLE IF NOT EXISTS email_digests (
+	user_id INTEGER PRIMARY KEY,
+	frequency TEXT NOT NULL CHECK (frequency IN ('immediate', 'daily', 'weekly', 'off')),
+	sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_notification_id INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Username prefix search for @mention autocomplete, ignoring case.
+CREATE INDEX IF NOT EXISTS idx_users_username_nocase ON users(username COLLATE NOCASE);
+
+-- Email addresses users asked to change to, waiting for them to follow the link
+-- sent to the new address. Only the hash of the token is kept.
+CREATE TABLE IF NOT EXISTS email_changes (
+	user_id INTEGER PRIMARY KEY,
+	email TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Accounts their owners asked to delete, which are anonymized at delete_at
+-- unless the owner signs back in and cancels.
+CREATE TABLE IF NOT EXISTS account_deletions (
+	user_id INTEGER PRIMARY KEY,
+	requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	delete_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Users a user follows, whose posts show in their Following feed.
+CREATE TABLE IF NOT EXISTS user_follows (
+	follower_id INTEGER NOT NULL,
+	followed_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (follower_id, followed_id),
+	FOREIGN KEY (follower_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (followed_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_follows_followed ON user_follows(followed_id);
+
+-- The Following feed and profiles look posts up by author and by category.
+CREATE INDEX IF NOT EXISTS idx_posts_user ON posts(user_id);
+CREATE INDEX IF NOT EXISTS idx_post_categories_category ON post_categories(category_id);
+
+-- Posts users saved to read later, optionally sorted into folders of their own
+-- naming; '' is the default folder.
+CREATE TABLE IF NOT EXISTS bookmarks (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	folder TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, post_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts(post_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post ON bookmarks(post_id);
+
+-- How far users have read the comments of posts they opened. last_read_id is the
+-- latest comment they have seen; later comments by others are new to them.
+CREATE TABLE IF NOT EXISTS post_reads (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	last_read_id INTEGER NOT NULL DEFAULT 0,
+	read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, post_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+	FOREIGN KEY (post_id) REFERENCES posts(post_id) ON DELETE CASCADE
+);
+
+-- Where users last marked everything read: comments up to last_read_id count as
+-- read on every post they opened.
+CREATE TABLE IF NOT EXISTS read_marks (
+	user_id INTEGER PRIMARY KEY,
+	last_read_id INTEGER NOT NULL DEFAULT 0,
+	marked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- New comment counts look comments up by post.
+CREATE INDEX IF NOT EXISTS idx_comments_post ON comments(post_id, comment_id);
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrUsernameTaken = errors.New("that username is taken")
+	ErrEmailTaken    = errors.New("that email is already in use")
+)
+
+// emailChangeLifetime is how long a link to confirm a new email address works.
+const emailChangeLifetime = 24 * time.Hour
+
+// UsernameTaken reports whether another user than exceptID has the username,
+// ignoring ASCII case so that names cannot be told apart by case alone.
+func UsernameTaken(username string, exceptID int) (bool, error) {
+	var taken bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ? COLLATE NOCASE AND user_id != ?)`, username, exceptID).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check username: %v", err)
+	}
+	return taken, nil
+}
+
+// EmailTaken reports whether another user than exceptID has the email address.
+func EmailTaken(email string, exceptID int) (bool, error) {
+	var taken bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ? COLLATE NOCASE AND user_id != ?)`, email, exceptID).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check email: %v", err)
+	}
+	return taken, nil
+}
+
+// ChangeUsername renames a user. It returns ErrUsernameTaken when another user
+// has the name.
+func ChangeUsername(userID int, username string) error {
+	taken, err := UsernameTaken(username, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUsernameTaken
+	}
+	if _, err := DB.Exec(`UPDATE users SET username = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`, username, userID); err != nil {
+		return fmt.Errorf("failed to change username: %v", err)
+	}
+	return nil
+}
+
+// UpdateProfile sets the bio and profile picture of a user.
+func UpdateProfile(userID int, bio, profilePicture string) error {
+	_, err := DB.Exec(`UPDATE users SET bio = ?, profile_picture = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`,
+		bio, profilePicture, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update profile: %v", err)
+	}
+	return nil
+}
+
+// PasswordHash returns the stored password of a user, which is not a bcrypt hash
+// for accounts that only sign in with GitHub or Google.
+func PasswordHash(userID int) (string, error) {
+	var hash string
+	if err := DB.QueryRow(`SELECT password FROM users WHERE user_id = ?`, userID).Scan(&hash); err != nil {
+		return "", fmt.Errorf("failed to fetch password: %v", err)
+	}
+	return hash, nil
+}
+
+// SetPassword stores a new password hash for a user and, in the same step, ends
+// their sessions other than keepSessionID and revokes their API tokens, so that
+// whoever knew the old password is locked out.
+func SetPassword(userID int, hash, keepSessionID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET password = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`, hash, userID); err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ? AND session_id != ?`, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to end sessions: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to set password: %v", err)
+	}
+	return nil
+}
+
+// RequestEmailChange records that a user wants to change their email address and
+// returns the token that confirms it, replacing any earlier request. The address
+// only changes once ConfirmEmailChange is called with the token. It returns
+// ErrEmailTaken when another user has the address.
+func RequestEmailChange(userID int, email string) (string, error) {
+	taken, err := EmailTaken(email, userID)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrEmailTaken
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(secret)
+	_, err = DB.Exec(`
+		INSERT INTO email_changes (user_id, email, token_hash, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET email = excluded.email, token_hash = excluded.token_hash, expires_at = excluded.expires_at`,
+		userID, email, hashAPIToken(token), time.Now().Add(emailChangeLifetime).UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to store email change: %v", err)
+	}
+	return token, nil
+}
+
+// PendingEmail returns the address a user asked to change to and has not yet
+// confirmed, or "" when there is none.
+func PendingEmail(userID int) (string, error) {
+	var email string
+	err := DB.QueryRow(`SELECT email FROM email_changes WHERE user_id = ? AND expires_at > ?`, userID, time.Now().UTC()).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to fetch email change: %v", err)
+	}
+	return email, nil
+}
+
+// ConfirmEmailChange changes the email address of the user the token was issued
+// to and returns the user. It returns sql.ErrNoRows for unknown or expired tokens
+// and ErrEmailTaken when the address was taken in the meantime.
+func ConfirmEmailChange(token string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email string
+	err = tx.QueryRow(`SELECT user_id, email FROM email_changes WHERE token_hash = ? AND expires_at > ?`,
+		hashAPIToken(token), time.Now().UTC()).Scan(&userID, &email)
+	if err != nil {
+		return 0, err
+	}
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ? COLLATE NOCASE AND user_id != ?)`, email, userID).Scan(&taken); err != nil {
+		return 0, fmt.Errorf("failed to check email: %v", err)
+	}
+	if taken {
+		return 0, ErrEmailTaken
+	}
+	if _, err := tx.Exec(`UPDATE users SET email = ?, email_verified = 1, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`, email, userID); err != nil {
+		return 0, fmt.Errorf("failed to change email: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM email_changes WHERE user_id = ?`, userID); err != nil {
+		return 0, fmt.Errorf("failed to change email: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to change email: %v", err)
+	}
+	return userID, nil
+}
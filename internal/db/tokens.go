@@ -0,0 +1,118 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"forum/internal/models"
+)
+
+// tokenPrefix starts every API token so they are easy to recognise, for example by
+// secret scanners.
+const tokenPrefix = "forum_"
+
+// touchInterval is how often last_used_at is updated for a token in use.
+const touchInterval = time.Minute
+
+// hashAPIToken returns the hash stored for a token.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a token for a user and returns it. It cannot be recovered
+// later, only its hash is stored. A nil expiresAt never expires.
+func CreateAPIToken(userID int, name, scope string, expiresAt *time.Time) (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := tokenPrefix + hex.EncodeToString(secret)
+
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+	_, err := DB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix, scope, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, name, hashAPIToken(token), token[:len(tokenPrefix)+6], scope, expires)
+	if err != nil {
+		return "", fmt.Errorf("failed to store token: %v", err)
+	}
+	return token, nil
+}
+
+const tokenColumns = `token_id, user_id, name, prefix, scope, expires_at, last_used_at, created_at`
+
+func scanAPIToken(s scanner) (models.APIToken, error) {
+	var t models.APIToken
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := s.Scan(&t.TokenID, &t.UserID, &t.Name, &t.Prefix, &t.Scope, &expiresAt, &lastUsedAt, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	return t, nil
+}
+
+// APITokens lists the tokens of a user, newest first.
+func APITokens(userID int) ([]models.APIToken, error) {
+	rows, err := DB.Query(`SELECT `+tokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, token_id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %v", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes a token of a user. It returns sql.ErrNoRows when the user
+// has no such token.
+func RevokeAPIToken(userID, tokenID int) error {
+	result, err := DB.Exec(`DELETE FROM api_tokens WHERE token_id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UseAPIToken looks up a token presented by a client and records that it was used.
+// It returns nil when the token is unknown or expired.
+func UseAPIToken(token string) (*models.APIToken, error) {
+	t, err := scanAPIToken(DB.QueryRow(`SELECT `+tokenColumns+` FROM api_tokens WHERE token_hash = ?`, hashAPIToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up token: %v", err)
+	}
+	if t.Expired() {
+		return nil, nil
+	}
+
+	// Busy tokens only get their last use written once per touchInterval
+	now := time.Now().UTC()
+	_, err = DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, t.TokenID, now.Add(-touchInterval))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record token use: %v", err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"forum/internal/models"
+)
+
+// userColumns are the columns scanned by scanUser.
+const userColumns = `user_id, username, email, role, COALESCE(bio, ''), COALESCE(profile_picture, ''), created_at`
+
+func scanUser(row scanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.UserID, &user.Username, &user.Email, &user.Role, &user.Bio, &user.ProfilePicture, &user.CreatedAt)
+	return user, err
+}
+
+// UserByID looks up a user by ID. It returns sql.ErrNoRows when there is no such user.
+func UserByID(id int) (models.User, error) {
+	return scanUser(DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_id = ?`, id))
+}
+
+// UserByUsername looks up a user by username. It returns sql.ErrNoRows when there
+// is no such user.
+func UserByUsername(username string) (models.User, error) {
+	return scanUser(DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+}
+
+// ReactionTotals counts the likes and dislikes a user's posts and comments have
+// received, leaving out removed ones and those on posts the viewer may not see.
+func ReactionTotals(userID, viewerID int) (likes, dislikes int, err error) {
+	args := append(VisibilityArgs(viewerID), userID, userID)
+	err = DB.QueryRow(`
+		SELECT COALESCE(SUM(l.like_type = 'like'), 0), COALESCE(SUM(l.like_type = 'dislike'), 0)
+		FROM likes l
+		LEFT JOIN comments c ON c.comment_id = l.comment_id
+		JOIN posts p ON p.post_id = COALESCE(c.post_id, l.post_id)
+		WHERE p.removed = 0 AND `+PostVisible+`
+		AND ((l.comment_id IS NULL AND p.user_id = ?) OR (c.user_id = ? AND c.removed = 0))`, args...).Scan(&likes, &dislikes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count reactions: %v", err)
+	}
+	return likes, dislikes, nil
+}
+
+// UserIDByUsername returns the ID of the user with the given username, ignoring
+// ASCII case as usernames cannot differ by case alone. An exact match wins over
+// accounts from before that rule. It returns sql.ErrNoRows when there is no such
+// user.
+func UserIDByUsername(username string) (int, error) {
+	var id int
+	err := DB.QueryRow(`SELECT user_id FROM users WHERE username = ? COLLATE NOCASE ORDER BY username = ? DESC LIMIT 1`,
+		username, username).Scan(&id)
+	return id, err
+}
+
+// UsersByPrefix returns up to limit users whose username starts with prefix,
+// ignoring ASCII case, in alphabetical order. Only UserID and Username are set.
+func UsersByPrefix(prefix string, limit int) ([]models.User, error) {
+	// A range rather than LIKE, so the lookup can use idx_users_username_nocase
+	rows, err := DB.Query(`
+		SELECT user_id, username FROM users
+		WHERE username >= ? COLLATE NOCASE AND username < ? COLLATE NOCASE
+		ORDER BY username COLLATE NOCASE
+		LIMIT ?`, prefix, prefix+string(rune(0x10FFFF)), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.UserID, &user.Username); err != nil {
+			return nil, fmt.Errorf("failed to read user: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// ExistingUsernames returns which of the given usernames belong to users, ignoring
+// ASCII case. The result maps the lower-cased names to the usernames as registered.
+func ExistingUsernames(usernames []string) (map[string]string, error) {
+	existing := make(map[string]string)
+	if len(usernames) == 0 {
+		return existing, nil
+	}
+	args := make([]interface{}, len(usernames))
+	requested := make(map[string]bool)
+	for i, name := range usernames {
+		args[i] = name
+		requested[name] = true
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(usernames)), ", ")
+	rows, err := DB.Query(`SELECT username FROM users WHERE username COLLATE NOCASE IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up usernames: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read username: %v", err)
+		}
+		// An exact match wins over accounts differing by case only
+		lower := strings.ToLower(name)
+		if _, ok := existing[lower]; !ok || requested[name] {
+			existing[lower] = name
+		}
+	}
+	return existing, rows.Err()
+}
@@ -0,0 +1,188 @@
+// Package digest emails users their unread notifications and, in daily and
+// weekly digests, the top new posts in the categories they follow.
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"forum/internal/db"
+	"forum/internal/feed"
+	"forum/internal/mail"
+	"forum/internal/models"
+)
+
+var (
+	// Mailer sends the digests.
+	Mailer mail.Mailer = mail.Log{}
+	// BaseURL is the address of the forum, used for the links in emails.
+	BaseURL = "http://localhost:8080"
+)
+
+// topPosts is how many posts from followed categories a digest lists.
+const topPosts = 5
+
+// periods are the times between scheduled digests. Immediate digests go out
+// whenever there are new notifications.
+var periods = map[string]time.Duration{
+	models.DigestDaily:  24 * time.Hour,
+	models.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+// LoadConfig sets Mailer, BaseURL and Secret from the environment: the SMTP
+// settings read by mail.FromEnv, BASE_URL and DIGEST_SECRET.
+func LoadConfig() {
+	Mailer = mail.FromEnv()
+	if base := os.Getenv("BASE_URL"); base != "" {
+		BaseURL = strings.TrimSuffix(base, "/")
+	}
+	if secret := os.Getenv("DIGEST_SECRET"); secret != "" {
+		Secret = []byte(secret)
+	} else {
+		log.Println("Warning: DIGEST_SECRET not configured, unsubscribe links will stop working when the server restarts")
+	}
+}
+
+// SendDue sends the digests that are due at now. Failures for one user are
+// logged and do not stop the others.
+func SendDue(now time.Time) error {
+	subscribers, err := db.DigestSubscribers(now)
+	if err != nil {
+		return err
+	}
+	for _, s := range subscribers {
+		if err := send(s, now); err != nil {
+			log.Printf("Digest for user %d failed: %v", s.UserID, err)
+		}
+	}
+	return nil
+}
+
+// send emails a subscriber their digest if it is due and has anything in it.
+func send(s models.DigestSubscriber, now time.Time) error {
+	period, scheduled := periods[s.Frequency]
+	if scheduled && now.Sub(s.SentAt) < period {
+		return nil
+	}
+
+	notifications, err := db.UnseenNotifications(s.UserID, s.LastNotificationID)
+	if err != nil {
+		return err
+	}
+	var posts []models.Post
+	if scheduled {
+		posts, err = feed.ListPosts(feed.Options{ViewerID: s.UserID, FollowedBy: s.UserID, Since: s.SentAt, Top: true, Limit: topPosts, SkipComments: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(notifications) == 0 && len(posts) == 0 {
+		if !scheduled {
+			return nil
+		}
+		// Nothing happened this period, start the next one
+		return db.MarkDigestSent(s.UserID, now, s.LastNotificationID)
+	}
+
+	msg, err := compose(s, notifications, posts)
+	if err != nil {
+		return err
+	}
+	if err := Mailer.Send(msg); err != nil {
+		return err
+	}
+
+	lastID := s.LastNotificationID
+	for _, n := range notifications {
+		if n.NotificationID > lastID {
+			lastID = n.NotificationID
+		}
+	}
+	return db.MarkDigestSent(s.UserID, now, lastID)
+}
+
+// entry is a line of a digest: what happened, and the post it links to.
+type entry struct {
+	Text  string
+	Title string
+	URL   string
+}
+
+// compose renders the text and HTML versions of a digest.
+func compose(s models.DigestSubscriber, notifications []models.Notification, posts []models.Post) (mail.Message, error) {
+	data := struct {
+		Username       string
+		Frequency      string
+		Notifications  []entry
+		Posts          []entry
+		SettingsURL    string
+		UnsubscribeURL string
+	}{
+		Username:       s.Username,
+		Frequency:      s.Frequency,
+		SettingsURL:    BaseURL + "/notifications",
+		UnsubscribeURL: BaseURL + "/unsubscribe?token=" + url.QueryEscape(UnsubscribeToken(s.UserID)),
+	}
+	for _, n := range notifications {
+		e := entry{Text: n.Summary(), Title: n.PostTitle}
+		if link := n.Link(); link != "" {
+			e.URL = BaseURL + link
+		}
+		data.Notifications = append(data.Notifications, e)
+	}
+	for _, p := range posts {
+		data.Posts = append(data.Posts, entry{
+			Text:  fmt.Sprintf("by %s, %d likes, %d comments", p.Username, p.LikeCount, p.CommentCount),
+			Title: p.Title,
+			URL:   BaseURL + models.PostLink(p.PostID),
+		})
+	}
+
+	var text, html bytes.Buffer
+	textTmpl, err := texttemplate.ParseFiles("web/templates/email/digest.txt")
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("failed to parse digest template: %v", err)
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to render digest: %v", err)
+	}
+	htmlTmpl, err := htmltemplate.ParseFiles("web/templates/email/digest.html")
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("failed to parse digest template: %v", err)
+	}
+	if err := htmlTmpl.Execute(&html, data); err != nil {
+		return mail.Message{}, fmt.Errorf("failed to render digest: %v", err)
+	}
+
+	return mail.Message{
+		To:      s.Email,
+		Subject: subject(s.Frequency, notifications),
+		Text:    text.String(),
+		HTML:    html.String(),
+		// One-click unsubscribe as in RFC 8058
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+func subject(frequency string, notifications []models.Notification) string {
+	switch {
+	case frequency == models.DigestDaily:
+		return "Your daily forum digest"
+	case frequency == models.DigestWeekly:
+		return "Your weekly forum digest"
+	case len(notifications) == 1:
+		return strings.TrimSpace(notifications[0].Summary() + " " + notifications[0].PostTitle)
+	}
+	return fmt.Sprintf("%d new notifications on the forum", len(notifications))
+}
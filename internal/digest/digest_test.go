@@ -0,0 +1,187 @@
+package digest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/db"
+	"forum/internal/mail"
+	"forum/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	// db.Init reads the schema, and compose the email templates, relative to the project root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// outbox is a Mailer that keeps what it is given.
+type outbox struct {
+	sent []mail.Message
+}
+
+func (o *outbox) Send(msg mail.Message) error {
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// take returns the messages sent so far and empties the outbox.
+func (o *outbox) take() []mail.Message {
+	sent := o.sent
+	o.sent = nil
+	return sent
+}
+
+// setupDigests opens a fresh database with alice (1) and bob (2), each with a
+// post in the first default category, and sends digests to an outbox.
+func setupDigests(t *testing.T) *outbox {
+	t.Helper()
+	if err := db.Init("file:" + t.Name() + "?mode=memory&cache=shared"); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	// The posts are dated ahead so they count as new in the first digest
+	later := time.Now().Add(time.Hour).UTC()
+	for _, stmt := range []string{
+		`INSERT INTO users (user_id, username, email, password, email_verified) VALUES (1, 'alice', 'alice@example.com', 'x', 1), (2, 'bob', 'bob@example.com', 'x', 1)`,
+		`INSERT INTO posts (post_id, user_id, title, content, created_at) VALUES (1, 1, 'Big news', 'Read this', ?), (2, 2, 'Small news', 'Or this', ?)`,
+		`INSERT INTO post_categories (post_id, category_id) VALUES (1, 1), (2, 1)`,
+		`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (1, 1, 2, 'Wow')`,
+	} {
+		if _, err := db.DB.Exec(stmt, later, later); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	out := &outbox{}
+	saved := Mailer
+	Mailer = out
+	t.Cleanup(func() { Mailer = saved })
+	return out
+}
+
+func TestScheduledDigest(t *testing.T) {
+	out := setupDigests(t)
+	if err := db.SetDigestFrequency(1, models.DigestDaily); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	db.FollowCategory(1, 1)
+	db.NotifyComment(2, 1, 1)
+
+	now := time.Now()
+	SendDue(now)
+	if sent := out.take(); len(sent) != 0 {
+		t.Fatalf("expected no digest before a day has passed, got %d", len(sent))
+	}
+
+	SendDue(now.Add(25 * time.Hour))
+	sent := out.take()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 digest, got %d", len(sent))
+	}
+	msg := sent[0]
+	if msg.To != "alice@example.com" || msg.Subject != "Your daily forum digest" {
+		t.Errorf("unexpected digest %q to %q", msg.Subject, msg.To)
+	}
+	for _, want := range []string{"bob commented on your post", "Big news", "Small news", "by bob, 0 likes, 0 comments"} {
+		if !strings.Contains(msg.Text, want) || !strings.Contains(msg.HTML, want) {
+			t.Errorf("expected %q in both versions of the digest", want)
+		}
+	}
+
+	header := msg.Headers["List-Unsubscribe"]
+	token := header[strings.Index(header, "token=")+len("token=") : len(header)-1]
+	if userID, ok := VerifyUnsubscribeToken(token); !ok || userID != 1 {
+		t.Errorf("expected the unsubscribe link to be signed for alice, got %d %v", userID, ok)
+	}
+
+	// The next one waits another day, and leaves out what was already sent
+	SendDue(now.Add(26 * time.Hour))
+	if sent := out.take(); len(sent) != 0 {
+		t.Errorf("expected no digest an hour later, got %d", len(sent))
+	}
+	SendDue(now.Add(50 * time.Hour))
+	if sent := out.take(); len(sent) != 0 {
+		t.Errorf("expected no digest for a quiet day, got %d", len(sent))
+	}
+}
+
+func TestImmediateDigest(t *testing.T) {
+	out := setupDigests(t)
+
+	// Notifications from before subscribing are not sent
+	db.NotifyReaction(1, intPtr(2), nil, "like")
+	db.SetDigestFrequency(2, models.DigestImmediate)
+	SendDue(time.Now())
+	if sent := out.take(); len(sent) != 0 {
+		t.Fatalf("expected no email for old notifications, got %d", len(sent))
+	}
+
+	db.NotifyReaction(1, nil, intPtr(1), "like")
+	SendDue(time.Now())
+	sent := out.take()
+	if len(sent) != 1 || sent[0].Subject != "alice liked your comment on Big news" {
+		t.Fatalf("expected an email about the like, got %+v", sent)
+	}
+	if strings.Contains(sent[0].Text, "Small news") {
+		t.Error("expected immediate emails to leave out top posts")
+	}
+
+	SendDue(time.Now())
+	if sent := out.take(); len(sent) != 0 {
+		t.Errorf("expected the like to be sent once, got %d", len(sent))
+	}
+
+	// Turning digests off stops them
+	db.SetDigestFrequency(2, models.DigestOff)
+	db.DB.Exec(`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (2, 1, 1, 'Thanks')`)
+	db.NotifyComment(1, 1, 2)
+	SendDue(time.Now())
+	if sent := out.take(); len(sent) != 0 {
+		t.Errorf("expected no email after unsubscribing, got %d", len(sent))
+	}
+}
+
+func TestDigestSkipsBannedAndUnverifiedUsers(t *testing.T) {
+	out := setupDigests(t)
+	db.SetDigestFrequency(1, models.DigestImmediate)
+	db.SetDigestFrequency(2, models.DigestImmediate)
+	db.DB.Exec(`INSERT INTO bans (user_id, banned_by, reason) VALUES (1, 2, 'spam')`)
+	db.DB.Exec(`UPDATE users SET email_verified = 0 WHERE user_id = 2`)
+
+	db.NotifyReaction(1, intPtr(2), nil, "like")
+	db.NotifyReaction(2, intPtr(1), nil, "like")
+	SendDue(time.Now())
+	if sent := out.take(); len(sent) != 0 {
+		t.Fatalf("expected no emails to a banned user or an unconfirmed address, got %d", len(sent))
+	}
+
+	db.DB.Exec(`UPDATE bans SET lifted_at = CURRENT_TIMESTAMP WHERE user_id = 1`)
+	SendDue(time.Now())
+	if sent := out.take(); len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Errorf("expected an email to alice once the ban is lifted, got %+v", sent)
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	token := UnsubscribeToken(42)
+	if userID, ok := VerifyUnsubscribeToken(token); !ok || userID != 42 {
+		t.Fatalf("expected the token to verify for user 42, got %d %v", userID, ok)
+	}
+	for _, bad := range []string{"", "42", "43" + token[2:], token + "x", "0." + token[3:]} {
+		if _, ok := VerifyUnsubscribeToken(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
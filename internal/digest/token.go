@@ -0,0 +1,52 @@
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// Secret signs unsubscribe tokens. It is random unless LoadConfig finds one in
+// the environment.
+var Secret = randomSecret()
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("digest: failed to generate secret: " + err.Error())
+	}
+	return b
+}
+
+// UnsubscribeToken returns the token of a user's one-click unsubscribe link. It
+// stays valid for as long as Secret does.
+func UnsubscribeToken(userID int) string {
+	id := strconv.Itoa(userID)
+	return id + "." + sign(id)
+}
+
+// VerifyUnsubscribeToken returns the user an unsubscribe token was made for, or
+// false when it was not signed with Secret.
+func VerifyUnsubscribeToken(token string) (int, bool) {
+	id, signature, found := strings.Cut(token, ".")
+	if !found {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil || userID <= 0 {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(id))) {
+		return 0, false
+	}
+	return userID, true
+}
+
+func sign(id string) string {
+	mac := hmac.New(sha256.New, Secret)
+	mac.Write([]byte("unsubscribe:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
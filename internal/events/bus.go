@@ -0,0 +1,113 @@
+// Package events is an in-process bus carrying changes to posts, comments and
+// reactions to the pages that stream them live.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Event types.
+const (
+	PostCreated    = "post.created"
+	PostUpdated    = "post.updated"
+	PostDeleted    = "post.deleted"
+	CommentCreated = "comment.created"
+	CommentUpdated = "comment.updated"
+	CommentDeleted = "comment.deleted"
+	Reaction       = "reaction"
+)
+
+// Event is a change to a post, one of its comments or their reactions.
+// CategoryIDs are the categories of the post, used to filter and to check who may
+// see the event.
+type Event struct {
+	ID          uint64      `json:"id"`
+	Type        string      `json:"type"`
+	PostID      int         `json:"post_id"`
+	CommentID   int         `json:"comment_id,omitempty"`
+	CategoryIDs []int       `json:"category_ids"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+// bufferSize is how many events a subscriber may fall behind before further
+// events to it are dropped.
+const bufferSize = 64
+
+// Bus fans events out to its subscribers. Publishing never blocks: a subscriber
+// whose buffer is full misses the event rather than slowing everyone down.
+type Bus struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription receives the events matching its filter on C until closed.
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	filter  func(Event) bool
+	bus     *Bus
+	dropped uint64
+	once    sync.Once
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Default is the bus of the running server.
+var Default = NewBus()
+
+// Subscribe registers a subscriber for the events filter accepts, all of them when
+// filter is nil. The filter runs on the publishing goroutine and must be quick.
+func (b *Bus) Subscribe(filter func(Event) bool) *Subscription {
+	c := make(chan Event, bufferSize)
+	s := &Subscription{C: c, c: c, filter: filter, bus: b}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish numbers the event and hands it to every matching subscriber.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e.ID = b.nextID
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Subscribers returns how many subscriptions are open.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close unregisters the subscription and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// Dropped returns how many events were dropped because the subscriber fell behind.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
@@ -0,0 +1,62 @@
+package events
+
+import "testing"
+
+func TestBusFiltersAndNumbersEvents(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(nil)
+	defer all.Close()
+	onePost := bus.Subscribe(func(e Event) bool { return e.PostID == 2 })
+	defer onePost.Close()
+
+	bus.Publish(Event{Type: PostCreated, PostID: 1})
+	bus.Publish(Event{Type: CommentCreated, PostID: 2, CommentID: 7})
+
+	for i, want := range []int{1, 2} {
+		e := <-all.C
+		if e.PostID != want || e.ID != uint64(i+1) {
+			t.Errorf("event %d: got post %d with ID %d", i, e.PostID, e.ID)
+		}
+	}
+	if e := <-onePost.C; e.PostID != 2 || e.CommentID != 7 || e.ID != 2 {
+		t.Errorf("filtered subscriber got %+v", e)
+	}
+	select {
+	case e := <-onePost.C:
+		t.Errorf("filtered subscriber got unexpected %+v", e)
+	default:
+	}
+}
+
+func TestBusDropsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(nil)
+	defer sub.Close()
+
+	for i := 0; i < bufferSize+5; i++ {
+		bus.Publish(Event{Type: Reaction, PostID: 1})
+	}
+	if got := sub.Dropped(); got != 5 {
+		t.Errorf("expected 5 dropped events, got %d", got)
+	}
+	if got := len(sub.C); got != bufferSize {
+		t.Errorf("expected %d buffered events, got %d", bufferSize, got)
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(nil)
+	if got := bus.Subscribers(); got != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", got)
+	}
+	sub.Close()
+	sub.Close()
+	if got := bus.Subscribers(); got != 0 {
+		t.Errorf("expected 0 subscribers after Close, got %d", got)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("expected C to be closed")
+	}
+	bus.Publish(Event{Type: PostDeleted, PostID: 1})
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"database/sql"
+	"log"
+
+	"forum/internal/db"
+	"forum/internal/feed"
+	"forum/internal/models"
+)
+
+// Counts is the data of Reaction events.
+type Counts struct {
+	Likes    int `json:"likes"`
+	Dislikes int `json:"dislikes"`
+}
+
+// PublishPost publishes a post event on the Default bus. The post is attached as
+// its author sees it, without what is only the author's, except for deletions. Nothing is loaded while nobody listens,
+// and failures are only logged: a missed live update must not fail the request
+// that caused it.
+func PublishPost(typ string, postID int) {
+	if Default.Subscribers() == 0 {
+		return
+	}
+	e := Event{Type: typ, PostID: postID}
+	if !withCategories(&e) {
+		return
+	}
+	if typ != PostDeleted {
+		authorID, err := db.PostAuthor(postID)
+		if err != nil {
+			log.Printf("events: %v", err)
+			return
+		}
+		posts, err := feed.ListPosts(feed.Options{ViewerID: authorID, PostID: postID, SkipComments: true})
+		if err != nil {
+			log.Printf("events: %v", err)
+			return
+		}
+		if len(posts) == 1 {
+			e.Data = shared(posts[0])
+		}
+	}
+	Default.Publish(e)
+}
+
+// shared clears the fields of a post that belong to the viewer it was loaded for,
+// since events go to every subscriber.
+func shared(post models.Post) models.Post {
+	post.CanModerate = false
+	post.Saved = false
+	post.Folder = ""
+	post.NewComments = 0
+	post.FirstUnread = 0
+	return post
+}
+
+// PublishComment publishes a comment event on the Default bus, with the comment
+// attached except for deletions.
+func PublishComment(typ string, postID, commentID int) {
+	if Default.Subscribers() == 0 {
+		return
+	}
+	e := Event{Type: typ, PostID: postID, CommentID: commentID}
+	if !withCategories(&e) {
+		return
+	}
+	if typ != CommentDeleted {
+		comment, err := feed.Comment(commentID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("events: %v", err)
+			return
+		} else if err == nil {
+			e.Data = comment
+		}
+	}
+	Default.Publish(e)
+}
+
+// PublishReaction publishes the new reaction counts of a post, or of a comment
+// when commentID is set, on the Default bus.
+func PublishReaction(postID, commentID int, likes, dislikes int) {
+	if Default.Subscribers() == 0 {
+		return
+	}
+	if postID == 0 {
+		id, err := db.CommentPostID(commentID)
+		if err != nil {
+			log.Printf("events: failed to find post of comment %d: %v", commentID, err)
+			return
+		}
+		postID = id
+	}
+	e := Event{Type: Reaction, PostID: postID, CommentID: commentID, Data: Counts{Likes: likes, Dislikes: dislikes}}
+	if !withCategories(&e) {
+		return
+	}
+	Default.Publish(e)
+}
+
+func withCategories(e *Event) bool {
+	ids, err := db.PostCategoryIDs(e.PostID)
+	if err != nil {
+		log.Printf("events: %v", err)
+		return false
+	}
+	e.CategoryIDs = ids
+	if e.CategoryIDs == nil {
+		e.CategoryIDs = []int{}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"forum/internal/db"
+)
+
+func TestMain(m *testing.M) {
+	// db.Init reads the schema relative to the project root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestPublishPostLeavesOutTheAuthorsData(t *testing.T) {
+	if err := db.Init("file:" + t.Name() + "?mode=memory&cache=shared"); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	defer db.DB.Close()
+	for _, query := range []string{
+		`INSERT INTO users (user_id, username, email, password) VALUES (1, 'alice', 'alice@example.com', 'x'), (2, 'bob', 'bob@example.com', 'x')`,
+		`INSERT INTO posts (post_id, user_id, title, content) VALUES (1, 1, 'Hello', 'World')`,
+		`INSERT INTO bookmarks (user_id, post_id, folder) VALUES (1, 1, 'Private folder')`,
+		`INSERT INTO post_reads (user_id, post_id, last_read_id) VALUES (1, 1, 0)`,
+		`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (1, 1, 2, 'Unread by alice')`,
+	} {
+		if _, err := db.DB.Exec(query); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	// Bob listens, the post is loaded as alice sees it
+	sub := Default.Subscribe(nil)
+	defer sub.Close()
+	PublishPost(PostUpdated, 1)
+
+	e := <-sub.C
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		t.Fatalf("Failed to encode event data: %v", err)
+	}
+	if !strings.Contains(string(data), `"title":"Hello"`) {
+		t.Fatalf("expected the post in the event, got %s", data)
+	}
+	if !strings.Contains(string(data), `"saved":false`) || strings.Contains(string(data), "Private folder") {
+		t.Errorf("expected no bookmark of the author in the event, got %s", data)
+	}
+	if !strings.Contains(string(data), `"new_comments":0`) || strings.Contains(string(data), "first_unread_comment_id") {
+		t.Errorf("expected no read position of the author in the event, got %s", data)
+	}
+}
@@ -0,0 +1,283 @@
+// Package feed reads the lists of posts shown on the home page, category pages
+// and elsewhere, together with their comments and reaction counts.
+package feed
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// Options selects the posts returned by ListPosts. Zero values leave a filter off.
+type Options struct {
+	ViewerID   int // the user reading, 0 for anonymous visitors; only posts they may see are listed
+	CategoryID int // posts in this category or any of its subcategories
+	AuthorID   int // posts written by this user
+	LikedBy    int // posts liked by this user
+	PostID     int // only this post
+	FollowedBy int // posts in the categories this user follows, or their subcategories
+	Following  int // posts by the users this user follows, or in the categories they follow
+	SavedBy    int // posts bookmarked by this user
+
+	SavedFolder string // with SavedBy, only the posts bookmarked into this folder
+
+	Since time.Time // posts created after this time
+
+	Limit        int  // at most this many posts, 0 for all of them
+	Offset       int  // skip this many posts first
+	Top          bool // most liked first instead of pinned and newest first
+	SkipComments bool // leave Comments empty, CommentCount is still set
+}
+
+// unreadComments counts, per post the viewer bound to its parameter opened, the
+// comments others added since they last read it or marked everything read, and
+// finds the first of them. Posts the viewer never opened have none.
+const unreadComments = `SELECT pr.post_id, COUNT(*) AS new_comments, MIN(nc.comment_id) AS first_unread
+		FROM post_reads pr
+		LEFT JOIN read_marks rm ON rm.user_id = pr.user_id
+		JOIN comments nc ON nc.post_id = pr.post_id AND nc.comment_id > MAX(pr.last_read_id, COALESCE(rm.last_read_id, 0))
+		WHERE pr.user_id = ? AND nc.removed = 0 AND nc.user_id != pr.user_id
+		GROUP BY pr.post_id`
+
+// ListPosts returns the posts matching opts with their comments, pinned posts
+// first and then newest first unless opts.Top is set. Removed posts and posts in categories the viewer
+// may not see are never listed.
+func ListPosts(opts Options) ([]models.Post, error) {
+	params := []interface{}{opts.ViewerID, opts.ViewerID}
+
+	// Anonymous visitors have read nothing
+	unreadColumns, unreadJoin := "0, 0", ""
+	if opts.ViewerID != 0 {
+		unreadColumns = "COALESCE(ur.new_comments, 0), COALESCE(ur.first_unread, 0)"
+		unreadJoin = " LEFT JOIN (" + unreadComments + ") ur ON ur.post_id = p.post_id"
+		params = append(params, opts.ViewerID)
+	}
+
+	query := `
+    SELECT p.post_id, p.title, p.content, COALESCE(p.imgurl, "") AS imgurl , u.username, u.user_id, p.pinned, p.locked,
+		COALESCE(GROUP_CONCAT(DISTINCT c.name), '') AS categories,
+		p.created_at, p.updated_at,
+        (SELECT COUNT(*) FROM likes WHERE post_id = p.post_id AND comment_id IS NULL AND like_type = 'like') AS like_count,
+        (SELECT COUNT(*) FROM likes WHERE post_id = p.post_id AND comment_id IS NULL AND like_type = 'dislike') AS dislike_count,
+        (SELECT COUNT(*) FROM comments WHERE post_id = p.post_id AND removed = 0) AS total_comments,
+		EXISTS (SELECT 1 FROM post_categories mpc
+			JOIN category_permissions mcp ON mpc.category_id = mcp.category_id
+			JOIN group_members mgm ON mcp.group_id = mgm.group_id
+			WHERE mpc.post_id = p.post_id AND mcp.can_moderate = 1 AND mgm.user_id = ?) AS can_moderate,
+		(SELECT folder FROM bookmarks WHERE post_id = p.post_id AND user_id = ?) AS bookmark_folder,
+		` + unreadColumns + `
+    FROM posts p
+    JOIN users u ON p.user_id = u.user_id
+	LEFT JOIN post_categories pc ON p.post_id = pc.post_id
+	LEFT JOIN categories c ON pc.category_id = c.category_id` + unreadJoin
+
+	conditions, filterParams := filters(opts)
+	params = append(params, filterParams...)
+
+	query += " WHERE " + strings.Join(conditions, " AND ")
+	if opts.Top {
+		query += " GROUP BY p.post_id ORDER BY like_count DESC, total_comments DESC, p.post_id DESC"
+	} else {
+		query += " GROUP BY p.post_id ORDER BY p.pinned DESC, p.created_at DESC, p.post_id DESC"
+	}
+	if opts.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		params = append(params, opts.Limit, opts.Offset)
+	}
+
+	rows, err := db.DB.Query(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts: %v", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var rawCategories string
+		var folder sql.NullString
+		var post models.Post
+		err := rows.Scan(&post.PostID, &post.Title, &post.Content, &post.Imgurl, &post.Username, &post.UserID, &post.Pinned, &post.Locked, &rawCategories, &post.Created, &post.UpdatedAt, &post.LikeCount, &post.DislikeCount, &post.CommentCount, &post.CanModerate, &folder, &post.NewComments, &post.FirstUnread)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post: %v", err)
+		}
+		post.Categories = []string{}
+		if rawCategories != "" {
+			post.Categories = strings.Split(rawCategories, ",")
+		}
+		post.Saved, post.Folder = folder.Valid, folder.String
+		post.CreatedAt = utils.FormatTime(post.Created)
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read posts: %v", err)
+	}
+
+	if opts.SkipComments {
+		return posts, nil
+	}
+	for i := range posts {
+		if posts[i].Comments, err = Comments(posts[i].PostID); err != nil {
+			return nil, err
+		}
+	}
+	return posts, nil
+}
+
+// CountPosts returns how many posts ListPosts would return for opts without a
+// limit, for paging through them.
+func CountPosts(opts Options) (int, error) {
+	conditions, params := filters(opts)
+	var count int
+	err := db.DB.QueryRow(`SELECT COUNT(*) FROM posts p WHERE `+strings.Join(conditions, " AND "), params...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count posts: %v", err)
+	}
+	return count, nil
+}
+
+// filters returns the conditions on posts aliased p selected by opts with their parameters.
+func filters(opts Options) ([]string, []interface{}) {
+	conditions := []string{"p.removed = 0", db.PostVisible}
+	params := db.VisibilityArgs(opts.ViewerID)
+
+	if opts.CategoryID != 0 {
+		conditions = append(conditions, `p.post_id IN (SELECT post_id FROM post_categories WHERE category_id IN (`+db.SubcategoryIDs+`))`)
+		params = append(params, opts.CategoryID)
+	}
+	if opts.AuthorID != 0 {
+		conditions = append(conditions, "p.user_id = ?")
+		params = append(params, opts.AuthorID)
+	}
+	if opts.LikedBy != 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM likes lk WHERE lk.post_id = p.post_id AND lk.user_id = ? AND lk.like_type = 'like' AND lk.comment_id IS NULL)`)
+		params = append(params, opts.LikedBy)
+	}
+	if opts.PostID != 0 {
+		conditions = append(conditions, "p.post_id = ?")
+		params = append(params, opts.PostID)
+	}
+	if opts.FollowedBy != 0 {
+		conditions = append(conditions, `p.post_id IN (SELECT post_id FROM post_categories WHERE category_id IN (`+db.FollowedCategoryIDs+`))`)
+		params = append(params, opts.FollowedBy)
+	}
+	if opts.Following != 0 {
+		conditions = append(conditions, `(p.user_id IN (`+db.FollowedUserIDs+`)
+			OR p.post_id IN (SELECT post_id FROM post_categories WHERE category_id IN (`+db.FollowedCategoryIDs+`)))`)
+		params = append(params, opts.Following, opts.Following)
+	}
+	if opts.SavedBy != 0 {
+		if opts.SavedFolder != "" {
+			conditions = append(conditions, `p.post_id IN (SELECT post_id FROM bookmarks WHERE user_id = ? AND folder = ?)`)
+			params = append(params, opts.SavedBy, opts.SavedFolder)
+		} else {
+			conditions = append(conditions, `p.post_id IN (SELECT post_id FROM bookmarks WHERE user_id = ?)`)
+			params = append(params, opts.SavedBy)
+		}
+	}
+	if !opts.Since.IsZero() {
+		conditions = append(conditions, "p.created_at > ?")
+		params = append(params, opts.Since.UTC())
+	}
+	return conditions, params
+}
+
+// Comments returns the comments of a post that have not been removed, oldest first.
+func Comments(postID int) ([]models.Comment, error) {
+	return queryComments(`c.post_id = ?`, oldestFirst, 0, 0, postID)
+}
+
+// CommentPage returns up to limit comments of a post starting at offset, oldest
+// first, together with how many comments the post has.
+func CommentPage(postID, limit, offset int) ([]models.Comment, int, error) {
+	var total int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM comments WHERE post_id = ? AND removed = 0`, postID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count comments: %v", err)
+	}
+	comments, err := queryComments(`c.post_id = ?`, oldestFirst, limit, offset, postID)
+	return comments, total, err
+}
+
+// Comment returns a comment that has not been removed. It returns sql.ErrNoRows
+// when there is no such comment.
+func Comment(commentID int) (models.Comment, error) {
+	comments, err := queryComments(`c.comment_id = ?`, oldestFirst, 0, 0, commentID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	if len(comments) == 0 {
+		return models.Comment{}, sql.ErrNoRows
+	}
+	return comments[0], nil
+}
+
+// authorCondition selects the comments of a user on posts the viewer may see and
+// that were not removed. It takes authorArgs.
+const authorCondition = `c.user_id = ? AND p.removed = 0 AND ` + db.PostVisible
+
+func authorArgs(authorID, viewerID int) []interface{} {
+	return append([]interface{}{authorID}, db.VisibilityArgs(viewerID)...)
+}
+
+// AuthorComments returns up to limit comments by a user starting at offset,
+// newest first. Comments on posts the viewer may not see, or that were removed,
+// are left out.
+func AuthorComments(authorID, viewerID, limit, offset int) ([]models.Comment, error) {
+	return queryComments(authorCondition, newestFirst, limit, offset, authorArgs(authorID, viewerID)...)
+}
+
+// CountAuthorComments counts the comments AuthorComments would return without a limit.
+func CountAuthorComments(authorID, viewerID int) (int, error) {
+	var total int
+	err := db.DB.QueryRow(`SELECT COUNT(*) FROM comments c JOIN posts p ON c.post_id = p.post_id
+		WHERE c.removed = 0 AND `+authorCondition, authorArgs(authorID, viewerID)...).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count comments: %v", err)
+	}
+	return total, nil
+}
+
+// Orders for queryComments.
+const (
+	oldestFirst = `c.created_at ASC, c.comment_id ASC`
+	newestFirst = `c.created_at DESC, c.comment_id DESC`
+)
+
+// queryComments reads the comments matching condition in the given order, all of
+// them when limit is 0. The condition may refer to the post as p.
+func queryComments(condition, order string, limit, offset int, args ...interface{}) ([]models.Comment, error) {
+	query := `
+		SELECT c.comment_id, c.post_id, p.title, c.content, u.username, u.user_id, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.comment_id AND like_type = 'like') AS like_count,
+			(SELECT COUNT(*) FROM likes WHERE comment_id = c.comment_id AND like_type = 'dislike') AS dislike_count
+		FROM comments c
+		JOIN users u ON c.user_id = u.user_id
+		JOIN posts p ON c.post_id = p.post_id
+		WHERE c.removed = 0 AND ` + condition + `
+		ORDER BY ` + order
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query comments: %v", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(&comment.CommentID, &comment.PostID, &comment.PostTitle, &comment.Content, &comment.Username, &comment.UserID, &comment.Created, &comment.UpdatedAt, &comment.LikeCount, &comment.DislikeCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %v", err)
+		}
+		comment.CreatedAt = utils.FormatTime(comment.Created)
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"time"
+
+	"forum/internal/account"
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/hub"
+	"forum/internal/utils"
+)
+
+// ExportHandler downloads the current user's data as a ZIP archive of JSON files.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/export" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Built in memory first, so that a failure can still be shown as an error page
+	var buf bytes.Buffer
+	if err := account.Export(&buf, auth.GetCurrentUserID(r)); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to export your data")
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="forum-export-`+time.Now().Format("2006-01-02")+`.zip"`)
+	w.Write(buf.Bytes())
+}
+
+// DeleteAccountHandler schedules the current user's account for deletion after
+// account.GracePeriod and signs them out. They confirm with their password, or
+// with their username for accounts made through GitHub or Google.
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/delete" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	user, err := db.UserByID(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to delete account")
+		return
+	}
+	storedHash, err := db.PasswordHash(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to delete account")
+		return
+	}
+
+	if hasLocalPassword(storedHash) {
+		if !checkPassword(storedHash, r.FormValue("password")) {
+			renderSettings(w, r, http.StatusBadRequest, map[string]string{"delete": "Your password is incorrect"}, "")
+			return
+		}
+	} else if r.FormValue("confirm") != user.Username {
+		renderSettings(w, r, http.StatusBadRequest, map[string]string{"delete": "Type your username to confirm"}, "")
+		return
+	}
+
+	deleteAt := time.Now().Add(account.GracePeriod)
+	if err := db.ScheduleAccountDeletion(userID, deleteAt); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to delete account")
+		return
+	}
+	// Open chats close now, event streams on their next keep-alive
+	hub.Default.Disconnect(userID)
+	http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "", Expires: time.Now().Add(-time.Hour), Path: "/", HttpOnly: true})
+
+	// The user is signed out now, so the page is shown as to a visitor
+	data := struct {
+		page
+		DeleteAt string
+	}{
+		page:     page{Categories: utils.FetchCategories(0)},
+		DeleteAt: deleteAt.Format("January 2, 2006"),
+	}
+	renderPage(w, "account_deleted.html", data)
+}
+
+// CancelDeletionHandler keeps the current user's account that was scheduled for
+// deletion.
+func CancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/delete/cancel" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := db.CancelAccountDeletion(auth.GetCurrentUserID(r)); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to keep account")
+		return
+	}
+	http.Redirect(w, r, "/settings?saved=kept", http.StatusSeeOther)
+}
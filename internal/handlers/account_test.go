@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/db"
+	"forum/internal/utils"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+	hash, _ := utils.HashPassword("Secret-passw0rd")
+	testDB.Exec(`UPDATE users SET password = ? WHERE user_id = 1`, hash)
+	testDB.Exec(`INSERT INTO sessions (session_id, user_id, expires_at) VALUES ('s1', 1, '2030-01-01 00:00:00')`)
+	testDB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix) VALUES (1, 'script', 'hash', 'forum_ab')`)
+
+	if rr := postForm(DeleteAccountHandler, "/settings/delete", "1", url.Values{"password": {"wrong"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a wrong password, got %d", rr.Code)
+	}
+	if at, _ := db.AccountDeletion(1); !at.IsZero() {
+		t.Fatal("expected no deletion without the password")
+	}
+
+	rr := postForm(DeleteAccountHandler, "/settings/delete", "1", url.Values{"password": {"Secret-passw0rd"}})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Your account will be deleted on") {
+		t.Fatalf("expected the deletion to be scheduled, got %d", rr.Code)
+	}
+	if at, _ := db.AccountDeletion(1); at.IsZero() {
+		t.Fatal("expected a scheduled deletion")
+	}
+	var sessions, tokens int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 1`).Scan(&sessions)
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = 1`).Scan(&tokens)
+	if sessions != 0 || tokens != 0 {
+		t.Errorf("expected to be signed out and the tokens revoked, got %d sessions and %d tokens", sessions, tokens)
+	}
+
+	// Signing back in shows the deletion everywhere, and it can be cancelled
+	if body := getAs(HomeHandler, "/", "1").Body.String(); !strings.Contains(body, "Keep my account") {
+		t.Error("expected the scheduled deletion on every page")
+	}
+	if rr := postForm(CancelDeletionHandler, "/settings/delete/cancel", "1", nil); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the deletion to be cancelled, got %d", rr.Code)
+	}
+	if at, _ := db.AccountDeletion(1); !at.IsZero() {
+		t.Error("expected no scheduled deletion after cancelling")
+	}
+
+	// Accounts without a password confirm with their username
+	testDB.Exec(`UPDATE users SET password = 'oauth_placeholder' WHERE user_id = 1`)
+	if rr := postForm(DeleteAccountHandler, "/settings/delete", "1", url.Values{"confirm": {"someone"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for the wrong username, got %d", rr.Code)
+	}
+	if rr := postForm(DeleteAccountHandler, "/settings/delete", "1", url.Values{"confirm": {"testuser"}}); rr.Code != http.StatusOK {
+		t.Errorf("expected the deletion to be scheduled, got %d", rr.Code)
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+
+	rr := getAs(ExportHandler, "/settings/export", "1")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected a ZIP download, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment;") || !strings.HasPrefix(rr.Body.String(), "PK") {
+		t.Error("expected the archive as an attachment")
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// AdminUsersHandler lists all users with their roles.
+func AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/users" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageUsers) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage users")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT user_id, username, email, role, created_at FROM users ORDER BY user_id`)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch users")
+		return
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Email, &user.Role, &user.CreatedAt); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Error retrieving user data")
+			return
+		}
+		users = append(users, user)
+	}
+
+	data := struct {
+		page
+		Users []models.User
+		Roles []auth.Role
+	}{
+		page:  newPage(r),
+		Users: users,
+		Roles: []auth.Role{auth.RoleUser, auth.RoleModerator, auth.RoleAdmin},
+	}
+
+	renderPage(w, "admin_users.html", data)
+}
+
+// ChangeRoleHandler sets the role of a user.
+func ChangeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/users/role" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageUsers) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage users")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	role, ok := auth.ParseRole(r.FormValue("role"))
+	if !ok {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always at least one admin left
+	if userID == auth.GetCurrentUserID(r) {
+		utils.DisplayError(w, http.StatusBadRequest, "You cannot change your own role")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+	defer tx.Rollback()
+
+	var currentRole string
+	err = tx.QueryRow(`SELECT role FROM users WHERE user_id = ?`, userID).Scan(&currentRole)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`, role, userID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    auth.GetCurrentUserID(r),
+		Action:     "user.role",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     db.Snapshot(map[string]string{"role": currentRole}),
+		After:      db.Snapshot(map[string]string{"role": string(role)}),
+		Reason:     strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+)
+
+func TestRequireRole(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin'), ('mod', 'mod@test.com', 'moderator')`)
+
+	handler := auth.RequireRole(auth.RoleAdmin)(http.HandlerFunc(AdminUsersHandler))
+
+	tests := []struct {
+		name           string
+		userID         string
+		expectedStatus int
+	}{
+		{"anonymous", "", http.StatusSeeOther},
+		{"moderator", "2", http.StatusForbidden},
+		{"admin", "1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/users", nil)
+			if tt.userID != "" {
+				req = auth.SetUserID(req, tt.userID)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestChangeRoleHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin'), ('member', 'member@test.com', 'user')`)
+
+	changeRole := func(userID, targetID, role string) *httptest.ResponseRecorder {
+		form := url.Values{"user_id": {targetID}, "role": {role}}
+		req := httptest.NewRequest("POST", "/admin/users/role", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req = auth.SetUserID(req, userID)
+		rr := httptest.NewRecorder()
+		ChangeRoleHandler(rr, req)
+		return rr
+	}
+
+	if rr := changeRole("1", "2", "moderator"); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var role string
+	testDB.QueryRow(`SELECT role FROM users WHERE user_id = 2`).Scan(&role)
+	if role != "moderator" {
+		t.Errorf("Expected role moderator, got %q", role)
+	}
+
+	if rr := changeRole("1", "2", "superuser"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown role, got %d", rr.Code)
+	}
+	if rr := changeRole("1", "1", "user"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for own role, got %d", rr.Code)
+	}
+	// Moderators are not allowed to hand out roles
+	if rr := changeRole("2", "2", "admin"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for moderator, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+const auditPageSize = 50
+
+// parseAuditFilter reads the audit log filter from the query string. Dates are
+// given as YYYY-MM-DD and the "to" date is inclusive.
+func parseAuditFilter(query url.Values) db.AuditFilter {
+	filter := db.AuditFilter{
+		Actor:      strings.TrimSpace(query.Get("actor")),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+	}
+	filter.TargetID, _ = strconv.Atoi(query.Get("target_id"))
+	if from, err := time.Parse("2006-01-02", query.Get("from")); err == nil {
+		filter.From = from
+	}
+	if to, err := time.Parse("2006-01-02", query.Get("to")); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	return filter
+}
+
+// AuditLogHandler shows the audit log with filters and pagination.
+func AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/audit" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermViewAuditLog) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to view the audit log")
+		return
+	}
+
+	query := r.URL.Query()
+	pageNum, err := strconv.Atoi(query.Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	// Fetch one extra entry to know whether there is a next page
+	entries, err := db.ListAudit(parseAuditFilter(query), auditPageSize+1, (pageNum-1)*auditPageSize)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch audit log")
+		return
+	}
+	hasNext := len(entries) > auditPageSize
+	if hasNext {
+		entries = entries[:auditPageSize]
+	}
+
+	actions, err := db.AuditActions()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch audit log")
+		return
+	}
+
+	// Links to other pages and the export keep the current filters
+	query.Del("page")
+	filterQuery := query.Encode()
+
+	data := struct {
+		page
+		Entries     []models.AuditEntry
+		Actions     []string
+		Filter      url.Values
+		FilterQuery string
+		PageNum     int
+		PrevPage    int
+		NextPage    int
+	}{
+		page:        newPage(r),
+		Entries:     entries,
+		Actions:     actions,
+		Filter:      r.URL.Query(),
+		FilterQuery: filterQuery,
+		PageNum:     pageNum,
+		PrevPage:    pageNum - 1,
+	}
+	if hasNext {
+		data.NextPage = pageNum + 1
+	}
+
+	renderPage(w, "admin_audit.html", data)
+}
+
+// AuditExportHandler downloads the entries matching the filter as CSV.
+func AuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/audit.csv" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermViewAuditLog) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to view the audit log")
+		return
+	}
+
+	entries, err := db.ListAudit(parseAuditFilter(r.URL.Query()), 0, 0)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"audit_id", "created_at", "actor_id", "actor", "action", "target_type", "target_id", "before", "after", "reason"})
+	for _, e := range entries {
+		out.Write([]string{
+			strconv.Itoa(e.AuditID),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(e.ActorID),
+			csvSafe(e.ActorName),
+			e.Action,
+			e.TargetType,
+			strconv.Itoa(e.TargetID),
+			csvSafe(e.Before),
+			csvSafe(e.After),
+			csvSafe(e.Reason),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Println(err)
+	}
+}
+
+// csvSafe stops spreadsheet programs from evaluating user supplied text as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
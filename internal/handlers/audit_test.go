@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+)
+
+func TestAuditLogHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin')`)
+
+	postForm(ModeratePostHandler, "/mod/post/lock", "2", url.Values{"post_id": {"1"}, "reason": {"flame war"}})
+	postForm(ModeratePostHandler, "/mod/post/lock", "2", url.Values{"post_id": {"1"}})
+	postForm(ChangeRoleHandler, "/admin/users/role", "2", url.Values{"user_id": {"1"}, "role": {"moderator"}})
+
+	get := func(handler http.HandlerFunc, target, userID string) *httptest.ResponseRecorder {
+		req := auth.SetUserID(httptest.NewRequest("GET", target, nil), userID)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := get(AuditLogHandler, "/admin/audit?action=post.lock", "2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "flame war") || strings.Contains(body, "post.unlock</td>") {
+		t.Error("Expected only the lock entry to be listed")
+	}
+
+	rr = get(AuditExportHandler, "/admin/audit.csv?target_type=user", "2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected header and one entry, got %d rows", len(records))
+	}
+	if got := records[1]; got[4] != "user.role" || got[7] != `{"role":"user"}` || got[8] != `{"role":"moderator"}` {
+		t.Errorf("Unexpected role change entry: %v", got)
+	}
+
+	// The audit log is for admins only; user 1 is now a moderator
+	if rr := get(AuditLogHandler, "/admin/audit", "1"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rr.Code)
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	if got := csvSafe("=HYPERLINK()"); got != "'=HYPERLINK()" {
+		t.Errorf("Expected formula to be escaped, got %q", got)
+	}
+	if got := csvSafe("spam"); got != "spam" {
+		t.Errorf("Expected plain text to be kept, got %q", got)
+	}
+}
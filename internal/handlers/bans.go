@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// banDurations are the lengths a ban can be given, zero meaning permanent.
+var banDurations = map[string]time.Duration{
+	"1d":        24 * time.Hour,
+	"3d":        3 * 24 * time.Hour,
+	"7d":        7 * 24 * time.Hour,
+	"30d":       30 * 24 * time.Hour,
+	"permanent": 0,
+}
+
+// BansHandler lists the bans in force and lets moderators ban a user.
+func BansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mod/bans" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermBanUsers) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to ban users")
+		return
+	}
+
+	bans, err := db.ActiveBans()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch bans")
+		return
+	}
+
+	data := struct {
+		page
+		Bans []models.Ban
+	}{
+		page: newPage(r),
+		Bans: bans,
+	}
+
+	renderPage(w, "mod_bans.html", data)
+}
+
+// BanUserHandler bans or suspends a user. Moderators can only ban users whose role
+// is below their own.
+func BanUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mod/bans/ban" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermBanUsers) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to ban users")
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	duration, ok := banDurations[r.FormValue("duration")]
+	if username == "" || reason == "" || !ok {
+		utils.DisplayError(w, http.StatusBadRequest, "Username, reason and a valid duration are required")
+		return
+	}
+
+	var userID int
+	err := db.DB.QueryRow(`SELECT user_id FROM users WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+
+	moderatorID := auth.GetCurrentUserID(r)
+	if auth.UserRole(userID).AtLeast(auth.UserRole(moderatorID)) {
+		utils.DisplayError(w, http.StatusForbidden, "You can only ban users with a lower role than yours")
+		return
+	}
+
+	var expiresAt *time.Time
+	after := map[string]interface{}{"banned": true, "permanent": duration == 0}
+	if duration != 0 {
+		expires := time.Now().Add(duration).UTC()
+		expiresAt = &expires
+		after["expires_at"] = expires.Format(time.RFC3339)
+	}
+
+	before, err := db.ActiveBan(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+	defer tx.Rollback()
+
+	if err := db.BanUser(tx, userID, moderatorID, reason, expiresAt); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    moderatorID,
+		Action:     "user.ban",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     db.Snapshot(banSnapshot(before)),
+		After:      db.Snapshot(after),
+		Reason:     reason,
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+
+	http.Redirect(w, r, "/mod/bans", http.StatusSeeOther)
+}
+
+// LiftBanHandler ends the bans in force for a user whose role is below the
+// moderator's own, like BanUserHandler.
+func LiftBanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mod/bans/lift" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermBanUsers) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to ban users")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	before, err := db.ActiveBan(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to lift ban")
+		return
+	}
+	if before == nil {
+		utils.DisplayError(w, http.StatusNotFound, "User is not banned")
+		return
+	}
+
+	moderatorID := auth.GetCurrentUserID(r)
+	if auth.UserRole(userID).AtLeast(auth.UserRole(moderatorID)) {
+		utils.DisplayError(w, http.StatusForbidden, "You can only lift bans on users with a lower role than yours")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to lift ban")
+		return
+	}
+	defer tx.Rollback()
+
+	if err := db.LiftBans(tx, userID, moderatorID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to lift ban")
+		return
+	}
+
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    moderatorID,
+		Action:     "user.unban",
+		TargetType: "user",
+		TargetID:   userID,
+		Before:     db.Snapshot(banSnapshot(before)),
+		After:      db.Snapshot(banSnapshot(nil)),
+		Reason:     strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to lift ban")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to lift ban")
+		return
+	}
+
+	http.Redirect(w, r, "/mod/bans", http.StatusSeeOther)
+}
+
+// banSnapshot describes a user's ban state for the audit log.
+func banSnapshot(ban *models.Ban) map[string]interface{} {
+	if ban == nil {
+		return map[string]interface{}{"banned": false}
+	}
+	snapshot := map[string]interface{}{"banned": true, "permanent": ban.Permanent(), "reason": ban.Reason}
+	if ban.ExpiresAt != nil {
+		snapshot["expires_at"] = ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return snapshot
+}
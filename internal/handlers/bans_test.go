@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/auth"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBanUserHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	hashedPass, _ := bcrypt.GenerateFromPassword([]byte("Secret1!"), bcrypt.MinCost)
+	testDB.Exec(`INSERT INTO users (username, email, password, role) VALUES ('mod', 'mod@test.com', '', 'moderator'), ('troll', 'troll@test.com', ?, 'user'), ('admin', 'admin@test.com', '', 'admin')`, hashedPass)
+	testDB.Exec(`INSERT INTO sessions (session_id, user_id, expires_at) VALUES ('troll-session', 2, ?)`, time.Now().Add(time.Hour))
+
+	rr := postForm(BanUserHandler, "/mod/bans/ban", "1", url.Values{"username": {"troll"}, "reason": {"Spamming links"}, "duration": {"7d"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+
+	var sessions int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 2`).Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("Expected sessions of banned user to be revoked, got %d", sessions)
+	}
+
+	// Logging in shows the ban instead of creating a session
+	rr = postLogin("troll", "Secret1!")
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "Spamming links") {
+		t.Errorf("Expected ban page on login, got status %d", rr.Code)
+	}
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 2`).Scan(&sessions)
+	if sessions != 0 {
+		t.Error("Expected no session to be created for a banned user")
+	}
+
+	// Moderators cannot ban users with an equal or higher role
+	rr = postForm(BanUserHandler, "/mod/bans/ban", "1", url.Values{"username": {"admin"}, "reason": {"no"}, "duration": {"permanent"}})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 when banning an admin, got %d", rr.Code)
+	}
+
+	rr = postForm(LiftBanHandler, "/mod/bans/lift", "1", url.Values{"user_id": {"2"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	if rr := postLogin("troll", "Secret1!"); rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected login to succeed after lifting the ban, got %d", rr.Code)
+	}
+
+	var actions string
+	testDB.QueryRow(`SELECT GROUP_CONCAT(action) FROM audit_log WHERE target_type = 'user' AND target_id = 2`).Scan(&actions)
+	if actions != "user.ban,user.unban" {
+		t.Errorf("Unexpected audit entries: %q", actions)
+	}
+
+	// ...nor lift bans an admin placed on them
+	testDB.Exec(`INSERT INTO users (username, email, password, role) VALUES ('mod2', 'mod2@test.com', '', 'moderator')`)
+	if rr := postForm(BanUserHandler, "/mod/bans/ban", "3", url.Values{"username": {"mod2"}, "reason": {"Abuse"}, "duration": {"7d"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the admin to ban a moderator, got %d", rr.Code)
+	}
+	if rr := postForm(LiftBanHandler, "/mod/bans/lift", "1", url.Values{"user_id": {"4"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 when lifting a moderator's ban, got %d", rr.Code)
+	}
+	if rr := postForm(LiftBanHandler, "/mod/bans/lift", "3", url.Values{"user_id": {"4"}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected the admin to lift it, got %d", rr.Code)
+	}
+}
+
+func TestSessionMiddleware_Banned(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	testDB.Exec(`INSERT INTO users (username, email) VALUES ('troll', 'troll@test.com')`)
+	testDB.Exec(`INSERT INTO sessions (session_id, user_id, expires_at) VALUES ('troll-session', 1, ?)`, time.Now().Add(time.Hour))
+
+	handler := auth.SessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "troll-session"})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// An expired suspension no longer applies
+	testDB.Exec(`INSERT INTO bans (user_id, banned_by, reason, expires_at) VALUES (1, 1, 'old', ?)`, time.Now().Add(-time.Hour).UTC())
+	if rr := send(); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with an expired ban, got %d", rr.Code)
+	}
+
+	testDB.Exec(`INSERT INTO bans (user_id, banned_by, reason) VALUES (1, 1, 'Permanent ban')`)
+	rr := send()
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "has been banned") {
+		t.Errorf("Expected ban page, got status %d", rr.Code)
+	}
+
+	var sessions int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 1`).Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("Expected sessions to be revoked, got %d", sessions)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// maxFolderLength is the longest bookmark folder name, in bytes.
+const maxFolderLength = 50
+
+// BookmarkHandler saves posts for the current user to read later. Like /like it
+// toggles: bookmarking a saved post unsaves it. Naming a folder instead saves the
+// post into that folder.
+func BookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/bookmark" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	var req models.BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.PostID == 0 {
+		utils.DisplayError(w, http.StatusBadRequest, "Missing required fields")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	visible, err := canViewContent(userID, req.PostID, 0)
+	if err != nil {
+		utils.DisplayError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !visible {
+		utils.DisplayError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+
+	saved, folder := true, ""
+	if req.Folder != nil {
+		folder = strings.TrimSpace(*req.Folder)
+		if len(folder) > maxFolderLength {
+			utils.DisplayError(w, http.StatusBadRequest, "Folder name is too long")
+			return
+		}
+		err = db.SaveBookmark(userID, req.PostID, folder)
+	} else {
+		saved, err = db.ToggleBookmark(userID, req.PostID)
+	}
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update bookmark")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Bookmark updated",
+		"saved":   saved,
+		"folder":  folder,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
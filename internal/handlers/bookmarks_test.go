@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"forum/internal/auth"
+)
+
+func bookmark(userID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/bookmark", strings.NewReader(body))
+	req = auth.SetUserID(req, userID)
+	rr := httptest.NewRecorder()
+	BookmarkHandler(rr, req)
+	return rr
+}
+
+func TestBookmarks(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	var result struct {
+		Saved  bool   `json:"saved"`
+		Folder string `json:"folder"`
+	}
+	rr := bookmark("1", `{"post_id": 1}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || !result.Saved {
+		t.Fatalf("expected the post to be saved, got %+v (%v)", result, err)
+	}
+	bookmark("1", `{"post_id": 3, "folder": " Recipes "}`)
+
+	body := getAs(HomeHandler, "/?saved=true", "1").Body.String()
+	if !strings.Contains(body, "Test Post") || !strings.Contains(body, "Liked Post") || strings.Contains(body, "Another Post") {
+		t.Error("expected only the saved posts")
+	}
+	if !strings.Contains(body, `href="/?saved=true&folder=Recipes"`) {
+		t.Error("expected a link to the Recipes folder")
+	}
+	body = getAs(HomeHandler, "/?saved=true&folder=Recipes", "1").Body.String()
+	if !strings.Contains(body, "Liked Post") || strings.Contains(body, "Test Post") {
+		t.Error("expected only the posts in the folder")
+	}
+
+	// Saving is separate from liking, and from other users' bookmarks
+	if body := getAs(HomeHandler, "/?liked=true", "1").Body.String(); strings.Contains(body, "Test Post") {
+		t.Error("expected saving a post not to like it")
+	}
+	if body := getAs(HomeHandler, "/?saved=true", "3").Body.String(); strings.Contains(body, "Test Post") {
+		t.Error("expected other users' bookmarks to be left out")
+	}
+
+	// Bookmarking a saved post again unsaves it
+	rr = bookmark("1", `{"post_id": 1}`)
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || result.Saved {
+		t.Errorf("expected the post to be unsaved, got %+v (%v)", result, err)
+	}
+	if body := getAs(HomeHandler, "/?saved=true", "1").Body.String(); strings.Contains(body, "Test Post") {
+		t.Error("expected the unsaved post to be left out")
+	}
+
+	// Posts in categories the user may not see cannot be saved
+	if rr := bookmark("1", `{"post_id": 2}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a private post, got %d", rr.Code)
+	}
+	if rr := bookmark("1", `{"post_id": 1, "folder": "`+strings.Repeat("x", maxFolderLength+1)+`"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a long folder name, got %d", rr.Code)
+	}
+}
+
+func TestBookmarksParallel(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	// Double clicks toggle twice rather than failing on the existing bookmark
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- bookmark("1", `{"post_id": 1}`).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected status 200 for every toggle, got %d", code)
+		}
+	}
+	var count int
+	testDB.QueryRow(`SELECT COUNT(*) FROM bookmarks WHERE user_id = 1 AND post_id = 1`).Scan(&count)
+	if count != 0 {
+		t.Errorf("expected an even number of toggles to leave the post unsaved, got %d bookmarks", count)
+	}
+}
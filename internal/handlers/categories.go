@@ -0,0 +1,546 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/hub"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// requestError is returned by actions that fail because of the request rather than
+// the server, it carries the status and message shown to the user.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// adminAction applies one change inside tx. It returns the audit entry describing
+// the change, or nil when nothing changed.
+type adminAction func(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error)
+
+// categoryActions maps the last path segment of /admin/categories/... to its action.
+var categoryActions = map[string]adminAction{
+	"create":  createCategory,
+	"update":  updateCategory,
+	"move":    moveCategory,
+	"merge":   mergeCategory,
+	"archive": archiveCategory,
+	"privacy": toggleCategoryPrivacy,
+	"grant":   grantCategoryAccess,
+	"revoke":  revokeCategoryAccess,
+}
+
+// AdminCategoriesHandler lists every category, archived ones included, with the
+// forms to manage them.
+func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/categories" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageCategories) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage categories")
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT c.category_id, COALESCE(c.parent_id, 0), c.name, COALESCE(c.slug, ''), COALESCE(c.description, ''), c.sort_order, c.archived, c.private,
+			(SELECT COUNT(*) FROM post_categories pc JOIN posts p ON pc.post_id = p.post_id
+			 WHERE pc.category_id = c.category_id AND p.removed = 0) AS post_count
+		FROM categories c
+		ORDER BY c.sort_order, c.name`)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch categories")
+		return
+	}
+	defer rows.Close()
+
+	var categories []models.Categories
+	for rows.Next() {
+		var c models.Categories
+		if err := rows.Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Slug, &c.Description, &c.SortOrder, &c.Archived, &c.Private, &c.PostCount); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Error retrieving category data")
+			return
+		}
+		categories = append(categories, c)
+	}
+
+	groups, err := db.Groups()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch groups")
+		return
+	}
+	grants, err := db.CategoryGrants()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category permissions")
+		return
+	}
+
+	data := struct {
+		page
+		AllCategories []models.Categories
+		Groups        []models.Group
+		Grants        map[int][]models.CategoryGrant
+	}{
+		page:          newPage(r),
+		AllCategories: models.SortTree(categories),
+		Groups:        groups,
+		Grants:        grants,
+	}
+
+	renderPage(w, "admin_categories.html", data)
+}
+
+// CategoryActionHandler applies a change to the categories and records it in the
+// audit log. The action is taken from the path, e.g. /admin/categories/merge.
+func CategoryActionHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/admin/categories/")
+	action, ok := categoryActions[name]
+	if !ok {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageCategories) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage categories")
+		return
+	}
+
+	if runAdminAction(w, r, action, "category", "/admin/categories") && name == "merge" {
+		// The chat room of a merged category is gone, its history moved to the target
+		id, _ := strconv.Atoi(r.FormValue("category_id"))
+		hub.Default.CloseRoom(id)
+	}
+}
+
+// runAdminAction runs action in a transaction together with its audit entry, then
+// redirects to the given page. It reports whether the action was saved.
+func runAdminAction(w http.ResponseWriter, r *http.Request, action adminAction, targetType, redirect string) bool {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to save changes")
+		return false
+	}
+	defer tx.Rollback()
+
+	entry, err := action(tx, r)
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		utils.DisplayError(w, reqErr.status, reqErr.message)
+		return false
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to save changes")
+		return false
+	}
+
+	if entry != nil {
+		entry.ActorID = auth.GetCurrentUserID(r)
+		entry.TargetType = targetType
+		entry.Reason = strings.TrimSpace(r.FormValue("reason"))
+		if err := db.RecordAudit(tx, *entry); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Failed to save changes")
+			return false
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to save changes")
+		return false
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+	return true
+}
+
+// createCategory adds a category at the end of the list.
+func createCategory(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	fields, err := categoryFields(tx, r, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO categories (parent_id, name, slug, description, sort_order)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM categories))`,
+		nullableID(fields.ParentID), fields.Name, fields.Slug, fields.Description)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEntry{
+		Action:   "category.create",
+		TargetID: int(id),
+		After:    db.Snapshot(categorySnapshot(fields)),
+	}, nil
+}
+
+// updateCategory renames a category and changes its slug, description and parent.
+func updateCategory(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	current, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+	fields, err := categoryFields(tx, r, current.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE categories SET parent_id = ?, name = ?, slug = ?, description = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`,
+		nullableID(fields.ParentID), fields.Name, fields.Slug, fields.Description, current.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEntry{
+		Action:   "category.update",
+		TargetID: current.CategoryID,
+		Before:   db.Snapshot(categorySnapshot(current)),
+		After:    db.Snapshot(categorySnapshot(fields)),
+	}, nil
+}
+
+// moveCategory swaps the position of a category with the sibling above or below it.
+func moveCategory(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	current, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	var query string
+	switch r.FormValue("direction") {
+	case "up":
+		query = `SELECT category_id, sort_order FROM categories
+			WHERE COALESCE(parent_id, 0) = ? AND (sort_order < ? OR (sort_order = ? AND name < ?))
+			ORDER BY sort_order DESC, name DESC LIMIT 1`
+	case "down":
+		query = `SELECT category_id, sort_order FROM categories
+			WHERE COALESCE(parent_id, 0) = ? AND (sort_order > ? OR (sort_order = ? AND name > ?))
+			ORDER BY sort_order, name LIMIT 1`
+	default:
+		return nil, &requestError{http.StatusBadRequest, "Invalid direction"}
+	}
+
+	var neighbourID, neighbourOrder int
+	err = tx.QueryRow(query, current.ParentID, current.SortOrder, current.SortOrder, current.Name).Scan(&neighbourID, &neighbourOrder)
+	if err == sql.ErrNoRows {
+		// Already first or last
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Equal positions are split so the swap always changes the order
+	newOrder := neighbourOrder
+	if newOrder == current.SortOrder {
+		if r.FormValue("direction") == "up" {
+			newOrder--
+		} else {
+			newOrder++
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE categories SET sort_order = ? WHERE category_id = ?`, current.SortOrder, neighbourID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE categories SET sort_order = ? WHERE category_id = ?`, newOrder, current.CategoryID); err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEntry{
+		Action:   "category.reorder",
+		TargetID: current.CategoryID,
+		Before:   db.Snapshot(map[string]int{"sort_order": current.SortOrder}),
+		After:    db.Snapshot(map[string]int{"sort_order": newOrder}),
+	}, nil
+}
+
+// mergeCategory moves every post, subcategory, chat message and follower of a
+// category into another one and deletes it.
+func mergeCategory(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	source, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+	target, err := loadCategory(tx, r.FormValue("target_id"))
+	if err != nil {
+		return nil, err
+	}
+	nested, err := db.IsSubcategory(tx, target.CategoryID, source.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if nested {
+		return nil, &requestError{http.StatusBadRequest, "A category cannot be merged into itself or its subcategories"}
+	}
+
+	var moved int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM post_categories WHERE category_id = ?`, source.CategoryID).Scan(&moved); err != nil {
+		return nil, err
+	}
+
+	// Posts already in both categories keep their single row in the target
+	_, err = tx.Exec(`INSERT OR IGNORE INTO post_categories (post_id, category_id)
+		SELECT post_id, ? FROM post_categories WHERE category_id = ?`, target.CategoryID, source.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM post_categories WHERE category_id = ?`, source.CategoryID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE categories SET parent_id = ? WHERE parent_id = ?`, target.CategoryID, source.CategoryID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE chat_messages SET category_id = ? WHERE category_id = ?`, target.CategoryID, source.CategoryID); err != nil {
+		return nil, err
+	}
+	// Followers of both categories keep their single follow of the target
+	_, err = tx.Exec(`INSERT OR IGNORE INTO category_follows (user_id, category_id)
+		SELECT user_id, ? FROM category_follows WHERE category_id = ?`, target.CategoryID, source.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM category_follows WHERE category_id = ?`, source.CategoryID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM category_permissions WHERE category_id = ?`, source.CategoryID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM categories WHERE category_id = ?`, source.CategoryID); err != nil {
+		return nil, err
+	}
+
+	before := categorySnapshot(source)
+	before["posts"] = strconv.Itoa(moved)
+	return &models.AuditEntry{
+		Action:   "category.merge",
+		TargetID: source.CategoryID,
+		Before:   db.Snapshot(before),
+		After:    db.Snapshot(map[string]int{"merged_into": target.CategoryID}),
+	}, nil
+}
+
+// archiveCategory toggles whether a category is archived. Archived categories keep
+// their posts but are no longer offered in filters or when posting.
+func archiveCategory(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	current, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE categories SET archived = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`, !current.Archived, current.CategoryID); err != nil {
+		return nil, err
+	}
+
+	action := "category.archive"
+	if current.Archived {
+		action = "category.unarchive"
+	}
+	return &models.AuditEntry{
+		Action:   action,
+		TargetID: current.CategoryID,
+		Before:   db.Snapshot(map[string]bool{"archived": current.Archived}),
+		After:    db.Snapshot(map[string]bool{"archived": !current.Archived}),
+	}, nil
+}
+
+// toggleCategoryPrivacy makes a category private or public again. Private
+// categories are only visible to admins and the groups granted view permission.
+func toggleCategoryPrivacy(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	current, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE categories SET private = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`, !current.Private, current.CategoryID); err != nil {
+		return nil, err
+	}
+
+	action := "category.private"
+	if current.Private {
+		action = "category.public"
+	}
+	return &models.AuditEntry{
+		Action:   action,
+		TargetID: current.CategoryID,
+		Before:   db.Snapshot(map[string]bool{"private": current.Private}),
+		After:    db.Snapshot(map[string]bool{"private": !current.Private}),
+	}, nil
+}
+
+// grantCategoryAccess sets what the members of a group may do in a category.
+func grantCategoryAccess(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	category, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+	group, err := loadGroup(tx, r.FormValue("group_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	grant := models.CategoryGrant{
+		CategoryID:  category.CategoryID,
+		GroupID:     group.GroupID,
+		CanView:     r.FormValue("can_view") != "",
+		CanPost:     r.FormValue("can_post") != "",
+		CanComment:  r.FormValue("can_comment") != "",
+		CanModerate: r.FormValue("can_moderate") != "",
+	}
+	_, err = tx.Exec(`
+		INSERT INTO category_permissions (category_id, group_id, can_view, can_post, can_comment, can_moderate)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (category_id, group_id) DO UPDATE SET
+			can_view = excluded.can_view, can_post = excluded.can_post,
+			can_comment = excluded.can_comment, can_moderate = excluded.can_moderate`,
+		grant.CategoryID, grant.GroupID, grant.CanView, grant.CanPost, grant.CanComment, grant.CanModerate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEntry{
+		Action:   "category.grant",
+		TargetID: category.CategoryID,
+		After: db.Snapshot(map[string]interface{}{
+			"group": group.Name, "view": grant.CanView, "post": grant.CanPost,
+			"comment": grant.CanComment, "moderate": grant.CanModerate,
+		}),
+	}, nil
+}
+
+// revokeCategoryAccess removes every permission of a group in a category.
+func revokeCategoryAccess(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	category, err := loadCategory(tx, r.FormValue("category_id"))
+	if err != nil {
+		return nil, err
+	}
+	group, err := loadGroup(tx, r.FormValue("group_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM category_permissions WHERE category_id = ? AND group_id = ?`, category.CategoryID, group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+
+	return &models.AuditEntry{
+		Action:   "category.revoke",
+		TargetID: category.CategoryID,
+		Before:   db.Snapshot(map[string]string{"group": group.Name}),
+	}, nil
+}
+
+// loadCategory reads the category with the ID given in a form value.
+func loadCategory(tx *sql.Tx, idValue string) (models.Categories, error) {
+	var c models.Categories
+	id, err := strconv.Atoi(idValue)
+	if err != nil {
+		return c, &requestError{http.StatusBadRequest, "Invalid category ID"}
+	}
+
+	err = tx.QueryRow(`SELECT category_id, COALESCE(parent_id, 0), name, COALESCE(slug, ''), COALESCE(description, ''), sort_order, archived, private FROM categories WHERE category_id = ?`, id).
+		Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Slug, &c.Description, &c.SortOrder, &c.Archived, &c.Private)
+	if err == sql.ErrNoRows {
+		return c, &requestError{http.StatusNotFound, "Category not found"}
+	}
+	return c, err
+}
+
+// categoryFields validates the name, slug, description and parent submitted for the
+// category with the given ID, 0 for a new one. An empty slug is derived from the
+// name and an empty parent makes it a top level category.
+func categoryFields(tx *sql.Tx, r *http.Request, categoryID int) (models.Categories, error) {
+	c := models.Categories{
+		CategoryID:  categoryID,
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+	if c.Name == "" {
+		return c, &requestError{http.StatusBadRequest, "Category name is required"}
+	}
+
+	var nameTaken bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM categories WHERE name = ? COLLATE NOCASE AND category_id != ?)`, c.Name, categoryID).Scan(&nameTaken)
+	if err != nil {
+		return c, err
+	}
+	if nameTaken {
+		return c, &requestError{http.StatusBadRequest, "A category with that name already exists"}
+	}
+
+	if parent := r.FormValue("parent_id"); parent != "" && parent != "0" {
+		p, err := loadCategory(tx, parent)
+		if err != nil {
+			return c, err
+		}
+		// A category cannot move below itself
+		if categoryID != 0 {
+			nested, err := db.IsSubcategory(tx, p.CategoryID, categoryID)
+			if err != nil {
+				return c, err
+			}
+			if nested {
+				return c, &requestError{http.StatusBadRequest, "A category cannot be its own subcategory"}
+			}
+		}
+		c.ParentID = p.CategoryID
+	}
+
+	if slug := strings.TrimSpace(r.FormValue("slug")); slug != "" {
+		c.Slug = db.Slugify(slug)
+		taken, err := db.SlugTaken(tx, c.Slug, categoryID)
+		if err != nil {
+			return c, err
+		}
+		if taken {
+			return c, &requestError{http.StatusBadRequest, "The slug " + c.Slug + " is already in use"}
+		}
+	} else {
+		c.Slug, err = db.UniqueSlug(tx, c.Name, categoryID)
+		if err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// categorySnapshot is the part of a category recorded in the audit log.
+func categorySnapshot(c models.Categories) map[string]string {
+	return map[string]string{
+		"name":        c.Name,
+		"slug":        c.Slug,
+		"description": c.Description,
+		"parent":      strconv.Itoa(c.ParentID),
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCategoryActionHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`UPDATE categories SET slug = 'test-category', sort_order = 1 WHERE category_id = 1`)
+	testDB.Exec(`UPDATE categories SET slug = 'another-category', sort_order = 2 WHERE category_id = 2`)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin')`)
+
+	create := url.Values{"name": {"Go & Rust"}, "description": {"Systems languages"}}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/create", "1", create); rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a regular user, got %d", rr.Code)
+	}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/create", "2", create); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+
+	var slug string
+	var sortOrder int
+	testDB.QueryRow(`SELECT slug, sort_order FROM categories WHERE name = 'Go & Rust'`).Scan(&slug, &sortOrder)
+	if slug != "go-rust" || sortOrder != 3 {
+		t.Errorf("Expected slug go-rust at position 3, got %q at %d", slug, sortOrder)
+	}
+
+	if rr := postForm(CategoryActionHandler, "/admin/categories/create", "2", url.Values{"name": {"test category"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a duplicate name, got %d", rr.Code)
+	}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/create", "2", url.Values{"name": {"New"}, "slug": {"Test Category"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a duplicate slug, got %d", rr.Code)
+	}
+
+	update := url.Values{"category_id": {"1"}, "name": {"Renamed"}, "slug": {""}, "description": {"Now described"}}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/update", "2", update); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var name, description string
+	testDB.QueryRow(`SELECT name, slug, description FROM categories WHERE category_id = 1`).Scan(&name, &slug, &description)
+	if name != "Renamed" || slug != "renamed" || description != "Now described" {
+		t.Errorf("Unexpected category after update: %q %q %q", name, slug, description)
+	}
+
+	if rr := postForm(CategoryActionHandler, "/admin/categories/move", "2", url.Values{"category_id": {"2"}, "direction": {"up"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var first int
+	testDB.QueryRow(`SELECT category_id FROM categories ORDER BY sort_order LIMIT 1`).Scan(&first)
+	if first != 2 {
+		t.Errorf("Expected category 2 first after moving it up, got %d", first)
+	}
+
+	if rr := postForm(CategoryActionHandler, "/admin/categories/archive", "2", url.Values{"category_id": {"3"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var archived bool
+	testDB.QueryRow(`SELECT archived FROM categories WHERE category_id = 3`).Scan(&archived)
+	if !archived {
+		t.Error("Expected category 3 to be archived")
+	}
+
+	if rr := postForm(CategoryActionHandler, "/admin/categories/merge", "2", url.Values{"category_id": {"1"}, "target_id": {"1"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when merging into itself, got %d", rr.Code)
+	}
+	testDB.Exec(`INSERT INTO chat_messages (category_id, user_id, content) VALUES (1, 1, 'Hello')`)
+	testDB.Exec(`INSERT INTO category_follows (user_id, category_id) VALUES (1, 1), (2, 1), (2, 2)`)
+	if rr := postForm(CategoryActionHandler, "/admin/categories/merge", "2", url.Values{"category_id": {"1"}, "target_id": {"2"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var remaining, moved int
+	testDB.QueryRow(`SELECT COUNT(*) FROM categories WHERE category_id = 1`).Scan(&remaining)
+	testDB.QueryRow(`SELECT COUNT(*) FROM post_categories WHERE category_id = 2 AND post_id = 1`).Scan(&moved)
+	if remaining != 0 || moved != 1 {
+		t.Errorf("Expected category 1 merged into 2, got %d left and %d moved", remaining, moved)
+	}
+	var messages int
+	testDB.QueryRow(`SELECT COUNT(*) FROM chat_messages WHERE category_id = 2`).Scan(&messages)
+	if messages != 1 {
+		t.Errorf("Expected the chat history moved to category 2, got %d messages", messages)
+	}
+	var followers, orphans int
+	testDB.QueryRow(`SELECT COUNT(*) FROM category_follows WHERE category_id = 2`).Scan(&followers)
+	testDB.QueryRow(`SELECT COUNT(*) FROM category_follows WHERE category_id = 1`).Scan(&orphans)
+	if followers != 2 || orphans != 0 {
+		t.Errorf("Expected both followers moved to category 2, got %d followers and %d left behind", followers, orphans)
+	}
+
+	var entries int
+	testDB.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE target_type = 'category'`).Scan(&entries)
+	if entries != 5 {
+		t.Errorf("Expected 5 category audit entries, got %d", entries)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/feed"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// CategoryHandler shows the landing page of a category at /c/{slug}: its
+// description, subcategories with their activity, and the posts in all of them.
+func CategoryHandler(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/c/")
+	if slug == "" || strings.Contains(slug, "/") {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	currentUserID := auth.GetCurrentUserID(r)
+
+	category, err := db.CategoryBySlug(slug)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+		return
+	}
+
+	// Private categories look the same as missing ones to those who may not see them
+	access, err := db.CategoryAccess(currentUserID, category.CategoryID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+		return
+	}
+	if !access.View {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	var parent *models.Categories
+	if category.ParentID != 0 {
+		p, err := db.CategoryByID(category.ParentID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+			return
+		}
+		if err == nil {
+			parent = &p
+		}
+	}
+
+	subcategories, err := db.ChildCategories(category.CategoryID, currentUserID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch subcategories")
+		return
+	}
+
+	// Counts and activity include everything nested below each category
+	if err := fillActivity(&category, currentUserID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+		return
+	}
+	for i := range subcategories {
+		if err := fillActivity(&subcategories[i], currentUserID); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch subcategories")
+			return
+		}
+	}
+
+	posts, err := feed.ListPosts(feed.Options{ViewerID: currentUserID, CategoryID: category.CategoryID})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch posts")
+		return
+	}
+
+	var following bool
+	if currentUserID != 0 {
+		if following, err = db.FollowsCategory(currentUserID, category.CategoryID); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+			return
+		}
+	}
+
+	data := struct {
+		page
+		Category      models.Categories
+		CanPost       bool
+		Following     bool
+		Parent        *models.Categories
+		Subcategories []models.Categories
+		Posts         []models.Post
+		Reasons       map[string]string
+	}{
+		page:          newPage(r),
+		Category:      category,
+		CanPost:       access.Post,
+		Following:     following,
+		Parent:        parent,
+		Subcategories: subcategories,
+		Posts:         posts,
+		Reasons:       models.ReportReasons,
+	}
+
+	renderPage(w, "category.html", data)
+}
+
+// fillActivity sets the post count and latest activity of a category as seen by a user.
+func fillActivity(c *models.Categories, userID int) error {
+	count, latest, err := db.CategoryActivity(c.CategoryID, userID)
+	if err != nil {
+		return err
+	}
+	c.PostCount = count
+	if !latest.IsZero() {
+		c.LatestActivity = utils.FormatTime(latest)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCategoryHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	// Another Category becomes a subcategory of Test Category
+	testDB.Exec(`UPDATE categories SET slug = 'test-category', description = 'The parent' WHERE category_id = 1`)
+	testDB.Exec(`UPDATE categories SET slug = 'another-category', parent_id = 1 WHERE category_id = 2`)
+
+	req := httptest.NewRequest("GET", "/c/test-category", nil)
+	rr := httptest.NewRecorder()
+	CategoryHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"The parent", "3 posts", "/c/another-category", "Test Post", "Another Post"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the category page", want)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/c/another-category", nil)
+	rr = httptest.NewRecorder()
+	CategoryHandler(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "Another Post") || strings.Contains(body, "Liked Post") {
+		t.Error("Expected the subcategory page to list only its own posts")
+	}
+
+	req = httptest.NewRequest("GET", "/c/missing", nil)
+	rr = httptest.NewRecorder()
+	CategoryHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown category, got %d", rr.Code)
+	}
+
+	// Filtering the home page by the parent includes the subcategory
+	req = httptest.NewRequest("GET", "/?"+url.Values{"category": {"test-category"}}.Encode(), nil)
+	rr = httptest.NewRecorder()
+	HomeHandler(rr, req)
+	if strings.Count(rr.Body.String(), `<div class="post">`) != 3 {
+		t.Errorf("Expected 3 posts when filtering by the parent category")
+	}
+}
+
+func TestCategoryParentCycle(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin')`)
+	testDB.Exec(`UPDATE categories SET parent_id = 1 WHERE category_id = 2`)
+
+	update := url.Values{"category_id": {"1"}, "name": {"Test Category"}, "parent_id": {"2"}}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/update", "2", update); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when moving a category below its child, got %d", rr.Code)
+	}
+	merge := url.Values{"category_id": {"1"}, "target_id": {"2"}}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/merge", "2", merge); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when merging into a subcategory, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/hub"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// ChatHandler serves the chat room of a category: the page at /chat/{slug} and its
+// WebSocket at /chat/{slug}/ws. Rooms are open to those who can see the category;
+// writing in them takes comment permission.
+func ChatHandler(w http.ResponseWriter, r *http.Request) {
+	slug, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/chat/"), "/")
+	if slug == "" || (rest != "" && rest != "ws") {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	currentUserID := auth.GetCurrentUserID(r)
+
+	category, err := db.CategoryBySlug(slug)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+		return
+	}
+	access, err := db.CategoryAccess(currentUserID, category.CategoryID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch category")
+		return
+	}
+	if !access.View {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if rest == "ws" {
+		user, err := db.UserByID(currentUserID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to load user")
+			return
+		}
+		conn, err := hub.Upgrade(w, r)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		hub.Default.Serve(conn, category.CategoryID, user)
+		return
+	}
+
+	data := struct {
+		page
+		Category models.Categories
+		CanWrite bool
+	}{
+		page:     newPage(r),
+		Category: category,
+		CanWrite: access.Comment,
+	}
+
+	renderPage(w, "chat.html", data)
+}
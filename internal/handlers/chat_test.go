@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChatHandler(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	tests := []struct {
+		name   string
+		target string
+		userID string
+		status int
+	}{
+		{"Group member sees the room", "/chat/another-category", "3", http.StatusOK},
+		{"Others do not", "/chat/another-category", "1", http.StatusNotFound},
+		{"Hidden rooms refuse sockets", "/chat/another-category/ws", "1", http.StatusNotFound},
+		{"Unknown category", "/chat/missing", "3", http.StatusNotFound},
+		{"Unknown page", "/chat/another-category/other", "3", http.StatusNotFound},
+		{"Plain request to the socket", "/chat/another-category/ws", "3", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := getAs(ChatHandler, tt.target, tt.userID)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(rr.Body.String(), `data-socket="/chat/another-category/ws"`) {
+				t.Error("expected the page to point at the room's socket")
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/another-category", nil)
+	rr := httptest.NewRecorder()
+	ChatHandler(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected status 405, got %d", rr.Code)
+	}
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"forum/internal/auth"
 	"forum/internal/db"
+	"forum/internal/events"
 	"forum/internal/utils"
 )
 
@@ -35,6 +38,35 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only posts that are visible and not locked accept new comments
+	var locked, removed bool
+	err = db.DB.QueryRow("SELECT locked, removed FROM posts WHERE post_id = ?", postID).Scan(&locked, &removed)
+	if err == sql.ErrNoRows || removed {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return
+	} else if err != nil {
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+
+	access, err := db.PostAccess(auth.GetCurrentUserID(r), postID)
+	if err != nil {
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+	if !access.View {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if !access.Comment {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to comment on this post")
+		return
+	}
+	if locked {
+		utils.DisplayError(w, http.StatusForbidden, "This post is locked, new comments are not allowed")
+		return
+	}
+
 	content := r.FormValue("content")
 	if content == "" || content == " " {
 		utils.DisplayError(w, http.StatusBadRequest, "Content cannot be empty")
@@ -42,11 +74,19 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert comment into database
-	_, err = db.DB.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, content)
+	commentID, err := db.CreateComment(postID, auth.GetCurrentUserID(r), content)
 	if err != nil {
+		log.Println(err)
 		utils.DisplayError(w, http.StatusInternalServerError, "Failed to save comment")
 		return
 	}
+	events.PublishComment(events.CommentCreated, postID, commentID)
+	if err := db.NotifyComment(auth.GetCurrentUserID(r), postID, commentID); err != nil {
+		log.Println(err)
+	}
+	if err := db.NotifyMentions(auth.GetCurrentUserID(r), postID, &commentID, utils.Mentions(content)); err != nil {
+		log.Println(err)
+	}
 
 	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
 }
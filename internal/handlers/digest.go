@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/digest"
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// EmailPreferencesHandler saves how often the current user is emailed about
+// their notifications. Users who never confirmed their email address are sent a
+// link to confirm it, as nothing is emailed to them before.
+func EmailPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/notifications/email" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	frequency := r.FormValue("frequency")
+	if !validFrequency(frequency) {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid email frequency")
+		return
+	}
+	userID := auth.GetCurrentUserID(r)
+	if err := db.SetDigestFrequency(userID, frequency); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save email preferences")
+		return
+	}
+
+	verified, err := db.EmailVerified(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save email preferences")
+		return
+	}
+	if !verified && frequency != models.DigestOff {
+		user, err := db.UserByID(userID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save email preferences")
+			return
+		}
+		// Confirming the current address works like confirming a new one
+		token, err := db.RequestEmailChange(userID, user.Email)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save email preferences")
+			return
+		}
+		if err := digest.Mailer.Send(emailVerificationMessage(user.Email, user.Username, token)); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to send the confirmation email")
+			return
+		}
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// emailVerificationMessage is the email asking to confirm the address digests are
+// sent to.
+func emailVerificationMessage(email, username, token string) mail.Message {
+	link := digest.BaseURL + "/settings/email/verify?token=" + url.QueryEscape(token)
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm that this is your forum email address by opening this link within a day, and the emails you asked for will start:\n\n%s\n\nIf you did not ask for this, ignore this email and none will be sent.\n",
+			username, link),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>Confirm that this is your forum email address by opening <a href=\"%s\">this link</a> within a day, and the emails you asked for will start.</p><p>If you did not ask for this, ignore this email and none will be sent.</p>",
+			template.HTMLEscapeString(username), template.HTMLEscapeString(link)),
+	}
+}
+
+// UnsubscribeHandler turns off the digests of the user an unsubscribe token was
+// made for, without needing them to log in. GET asks for confirmation, so that
+// link scanners do not unsubscribe anyone; POST, also sent by mail clients for
+// one-click unsubscribe, does it.
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/unsubscribe" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.FormValue("token")
+	userID, ok := digest.VerifyUnsubscribeToken(token)
+	if !ok {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid unsubscribe link")
+		return
+	}
+
+	done := r.Method == http.MethodPost
+	if done {
+		if err := db.SetDigestFrequency(userID, models.DigestOff); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to unsubscribe")
+			return
+		}
+	}
+
+	data := struct {
+		page
+		Token string
+		Done  bool
+	}{
+		page:  newPage(r),
+		Token: token,
+		Done:  done,
+	}
+	renderPage(w, "unsubscribe.html", data)
+}
+
+func validFrequency(frequency string) bool {
+	for _, f := range models.DigestFrequencies {
+		if f == frequency {
+			return true
+		}
+	}
+	return false
+}
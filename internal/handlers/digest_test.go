@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/db"
+	"forum/internal/digest"
+	"forum/internal/models"
+)
+
+func TestEmailPreferences(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+
+	if rr := postForm(EmailPreferencesHandler, "/notifications/email", "1", url.Values{"frequency": {"hourly"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown frequency, got %d", rr.Code)
+	}
+	var sent sentMail
+	saved := digest.Mailer
+	digest.Mailer = &sent
+	defer func() { digest.Mailer = saved }()
+
+	if rr := postForm(EmailPreferencesHandler, "/notifications/email", "1", url.Values{"frequency": {"weekly"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the preference to be saved, got %d", rr.Code)
+	}
+	body := getAs(NotificationsHandler, "/notifications", "1").Body.String()
+	if !strings.Contains(body, `value="weekly" selected`) {
+		t.Error("expected the saved frequency to be selected")
+	}
+
+	// The address has to be confirmed before digests go out
+	if !strings.Contains(body, "Emails start once you confirm your address") {
+		t.Error("expected a notice about confirming the address")
+	}
+	if len(sent) != 1 || sent[0].To != "test@example.com" {
+		t.Fatalf("expected a confirmation email to the current address, got %+v", sent)
+	}
+	token := sent[0].Text[strings.Index(sent[0].Text, "token=")+len("token=") : strings.Index(sent[0].Text, "\n\nIf you")]
+	if rr := postForm(VerifyEmailHandler, "/settings/email/verify", "", url.Values{"token": {token}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the address to be confirmed, got %d", rr.Code)
+	}
+	if verified, _ := db.EmailVerified(1); !verified {
+		t.Error("expected the address to be verified")
+	}
+	postForm(EmailPreferencesHandler, "/notifications/email", "1", url.Values{"frequency": {"weekly"}})
+	if len(sent) != 1 {
+		t.Errorf("expected no further confirmation emails, got %d", len(sent))
+	}
+
+	// Unsubscribing asks first, then turns digests off without a login
+	token = digest.UnsubscribeToken(1)
+	req := httptest.NewRequest(http.MethodGet, "/unsubscribe?token="+url.QueryEscape(token), nil)
+	rr := httptest.NewRecorder()
+	UnsubscribeHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="`+token+`"`) {
+		t.Fatalf("expected a confirmation form, got %d", rr.Code)
+	}
+	if frequency, _ := db.DigestFrequency(1); frequency != models.DigestWeekly {
+		t.Errorf("expected GET to leave the frequency alone, got %q", frequency)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe?token="+url.QueryEscape(token), strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	UnsubscribeHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the one-click unsubscribe to succeed, got %d", rr.Code)
+	}
+	if frequency, _ := db.DigestFrequency(1); frequency != models.DigestOff {
+		t.Errorf("expected digests to be off, got %q", frequency)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/unsubscribe?token=1.forged", nil)
+	rr = httptest.NewRecorder()
+	UnsubscribeHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a forged token, got %d", rr.Code)
+	}
+}
+
+func TestFollowCategory(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+	testDB.Exec(`UPDATE categories SET slug = 'test-category' WHERE category_id = 1`)
+
+	rr := postForm(FollowCategoryHandler, "/follow/category", "1", url.Values{"category_id": {"1"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/c/test-category" {
+		t.Fatalf("expected a redirect to the category, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if body := getAs(CategoryHandler, "/c/test-category", "1").Body.String(); !strings.Contains(body, "Unfollow") {
+		t.Error("expected the category page to offer unfollowing")
+	}
+	postForm(UnfollowCategoryHandler, "/unfollow/category", "1", url.Values{"category_id": {"1"}})
+	if follows, _ := db.FollowsCategory(1, 1); follows {
+		t.Error("expected the category to be unfollowed")
+	}
+
+	if rr := postForm(FollowCategoryHandler, "/follow/category", "1", url.Values{"category_id": {"2"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 following a private category, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/utils"
+)
+
+// eventsKeepAlive is how often an idle event stream gets a comment line, so
+// proxies do not close it.
+var eventsKeepAlive = 30 * time.Second
+
+// EventsHandler streams post, comment and reaction events as Server-Sent Events.
+// The post query parameter narrows the stream to one post, category to a category
+// (by slug) and its subcategories. Events about posts the user may not see are
+// left out, and the stream ends once the user is banned or deletes their account.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/events" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.DisplayError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	filter, status, message := eventFilter(r, userID)
+	if status != http.StatusOK {
+		utils.DisplayError(w, status, message)
+		return
+	}
+
+	sub := events.Default.Subscribe(filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if userID != 0 {
+				active, err := accountActive(userID)
+				if err != nil {
+					log.Println(err)
+				} else if !active {
+					return
+				}
+			}
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			// Permissions can change while the stream is open, so they are checked per event
+			visible, err := eventVisible(userID, e)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !visible {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// accountActive reports whether a signed in user is neither banned nor waiting
+// for their account to be deleted.
+func accountActive(userID int) (bool, error) {
+	ban, err := db.ActiveBan(userID)
+	if err != nil || ban != nil {
+		return false, err
+	}
+	deleteAt, err := db.AccountDeletion(userID)
+	return deleteAt.IsZero(), err
+}
+
+// eventFilter builds the subscription filter from the query parameters. Posts and
+// categories the user may not see are reported as not found.
+func eventFilter(r *http.Request, userID int) (func(events.Event) bool, int, string) {
+	if v := r.URL.Query().Get("post"); v != "" {
+		postID, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, http.StatusBadRequest, "Invalid post ID"
+		}
+		access, err := db.PostAccess(userID, postID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, "Failed to load post"
+		}
+		if !access.View {
+			return nil, http.StatusNotFound, "Post not found"
+		}
+		return func(e events.Event) bool { return e.PostID == postID }, http.StatusOK, ""
+	}
+
+	if slug := r.URL.Query().Get("category"); slug != "" {
+		category, err := db.CategoryBySlug(slug)
+		if err == sql.ErrNoRows {
+			return nil, http.StatusNotFound, "Category not found"
+		} else if err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, "Failed to load category"
+		}
+		access, err := db.CategoryAccess(userID, category.CategoryID)
+		if err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, "Failed to load category"
+		}
+		if !access.View {
+			return nil, http.StatusNotFound, "Category not found"
+		}
+
+		rows, err := db.DB.Query(db.SubcategoryIDs, category.CategoryID)
+		if err != nil {
+			log.Println(err)
+			return nil, http.StatusInternalServerError, "Failed to load category"
+		}
+		defer rows.Close()
+		subtree := make(map[int]bool)
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				log.Println(err)
+				return nil, http.StatusInternalServerError, "Failed to load category"
+			}
+			subtree[id] = true
+		}
+
+		return func(e events.Event) bool {
+			for _, id := range e.CategoryIDs {
+				if subtree[id] {
+					return true
+				}
+			}
+			return false
+		}, http.StatusOK, ""
+	}
+
+	return nil, http.StatusOK, ""
+}
+
+// eventVisible reports whether the user may see every category of the event's post.
+func eventVisible(userID int, e events.Event) (bool, error) {
+	for _, id := range e.CategoryIDs {
+		access, err := db.CategoryAccess(userID, id)
+		if err != nil {
+			return false, err
+		}
+		if !access.View {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+)
+
+// openEvents connects to EventsHandler as the given user and waits until the
+// stream is subscribed.
+func openEvents(t *testing.T, query, userID string) *bufio.Reader {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		EventsHandler(w, auth.SetUserID(r, userID))
+	}))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/events" + query)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	stream := bufio.NewReader(resp.Body)
+	if line, err := stream.ReadString('\n'); err != nil || line != "retry: 5000\n" {
+		t.Fatalf("expected retry line, got %q (%v)", line, err)
+	}
+	stream.ReadString('\n')
+	return stream
+}
+
+// nextEvent reads the next event off the stream and returns its lines.
+func nextEvent(t *testing.T, stream *bufio.Reader) []string {
+	t.Helper()
+	done := make(chan []string, 1)
+	go func() {
+		var lines []string
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil {
+				done <- lines
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				done <- lines
+				return
+			}
+			lines = append(lines, line)
+		}
+	}()
+	select {
+	case lines := <-done:
+		return lines
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	t.Run("Skips events the user may not see", func(t *testing.T) {
+		stream := openEvents(t, "", "1")
+		events.PublishReaction(2, 0, 1, 0)
+		events.PublishReaction(1, 0, 3, 1)
+
+		lines := nextEvent(t, stream)
+		if len(lines) != 3 || lines[1] != "event: reaction" {
+			t.Fatalf("unexpected event %q", lines)
+		}
+		if !strings.Contains(lines[2], `"post_id":1`) || !strings.Contains(lines[2], `"likes":3`) {
+			t.Errorf("expected reaction on post 1, got %s", lines[2])
+		}
+	})
+
+	t.Run("Group members see private events", func(t *testing.T) {
+		stream := openEvents(t, "", "3")
+		events.PublishReaction(2, 0, 1, 0)
+
+		lines := nextEvent(t, stream)
+		if len(lines) != 3 || !strings.Contains(lines[2], `"post_id":2`) {
+			t.Errorf("expected reaction on post 2, got %q", lines)
+		}
+	})
+
+	t.Run("Filters by post", func(t *testing.T) {
+		stream := openEvents(t, "?post=3", "1")
+		events.PublishReaction(1, 0, 1, 0)
+		events.PublishComment(events.CommentDeleted, 3, 9)
+
+		lines := nextEvent(t, stream)
+		if len(lines) != 3 || lines[1] != "event: comment.deleted" || !strings.Contains(lines[2], `"comment_id":9`) {
+			t.Errorf("expected comment event on post 3, got %q", lines)
+		}
+	})
+
+	t.Run("Filters by category", func(t *testing.T) {
+		stream := openEvents(t, "?category=another-category", "3")
+		events.PublishReaction(1, 0, 1, 0)
+		events.PublishPost(events.PostDeleted, 2)
+
+		lines := nextEvent(t, stream)
+		if len(lines) != 3 || lines[1] != "event: post.deleted" || !strings.Contains(lines[2], `"post_id":2`) {
+			t.Errorf("expected post 2 event, got %q", lines)
+		}
+	})
+
+	t.Run("Rejects hidden or unknown targets", func(t *testing.T) {
+		tests := []struct {
+			target string
+			status int
+		}{
+			{"/events?post=2", http.StatusNotFound},
+			{"/events?post=abc", http.StatusBadRequest},
+			{"/events?category=another-category", http.StatusNotFound},
+			{"/events?category=missing", http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			if rr := getAs(EventsHandler, tt.target, "1"); rr.Code != tt.status {
+				t.Errorf("%s: expected status %d, got %d", tt.target, tt.status, rr.Code)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/events", nil)
+		rr := httptest.NewRecorder()
+		EventsHandler(rr, req)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST: expected status 405, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Ends when the account is deleted", func(t *testing.T) {
+		interval := eventsKeepAlive
+		eventsKeepAlive = 20 * time.Millisecond
+		t.Cleanup(func() { eventsKeepAlive = interval })
+
+		stream := openEvents(t, "", "3")
+		if err := db.ScheduleAccountDeletion(3, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to schedule deletion: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, stream)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("expected the stream to end")
+		}
+	})
+}
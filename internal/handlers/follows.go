@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/utils"
+)
+
+// FollowCategoryHandler makes the current user follow a category they can see,
+// adding its top posts to their email digests.
+func FollowCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	changeCategoryFollow(w, r, "/follow/category", db.FollowCategory)
+}
+
+// UnfollowCategoryHandler stops the current user following a category.
+func UnfollowCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	changeCategoryFollow(w, r, "/unfollow/category", db.UnfollowCategory)
+}
+
+func changeCategoryFollow(w http.ResponseWriter, r *http.Request, path string, change func(userID, categoryID int) error) {
+	if r.URL.Path != path {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+	category, err := db.CategoryByID(categoryID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update follows")
+		return
+	}
+	access, err := db.CategoryAccess(userID, categoryID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update follows")
+		return
+	}
+	if !access.View {
+		utils.DisplayError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	if err := change(userID, categoryID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update follows")
+		return
+	}
+	http.Redirect(w, r, "/c/"+category.Slug, http.StatusSeeOther)
+}
+
+// FollowUserHandler makes the current user follow another user, adding their
+// posts to the Following feed.
+func FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	changeUserFollow(w, r, "/follow/user", db.FollowUser)
+}
+
+// UnfollowUserHandler stops the current user following another user.
+func UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	changeUserFollow(w, r, "/unfollow/user", db.UnfollowUser)
+}
+
+func changeUserFollow(w http.ResponseWriter, r *http.Request, path string, change func(followerID, followedID int) error) {
+	if r.URL.Path != path {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	followedID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if followedID == userID {
+		utils.DisplayError(w, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+	followed, err := db.UserByID(followedID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update follows")
+		return
+	}
+
+	if err := change(userID, followedID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update follows")
+		return
+	}
+	http.Redirect(w, r, "/u/"+url.PathEscape(followed.Username), http.StatusSeeOther)
+}
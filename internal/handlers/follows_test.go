@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/db"
+)
+
+func TestFollowUser(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+	testDB.Exec(`INSERT INTO posts (post_id, user_id, title, content) VALUES (4, 2, 'Admin Post', 'From the admin')`)
+
+	if rr := postForm(FollowUserHandler, "/follow/user", "3", url.Values{"user_id": {"3"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for following yourself, got %d", rr.Code)
+	}
+	if rr := postForm(FollowUserHandler, "/follow/user", "3", url.Values{"user_id": {"99"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown user, got %d", rr.Code)
+	}
+	rr := postForm(FollowUserHandler, "/follow/user", "3", url.Values{"user_id": {"1"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/u/testuser" {
+		t.Fatalf("expected a redirect to the profile, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	body := getAs(ProfileHandler, "/u/testuser", "3").Body.String()
+	if !strings.Contains(body, "1 followers | 0 following") || !strings.Contains(body, "Unfollow") {
+		t.Error("expected the follow count and an Unfollow button on the profile")
+	}
+
+	// The Following tab lists the posts of followed users that the viewer may see
+	body = getAs(HomeHandler, "/?feed=following", "3").Body.String()
+	for _, want := range []string{"Test Post", "Another Post", "Liked Post"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the Following feed", want)
+		}
+	}
+	if strings.Contains(body, "Admin Post") {
+		t.Error("expected posts by users not followed to be left out")
+	}
+
+	// ...and those in followed categories
+	db.FollowCategory(1, 2)
+	db.FollowUser(1, 2)
+	body = getAs(HomeHandler, "/?feed=following", "1").Body.String()
+	if !strings.Contains(body, "Admin Post") || strings.Contains(body, "Test Post") {
+		t.Error("expected only the followed user's post for testuser")
+	}
+	db.FollowCategory(2, 1)
+	body = getAs(HomeHandler, "/?feed=following", "2").Body.String()
+	if !strings.Contains(body, "Test Post") || !strings.Contains(body, "Liked Post") || strings.Contains(body, "Another Post") {
+		t.Error("expected the posts in the followed category")
+	}
+
+	postForm(UnfollowUserHandler, "/unfollow/user", "3", url.Values{"user_id": {"1"}})
+	if body := getAs(HomeHandler, "/?feed=following", "3").Body.String(); !strings.Contains(body, "Follow people from their profiles") {
+		t.Error("expected an empty Following feed after unfollowing")
+	}
+}
@@ -127,6 +127,11 @@ func GitHubCallbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	
 
+	// Banned users do not get a session
+	if rejectBanned(w, userID) {
+		return
+	}
+
 	// Delete any existing sessions for this user
 	if err := deleteExistingSessions(userID); err != nil {
 		log.Printf("Failed to delete existing sessions: %v", err)
@@ -107,6 +107,11 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Banned users do not get a session
+	if rejectBanned(w, userID) {
+		return
+	}
+
 	sessionID := uuid.New().String()
 	expiration := time.Now().Add(24 * time.Hour)
 
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// groupActions maps the last path segment of /admin/groups/... to its action.
+var groupActions = map[string]adminAction{
+	"create": createGroup,
+	"delete": deleteGroup,
+	"add":    addGroupMember,
+	"remove": removeGroupMember,
+}
+
+// GroupsHandler lists the user groups and their members.
+func GroupsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/groups" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageGroups) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage groups")
+		return
+	}
+
+	groups, err := db.Groups()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch groups")
+		return
+	}
+
+	data := struct {
+		page
+		Groups []models.Group
+	}{
+		page:   newPage(r),
+		Groups: groups,
+	}
+
+	renderPage(w, "admin_groups.html", data)
+}
+
+// GroupActionHandler changes a group or its members. The action is taken from
+// the path, e.g. /admin/groups/add.
+func GroupActionHandler(w http.ResponseWriter, r *http.Request) {
+	action, ok := groupActions[strings.TrimPrefix(r.URL.Path, "/admin/groups/")]
+	if !ok {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermManageGroups) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to manage groups")
+		return
+	}
+
+	runAdminAction(w, r, action, "group", "/admin/groups")
+}
+
+// createGroup adds an empty group.
+func createGroup(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	if name == "" {
+		return nil, &requestError{http.StatusBadRequest, "Group name is required"}
+	}
+
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM groups WHERE name = ? COLLATE NOCASE)`, name).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, &requestError{http.StatusBadRequest, "A group with that name already exists"}
+	}
+
+	result, err := tx.Exec(`INSERT INTO groups (name, description) VALUES (?, ?)`, name, description)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuditEntry{
+		Action:   "group.create",
+		TargetID: int(id),
+		After:    db.Snapshot(map[string]string{"name": name, "description": description}),
+	}, nil
+}
+
+// deleteGroup deletes a group with its memberships and category permissions.
+func deleteGroup(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	group, err := loadGroup(tx, r.FormValue("group_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM category_permissions WHERE group_id = ?`,
+		`DELETE FROM group_members WHERE group_id = ?`,
+		`DELETE FROM groups WHERE group_id = ?`,
+	} {
+		if _, err := tx.Exec(query, group.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.AuditEntry{
+		Action:   "group.delete",
+		TargetID: group.GroupID,
+		Before:   db.Snapshot(map[string]string{"name": group.Name}),
+	}, nil
+}
+
+// addGroupMember adds the user with the submitted username to a group.
+func addGroupMember(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	group, err := loadGroup(tx, r.FormValue("group_id"))
+	if err != nil {
+		return nil, err
+	}
+	username := strings.TrimSpace(r.FormValue("username"))
+
+	var userID int
+	err = tx.QueryRow(`SELECT user_id FROM users WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, &requestError{http.StatusNotFound, "User not found"}
+	} else if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`INSERT OR IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)`, group.GroupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Already a member
+		return nil, nil
+	}
+
+	return &models.AuditEntry{
+		Action:   "group.add_member",
+		TargetID: group.GroupID,
+		After:    db.Snapshot(map[string]string{"username": username}),
+	}, nil
+}
+
+// removeGroupMember removes a user from a group.
+func removeGroupMember(tx *sql.Tx, r *http.Request) (*models.AuditEntry, error) {
+	group, err := loadGroup(tx, r.FormValue("group_id"))
+	if err != nil {
+		return nil, err
+	}
+	username := r.FormValue("username")
+
+	result, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = (SELECT user_id FROM users WHERE username = ?)`, group.GroupID, username)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+
+	return &models.AuditEntry{
+		Action:   "group.remove_member",
+		TargetID: group.GroupID,
+		Before:   db.Snapshot(map[string]string{"username": username}),
+	}, nil
+}
+
+// loadGroup reads the group with the ID given in a form value.
+func loadGroup(tx *sql.Tx, idValue string) (models.Group, error) {
+	var g models.Group
+	id, err := strconv.Atoi(idValue)
+	if err != nil {
+		return g, &requestError{http.StatusBadRequest, "Invalid group ID"}
+	}
+
+	err = tx.QueryRow(`SELECT group_id, name, COALESCE(description, '') FROM groups WHERE group_id = ?`, id).Scan(&g.GroupID, &g.Name, &g.Description)
+	if err == sql.ErrNoRows {
+		return g, &requestError{http.StatusNotFound, "Group not found"}
+	}
+	return g, err
+}
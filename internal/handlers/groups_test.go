@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+)
+
+// insertPrivateCategory makes Another Category (and so Another Post) private and
+// gives the staff group with member 'staffer' (user 3) view and comment access.
+// User 2 is an admin.
+func setupPrivateCategory(t *testing.T) *sql.DB {
+	t.Helper()
+	testDB := setupTestDB(t)
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('admin', 'admin@test.com', 'admin'), ('staffer', 'staffer@test.com', 'user')`)
+	testDB.Exec(`UPDATE categories SET slug = 'another-category' WHERE category_id = 2`)
+
+	steps := []struct {
+		path string
+		form url.Values
+	}{
+		{"/admin/groups/create", url.Values{"name": {"staff"}}},
+		{"/admin/groups/add", url.Values{"group_id": {"1"}, "username": {"staffer"}}},
+		{"/admin/categories/privacy", url.Values{"category_id": {"2"}}},
+		{"/admin/categories/grant", url.Values{"category_id": {"2"}, "group_id": {"1"}, "can_view": {"1"}, "can_comment": {"1"}}},
+	}
+	for _, step := range steps {
+		handler := GroupActionHandler
+		if strings.HasPrefix(step.path, "/admin/categories/") {
+			handler = CategoryActionHandler
+		}
+		if rr := postForm(handler, step.path, "2", step.form); rr.Code != http.StatusSeeOther {
+			t.Fatalf("%s: expected status 303, got %d", step.path, rr.Code)
+		}
+	}
+	return testDB
+}
+
+func getAs(handler http.HandlerFunc, target, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if userID != "" {
+		req = auth.SetUserID(req, userID)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestPrivateCategoryVisibility(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	tests := []struct {
+		name    string
+		userID  string
+		visible bool
+	}{
+		{"anonymous", "", false},
+		{"non-member", "1", false},
+		{"member", "3", true},
+		{"admin", "2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := getAs(HomeHandler, "/", tt.userID).Body.String()
+			if strings.Contains(home, "Another Post") != tt.visible {
+				t.Errorf("Expected private post visible=%v on the home page", tt.visible)
+			}
+			if strings.Contains(home, "/c/another-category") != tt.visible {
+				t.Errorf("Expected private category visible=%v in the sidebar", tt.visible)
+			}
+
+			status := getAs(CategoryHandler, "/c/another-category", tt.userID).Code
+			if (status == http.StatusOK) != tt.visible {
+				t.Errorf("Expected category page visible=%v, got status %d", tt.visible, status)
+			}
+		})
+	}
+}
+
+func TestPrivateCategoryPermissions(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	comment := url.Values{"post_id": {"2"}, "content": {"hello"}}
+	if rr := postForm(CreateCommentHandler, "/comment/create", "1", comment); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 commenting on a hidden post, got %d", rr.Code)
+	}
+	if rr := postForm(CreateCommentHandler, "/comment/create", "3", comment); rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected status 303 for a member with comment access, got %d", rr.Code)
+	}
+
+	if rr := postForm(ModeratePostHandler, "/mod/post/lock", "3", url.Values{"post_id": {"2"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without moderate access, got %d", rr.Code)
+	}
+	grant := url.Values{"category_id": {"2"}, "group_id": {"1"}, "can_view": {"1"}, "can_moderate": {"1"}}
+	if rr := postForm(CategoryActionHandler, "/admin/categories/grant", "2", grant); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	if rr := postForm(ModeratePostHandler, "/mod/post/lock", "3", url.Values{"post_id": {"2"}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected status 303 for a category moderator, got %d", rr.Code)
+	}
+	// Moderating one category does not extend to others
+	if rr := postForm(ModeratePostHandler, "/mod/post/lock", "3", url.Values{"post_id": {"1"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 outside the moderated category, got %d", rr.Code)
+	}
+
+	if rr := postForm(GroupActionHandler, "/admin/groups/remove", "2", url.Values{"group_id": {"1"}, "username": {"staffer"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	if strings.Contains(getAs(HomeHandler, "/", "3").Body.String(), "Another Post") {
+		t.Error("Expected the private post to be hidden after leaving the group")
+	}
+}
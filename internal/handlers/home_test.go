@@ -47,7 +47,13 @@ func setupTestDB(t *testing.T) *sql.DB {
 			user_id INTEGER PRIMARY KEY AUTOINCREMENT,
 			username TEXT UNIQUE,
 			email TEXT UNIQUE,
-			password TEXT
+			password TEXT,
+			bio TEXT,
+			profile_picture TEXT,
+			role TEXT NOT NULL DEFAULT 'user',
+			email_verified INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
 
 		CREATE TABLE IF NOT EXISTS posts (
@@ -55,7 +61,12 @@ func setupTestDB(t *testing.T) *sql.DB {
 			user_id INTEGER,
 			title TEXT,
 			content TEXT,
+			imgurl TEXT,
+			pinned INTEGER NOT NULL DEFAULT 0,
+			locked INTEGER NOT NULL DEFAULT 0,
+			removed INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(user_id) REFERENCES users(user_id)
 		);
 		
@@ -64,14 +75,24 @@ func setupTestDB(t *testing.T) *sql.DB {
 			post_id INTEGER,
 			user_id INTEGER,
 			content TEXT,
+			removed INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(post_id) REFERENCES posts(post_id),
 			FOREIGN KEY(user_id) REFERENCES users(user_id)
 		);
 		
 		CREATE TABLE IF NOT EXISTS categories (
 			category_id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE
+			parent_id INTEGER,
+			name TEXT UNIQUE,
+			slug TEXT UNIQUE,
+			description TEXT,
+			sort_order INTEGER NOT NULL DEFAULT 0,
+			archived INTEGER NOT NULL DEFAULT 0,
+			private INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
 		
 		CREATE TABLE IF NOT EXISTS post_categories (
@@ -88,6 +109,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 			post_id INTEGER,
 			comment_id INTEGER,
 			like_type TEXT CHECK(like_type IN ('like', 'dislike')),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(user_id) REFERENCES users(user_id),
 			FOREIGN KEY(post_id) REFERENCES posts(post_id),
 			FOREIGN KEY(comment_id) REFERENCES comments(comment_id)
@@ -99,6 +121,189 @@ func setupTestDB(t *testing.T) *sql.DB {
 			expires_at DATETIME,
 			FOREIGN KEY(user_id) REFERENCES users(user_id)
 		);
+
+		CREATE TABLE IF NOT EXISTS reports (
+			report_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			reporter_id INTEGER,
+			post_id INTEGER,
+			comment_id INTEGER,
+			reason TEXT,
+			details TEXT,
+			status TEXT NOT NULL DEFAULT 'open',
+			resolved_by INTEGER,
+			resolved_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS audit_log (
+			audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER,
+			action TEXT,
+			target_type TEXT,
+			target_id INTEGER,
+			before_state TEXT,
+			after_state TEXT,
+			reason TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS bans (
+			ban_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			banned_by INTEGER,
+			reason TEXT,
+			expires_at DATETIME,
+			lifted_at DATETIME,
+			lifted_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS groups (
+			group_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE,
+			description TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS group_members (
+			group_id INTEGER,
+			user_id INTEGER,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(group_id, user_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS category_permissions (
+			category_id INTEGER,
+			group_id INTEGER,
+			can_view INTEGER NOT NULL DEFAULT 1,
+			can_post INTEGER NOT NULL DEFAULT 0,
+			can_comment INTEGER NOT NULL DEFAULT 0,
+			can_moderate INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY(category_id, group_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			attempt_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_key TEXT,
+			ip_address TEXT,
+			attempted_at DATETIME
+		);
+
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			scope TEXT NOT NULL DEFAULT 'read',
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS chat_messages (
+			message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			category_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS conversations (
+			conversation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT NOT NULL DEFAULT '',
+			created_by INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS conversation_members (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_read_id INTEGER NOT NULL DEFAULT 0,
+			muted INTEGER NOT NULL DEFAULT 0,
+			joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(conversation_id, user_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS messages (
+			message_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id INTEGER NOT NULL,
+			blocked_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(blocker_id, blocked_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS notifications (
+			notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			actor_id INTEGER,
+			type TEXT NOT NULL,
+			post_id INTEGER,
+			comment_id INTEGER,
+			read_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS category_follows (
+			user_id INTEGER NOT NULL,
+			category_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(user_id, category_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS email_digests (
+			user_id INTEGER PRIMARY KEY,
+			frequency TEXT NOT NULL,
+			sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_notification_id INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS email_changes (
+			user_id INTEGER PRIMARY KEY,
+			email TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS account_deletions (
+			user_id INTEGER PRIMARY KEY,
+			requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			delete_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS user_follows (
+			follower_id INTEGER NOT NULL,
+			followed_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (follower_id, followed_id)
+		);
+		CREATE TABLE IF NOT EXISTS bookmarks (
+			user_id INTEGER NOT NULL,
+			post_id INTEGER NOT NULL,
+			folder TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, post_id)
+		);
+		CREATE TABLE IF NOT EXISTS post_reads (
+			user_id INTEGER NOT NULL,
+			post_id INTEGER NOT NULL,
+			last_read_id INTEGER NOT NULL DEFAULT 0,
+			read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, post_id)
+		);
+		CREATE TABLE IF NOT EXISTS read_marks (
+			user_id INTEGER PRIMARY KEY,
+			last_read_id INTEGER NOT NULL DEFAULT 0,
+			marked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
 	`)
 	if err != nil {
 		t.Fatal("Failed to create tables:", err)
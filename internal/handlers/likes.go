@@ -1,12 +1,13 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"log"
 	"net/http"
 
+	"forum/internal/auth"
 	"forum/internal/db"
+	"forum/internal/events"
 	"forum/internal/models"
 	"forum/internal/utils"
 )
@@ -40,64 +41,40 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine whether it's a post or a comment
-	var existingLikeType string
-	query := `SELECT like_type FROM likes WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`
-	err := db.DB.QueryRow(query, req.UserID, req.PostID, req.CommentID).Scan(&existingLikeType)
-
-	if err == sql.ErrNoRows {
-		// No existing like/dislike → Insert a new reaction
-		insertQuery := `INSERT INTO likes (user_id, post_id, comment_id, like_type) VALUES (?, ?, ?, ?)`
-		_, err = db.DB.Exec(insertQuery, req.UserID, req.PostID, req.CommentID, req.LikeType)
-		if err != nil {
-			utils.DisplayError(w, http.StatusInternalServerError, "Failed to insert like")
-			return
-		}
-	} else if err == nil {
-		// If the user already reacted
-		if existingLikeType == req.LikeType {
-			// User clicked the same reaction → Remove it (unlike/undislike)
-			deleteQuery := `DELETE FROM likes WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`
-			_, err = db.DB.Exec(deleteQuery, req.UserID, req.PostID, req.CommentID)
-			if err != nil {
-				utils.DisplayError(w, http.StatusInternalServerError, "Failed to remove like")
-				return
-			}
-		} else {
-			// User clicked opposite reaction → Toggle it (like ↔ dislike)
-			updateQuery := `UPDATE likes SET like_type = ? WHERE user_id = ? AND post_id IS ? AND comment_id IS ?`
-			_, err = db.DB.Exec(updateQuery, req.LikeType, req.UserID, req.PostID, req.CommentID)
-			if err != nil {
-				utils.DisplayError(w, http.StatusInternalServerError, "Failed to toggle reaction")
-				return
-			}
-		}
+	// Reactions are only accepted on content the user can see
+	postID, commentID := 0, 0
+	if req.CommentID != nil {
+		commentID = *req.CommentID
 	} else {
+		postID = *req.PostID
+	}
+	visible, err := canViewContent(auth.GetCurrentUserID(r), postID, commentID)
+	if err != nil {
 		utils.DisplayError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
+	if !visible {
+		utils.DisplayError(w, http.StatusNotFound, "Content not found")
+		return
+	}
 
-	var likes, dislikes int
-	countQuery := `
-	SELECT 
-		COALESCE(SUM(CASE WHEN like_type = 'like' THEN 1 ELSE 0 END), 0) AS likes,
-		COALESCE(SUM(CASE WHEN like_type = 'dislike' THEN 1 ELSE 0 END), 0) AS dislikes
-	FROM likes
-	WHERE (post_id = ? OR (post_id IS NULL AND ? IS NULL)) 
-	AND (comment_id = ? OR (comment_id IS NULL AND ? IS NULL))`
-
-	err = db.DB.QueryRow(countQuery, req.PostID, req.PostID, req.CommentID, req.CommentID).Scan(&likes, &dislikes)
+	// The reaction is stored for the logged in user, whatever user_id the body names
+	reaction, err := db.React(auth.GetCurrentUserID(r), req.PostID, req.CommentID, req.LikeType)
 	if err != nil {
-		fmt.Println(err.Error())
-		utils.DisplayError(w, http.StatusInternalServerError, "Failed to fetch updated counts")
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update reaction")
 		return
 	}
+	events.PublishReaction(postID, commentID, reaction.Likes, reaction.Dislikes)
+	if err := db.NotifyReaction(auth.GetCurrentUserID(r), req.PostID, req.CommentID, reaction.Current); err != nil {
+		log.Println(err)
+	}
 
 	// Return updated counts and user reaction status
 	response := map[string]interface{}{
 		"message":      "Reaction updated",
-		"likes":        likes,
-		"dislikes":     dislikes,
+		"likes":        reaction.Likes,
+		"dislikes":     reaction.Dislikes,
 		"userReaction": req.LikeType,
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// maxMessageLength is the longest private message, in characters.
+const maxMessageLength = 5000
+
+// MessagesHandler shows the inbox: the user's conversations with their unread
+// counts, a form to start a new one, and the users they have blocked.
+func MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	conversations, err := db.Conversations(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch conversations")
+		return
+	}
+	for i := range conversations {
+		conversations[i].LatestActivity = utils.FormatTime(conversations[i].Updated)
+	}
+	blocked, err := db.BlockedUsers(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch blocked users")
+		return
+	}
+
+	data := struct {
+		page
+		Conversations []models.Conversation
+		Blocked       []models.User
+		To            string
+	}{
+		page:          newPage(r),
+		Conversations: conversations,
+		Blocked:       blocked,
+		To:            r.URL.Query().Get("to"),
+	}
+
+	renderPage(w, "messages.html", data)
+}
+
+// ConversationHandler shows a conversation at /messages/{id} and marks it read.
+func ConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversationID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/messages/"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	conversation, err := db.Conversation(userID, conversationID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Conversation not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch conversation")
+		return
+	}
+	messages, err := db.Messages(conversationID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch messages")
+		return
+	}
+	for i := range messages {
+		messages[i].CreatedAt = utils.FormatTime(messages[i].Created)
+	}
+	if err := db.MarkConversationRead(conversationID, userID); err != nil {
+		log.Println(err)
+	}
+
+	data := struct {
+		page
+		Conversation models.Conversation
+		Messages     []models.Message
+	}{
+		page:         newPage(r),
+		Conversation: conversation,
+		Messages:     messages,
+	}
+
+	renderPage(w, "conversation.html", data)
+}
+
+// NewConversationHandler starts a conversation with the users named in the to
+// field, separated by commas, or adds to the existing one-to-one conversation.
+func NewConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages/new" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	content, ok := messageContent(w, r)
+	if !ok {
+		return
+	}
+
+	var memberIDs []int
+	seen := map[int]bool{userID: true}
+	for _, name := range strings.Split(r.FormValue("to"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, err := db.UserIDByUsername(name)
+		if err == sql.ErrNoRows {
+			utils.DisplayError(w, http.StatusBadRequest, fmt.Sprintf("User %q not found", name))
+			return
+		} else if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to start conversation")
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			memberIDs = append(memberIDs, id)
+		}
+	}
+	if len(memberIDs) == 0 {
+		utils.DisplayError(w, http.StatusBadRequest, "Name at least one other user")
+		return
+	}
+	if len(memberIDs)+1 > models.MaxConversationMembers {
+		utils.DisplayError(w, http.StatusBadRequest, fmt.Sprintf("Conversations are limited to %d members", models.MaxConversationMembers))
+		return
+	}
+
+	conversationID, err := db.StartConversation(userID, memberIDs, strings.TrimSpace(r.FormValue("title")), content)
+	if err == db.ErrBlocked {
+		utils.DisplayError(w, http.StatusForbidden, "You cannot message one of these users")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to start conversation")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d", conversationID), http.StatusSeeOther)
+}
+
+// SendMessageHandler adds a message to a conversation of the current user.
+func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages/send" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	conversationID, ok := memberConversation(w, r, userID)
+	if !ok {
+		return
+	}
+	content, ok := messageContent(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.SendMessage(conversationID, userID, content)
+	if err == db.ErrBlocked {
+		utils.DisplayError(w, http.StatusForbidden, "You cannot message this conversation")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to send message")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d", conversationID), http.StatusSeeOther)
+}
+
+// MuteConversationHandler mutes a conversation of the current user, or unmutes it
+// when muted is "0". Muted conversations keep their unread counts in the inbox
+// but do not add to the total in the sidebar.
+func MuteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages/mute" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	conversationID, ok := memberConversation(w, r, userID)
+	if !ok {
+		return
+	}
+	if err := db.SetConversationMuted(conversationID, userID, r.FormValue("muted") != "0"); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to mute conversation")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d", conversationID), http.StatusSeeOther)
+}
+
+// BlockUserHandler blocks the user named in the form. Blocked users cannot start
+// conversations with the user or write in conversations the user is in, and the
+// user cannot write to them one-to-one until the block is lifted.
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	changeBlock(w, r, "/blocks/add", db.BlockUser)
+}
+
+// UnblockUserHandler lifts a block of the current user.
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	changeBlock(w, r, "/blocks/remove", db.UnblockUser)
+}
+
+func changeBlock(w http.ResponseWriter, r *http.Request, path string, change func(blockerID, blockedID int) error) {
+	if r.URL.Path != path {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	otherID, err := db.UserIDByUsername(strings.TrimSpace(r.FormValue("username")))
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusBadRequest, "User not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update blocks")
+		return
+	}
+	if otherID == userID {
+		utils.DisplayError(w, http.StatusBadRequest, "You cannot block yourself")
+		return
+	}
+	if err := change(userID, otherID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to update blocks")
+		return
+	}
+	http.Redirect(w, r, "/messages", http.StatusSeeOther)
+}
+
+// memberConversation reads the conversation_id form value and checks that the
+// user is a member, writing the error response when not.
+func memberConversation(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	conversationID, err := strconv.Atoi(r.FormValue("conversation_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid conversation ID")
+		return 0, false
+	}
+	if _, err := db.Conversation(userID, conversationID); err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Conversation not found")
+		return 0, false
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch conversation")
+		return 0, false
+	}
+	return conversationID, true
+}
+
+// messageContent reads and checks the content form value, writing the error
+// response when it is empty or too long.
+func messageContent(w http.ResponseWriter, r *http.Request) (string, bool) {
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		utils.DisplayError(w, http.StatusBadRequest, "Message cannot be empty")
+		return "", false
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		utils.DisplayError(w, http.StatusBadRequest, fmt.Sprintf("Messages are limited to %d characters", maxMessageLength))
+		return "", false
+	}
+	return content, true
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/db"
+)
+
+// setupMessages creates alice (1), bob (2) and carol (3).
+func setupMessages(t *testing.T) {
+	t.Helper()
+	testDB := setupTestDB(t)
+	t.Cleanup(func() { testDB.Close() })
+	_, err := testDB.Exec(`INSERT INTO users (username, email) VALUES
+		('alice', 'alice@test.com'), ('bob', 'bob@test.com'), ('carol', 'carol@test.com')`)
+	if err != nil {
+		t.Fatalf("Failed to insert users: %v", err)
+	}
+}
+
+func TestDirectMessages(t *testing.T) {
+	setupMessages(t)
+
+	rr := postForm(NewConversationHandler, "/messages/new", "1", url.Values{"to": {"bob"}, "content": {"Hi bob"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/messages/1" {
+		t.Fatalf("expected a redirect to /messages/1, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// A second message to bob goes to the same conversation
+	rr = postForm(NewConversationHandler, "/messages/new", "1", url.Values{"to": {"bob"}, "content": {"Are you there?"}})
+	if rr.Header().Get("Location") != "/messages/1" {
+		t.Errorf("expected the one-to-one conversation to be reused, got %q", rr.Header().Get("Location"))
+	}
+
+	if unread, _ := db.UnreadMessages(2); unread != 2 {
+		t.Errorf("expected bob to have 2 unread messages, got %d", unread)
+	}
+	if unread, _ := db.UnreadMessages(1); unread != 0 {
+		t.Errorf("expected alice's own messages to be read, got %d", unread)
+	}
+	if rr := getAs(MessagesHandler, "/messages", "2"); !strings.Contains(rr.Body.String(), "2 unread") || !strings.Contains(rr.Body.String(), "Are you there?") {
+		t.Error("expected bob's inbox to show the unread count and latest message")
+	}
+
+	// Reading the conversation clears its unread count
+	rr = getAs(ConversationHandler, "/messages/1", "2")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Hi bob") {
+		t.Fatalf("expected bob to see the conversation, got %d", rr.Code)
+	}
+	if unread, _ := db.UnreadMessages(2); unread != 0 {
+		t.Errorf("expected no unread messages after reading, got %d", unread)
+	}
+
+	// Others cannot read or write in it
+	if rr := getAs(ConversationHandler, "/messages/1", "3"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a non-member, got %d", rr.Code)
+	}
+	rr = postForm(SendMessageHandler, "/messages/send", "3", url.Values{"conversation_id": {"1"}, "content": {"Hello?"}})
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 sending to someone else's conversation, got %d", rr.Code)
+	}
+
+	// Muted conversations do not count towards the total
+	rr = postForm(SendMessageHandler, "/messages/send", "1", url.Values{"conversation_id": {"1"}, "content": {"Ping"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the message to be sent, got %d", rr.Code)
+	}
+	postForm(MuteConversationHandler, "/messages/mute", "2", url.Values{"conversation_id": {"1"}})
+	if unread, _ := db.UnreadMessages(2); unread != 0 {
+		t.Errorf("expected muted messages not to count, got %d", unread)
+	}
+	postForm(MuteConversationHandler, "/messages/mute", "2", url.Values{"conversation_id": {"1"}, "muted": {"0"}})
+	if unread, _ := db.UnreadMessages(2); unread != 1 {
+		t.Errorf("expected 1 unread message after unmuting, got %d", unread)
+	}
+}
+
+func TestGroupConversations(t *testing.T) {
+	setupMessages(t)
+
+	form := url.Values{"to": {"bob, carol, alice"}, "title": {"Planning"}, "content": {"Hi all"}}
+	rr := postForm(NewConversationHandler, "/messages/new", "1", form)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the conversation to be created, got %d", rr.Code)
+	}
+	conversation, err := db.Conversation(3, 1)
+	if err != nil {
+		t.Fatalf("expected carol to be a member: %v", err)
+	}
+	if got := strings.Join(conversation.Members, ","); got != "alice,bob" {
+		t.Errorf("expected carol to see alice and bob, got %q", got)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"Unknown user", url.Values{"to": {"dave"}, "content": {"Hi"}}},
+		{"Only yourself", url.Values{"to": {"alice"}, "content": {"Hi"}}},
+		{"Empty message", url.Values{"to": {"bob"}, "content": {"  "}}},
+	}
+	for _, tt := range tests {
+		if rr := postForm(NewConversationHandler, "/messages/new", "1", tt.form); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.name, rr.Code)
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	setupMessages(t)
+
+	postForm(NewConversationHandler, "/messages/new", "1", url.Values{"to": {"bob"}, "content": {"Hi bob"}})
+	postForm(NewConversationHandler, "/messages/new", "1", url.Values{"to": {"bob,carol"}, "title": {"Group"}, "content": {"Hi all"}})
+
+	if rr := postForm(BlockUserHandler, "/blocks/add", "2", url.Values{"username": {"alice"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the block to be saved, got %d", rr.Code)
+	}
+	if rr := getAs(MessagesHandler, "/messages", "2"); !strings.Contains(rr.Body.String(), `value="alice"`) {
+		t.Error("expected alice in bob's blocked users")
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		userID  string
+		form    url.Values
+	}{
+		{"Blocked user starts a conversation", NewConversationHandler, "/messages/new", "1", url.Values{"to": {"bob"}, "content": {"Hi"}}},
+		{"Blocker starts a conversation", NewConversationHandler, "/messages/new", "2", url.Values{"to": {"alice"}, "content": {"Hi"}}},
+		{"Blocked user writes one-to-one", SendMessageHandler, "/messages/send", "1", url.Values{"conversation_id": {"1"}, "content": {"Hi"}}},
+		{"Blocker writes one-to-one", SendMessageHandler, "/messages/send", "2", url.Values{"conversation_id": {"1"}, "content": {"Hi"}}},
+		{"Blocked user writes in a group", SendMessageHandler, "/messages/send", "1", url.Values{"conversation_id": {"2"}, "content": {"Hi"}}},
+	}
+	for _, tt := range tests {
+		if rr := postForm(tt.handler, tt.path, tt.userID, tt.form); rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", tt.name, rr.Code)
+		}
+	}
+
+	// The blocker may still write in the group, and everyone once unblocked
+	if rr := postForm(SendMessageHandler, "/messages/send", "2", url.Values{"conversation_id": {"2"}, "content": {"Hi"}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected bob to write in the group, got %d", rr.Code)
+	}
+	postForm(UnblockUserHandler, "/blocks/remove", "2", url.Values{"username": {"alice"}})
+	if rr := postForm(SendMessageHandler, "/messages/send", "1", url.Values{"conversation_id": {"1"}, "content": {"Hi"}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected alice to write again after the unblock, got %d", rr.Code)
+	}
+
+	if rr := postForm(BlockUserHandler, "/blocks/add", "2", url.Values{"username": {"bob"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 blocking yourself, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// moderationFlags maps the moderation actions to the post column they toggle.
+var moderationFlags = map[string]string{
+	"pin":    "pinned",
+	"lock":   "locked",
+	"remove": "removed",
+}
+
+// reverseActions names the audit action recorded when a moderation action is undone.
+var reverseActions = map[string]string{
+	"pin":    "unpin",
+	"lock":   "unlock",
+	"remove": "restore",
+}
+
+// ModeratePostHandler toggles the pinned, locked or removed state of a post.
+// The action is taken from the path: /mod/post/pin, /mod/post/lock or /mod/post/remove.
+func ModeratePostHandler(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/mod/post/")
+	column, ok := moderationFlags[action]
+	if !ok {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	if !checkCanModerate(w, r, postID) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+	defer tx.Rollback()
+
+	// column comes from moderationFlags, never from the request
+	var current bool
+	err = tx.QueryRow("SELECT "+column+" FROM posts WHERE post_id = ?", postID).Scan(&current)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE posts SET "+column+" = ?, updated_at = CURRENT_TIMESTAMP WHERE post_id = ?", !current, postID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	if current {
+		action = reverseActions[action]
+	}
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    auth.GetCurrentUserID(r),
+		Action:     "post." + action,
+		TargetType: "post",
+		TargetID:   postID,
+		Before:     db.Snapshot(map[string]bool{column: current}),
+		After:      db.Snapshot(map[string]bool{column: !current}),
+		Reason:     strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	// Open pages drop a removed post, announce a restored one like a new post and
+	// pick up the new state of the others
+	switch {
+	case column == "removed" && !current:
+		events.PublishPost(events.PostDeleted, postID)
+	case column == "removed":
+		events.PublishPost(events.PostCreated, postID)
+	default:
+		events.PublishPost(events.PostUpdated, postID)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// MovePostHandler replaces the categories of a post with the ones submitted.
+func MovePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mod/post/move" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	if !checkCanModerate(w, r, postID) {
+		return
+	}
+
+	// Posts can only be moved into categories the moderator can see
+	categoryIDs := []int{}
+	for _, catIDStr := range r.Form["category"] {
+		catID, err := strconv.Atoi(catIDStr)
+		if err != nil {
+			utils.DisplayError(w, http.StatusBadRequest, "Invalid category ID: "+catIDStr)
+			return
+		}
+		access, err := db.CategoryAccess(auth.GetCurrentUserID(r), catID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Failed to move post")
+			return
+		}
+		if !access.View {
+			utils.DisplayError(w, http.StatusBadRequest, "Invalid category ID: "+catIDStr)
+			return
+		}
+		categoryIDs = append(categoryIDs, catID)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to move post")
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE post_id = ?)", postID).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+	if !exists {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	before, err := postCategoryIDs(tx, postID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+
+	if err := setPostCategories(tx, postID, categoryIDs); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to move post")
+		return
+	}
+
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    auth.GetCurrentUserID(r),
+		Action:     "post.move",
+		TargetType: "post",
+		TargetID:   postID,
+		Before:     db.Snapshot(map[string][]int{"categories": before}),
+		After:      db.Snapshot(map[string][]int{"categories": categoryIDs}),
+		Reason:     strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to move post")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to move post")
+		return
+	}
+	events.PublishPost(events.PostUpdated, postID)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// checkCanModerate reports whether the current user may moderate a post, writing
+// the error response when not. Global moderators may moderate every post they can
+// see, members of a group with moderate permission the posts in that category.
+func checkCanModerate(w http.ResponseWriter, r *http.Request, postID int) bool {
+	access, err := db.ModerationAccess(auth.GetCurrentUserID(r), postID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return false
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load post")
+		return false
+	}
+	if !access.Moderate && !(access.View && auth.Can(r, auth.PermModeratePosts)) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to moderate posts")
+		return false
+	}
+	return true
+}
+
+// postCategoryIDs returns the IDs of the categories a post is in.
+func postCategoryIDs(tx *sql.Tx, postID int) ([]int, error) {
+	rows, err := tx.Query("SELECT category_id FROM post_categories WHERE post_id = ? ORDER BY category_id", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// setPostCategories replaces the rows of a post in post_categories.
+func setPostCategories(tx *sql.Tx, postID int, categoryIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, catID := range categoryIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, catID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
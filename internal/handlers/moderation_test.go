@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+	"forum/internal/events"
+	"forum/internal/models"
+)
+
+func postForm(handler http.HandlerFunc, path, userID string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if userID != "" {
+		req = auth.SetUserID(req, userID)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestModeratePostHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('mod', 'mod@test.com', 'moderator')`)
+	postID := url.Values{"post_id": {"2"}}
+
+	// Regular users cannot moderate
+	if rr := postForm(ModeratePostHandler, "/mod/post/lock", "1", postID); rr.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d", rr.Code)
+	}
+
+	if rr := postForm(ModeratePostHandler, "/mod/post/unknown", "2", postID); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown action, got %d", rr.Code)
+	}
+
+	for _, action := range []string{"pin", "lock"} {
+		if rr := postForm(ModeratePostHandler, "/mod/post/"+action, "2", postID); rr.Code != http.StatusSeeOther {
+			t.Fatalf("%s: expected status 303, got %d", action, rr.Code)
+		}
+	}
+
+	var pinned, locked bool
+	testDB.QueryRow(`SELECT pinned, locked FROM posts WHERE post_id = 2`).Scan(&pinned, &locked)
+	if !pinned || !locked {
+		t.Errorf("Expected post to be pinned and locked, got pinned=%v locked=%v", pinned, locked)
+	}
+
+	// Locked posts reject new comments
+	rr := postForm(CreateCommentHandler, "/comment/create", "1", url.Values{"post_id": {"2"}, "content": {"hello"}})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 when commenting on a locked post, got %d", rr.Code)
+	}
+
+	// Pinned posts are listed first, removed ones not at all
+	postForm(ModeratePostHandler, "/mod/post/remove", "2", url.Values{"post_id": {"3"}})
+	rr = httptest.NewRecorder()
+	HomeHandler(rr, httptest.NewRequest("GET", "/", nil))
+	body := rr.Body.String()
+	if strings.Contains(body, "Liked Post") {
+		t.Error("Expected removed post to be hidden")
+	}
+	if strings.Index(body, "Another Post") > strings.Index(body, "Test Post") {
+		t.Error("Expected pinned post to be listed first")
+	}
+}
+
+func TestModerationEvents(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`UPDATE users SET role = 'moderator' WHERE user_id = 1`)
+	sub := events.Default.Subscribe(nil)
+	defer sub.Close()
+
+	postID := url.Values{"post_id": {"2"}}
+	postForm(ModeratePostHandler, "/mod/post/lock", "1", postID)
+	postForm(ModeratePostHandler, "/mod/post/remove", "1", postID)
+	postForm(ModeratePostHandler, "/mod/post/remove", "1", postID)
+	postForm(MovePostHandler, "/mod/post/move", "1", url.Values{"post_id": {"2"}, "category": {"1"}})
+
+	if e := <-sub.C; e.Type != events.PostUpdated || e.PostID != 2 {
+		t.Fatalf("expected the lock to publish %s for post 2, got %s for post %d", events.PostUpdated, e.Type, e.PostID)
+	} else if post, ok := e.Data.(models.Post); !ok || !post.Locked {
+		t.Errorf("expected the event to carry the locked post, got %+v", e.Data)
+	}
+	for _, want := range []string{events.PostDeleted, events.PostCreated, events.PostUpdated} {
+		if e := <-sub.C; e.Type != want || e.PostID != 2 {
+			t.Fatalf("expected %s for post 2, got %s for post %d", want, e.Type, e.PostID)
+		}
+	}
+}
+
+func TestMovePostHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`UPDATE users SET role = 'moderator' WHERE user_id = 1`)
+
+	rr := postForm(MovePostHandler, "/mod/post/move", "1", url.Values{"post_id": {"1"}, "category": {"2"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+
+	var categoryID, count int
+	testDB.QueryRow(`SELECT COUNT(*), MAX(category_id) FROM post_categories WHERE post_id = 1`).Scan(&count, &categoryID)
+	if count != 1 || categoryID != 2 {
+		t.Errorf("Expected post to only be in category 2, got %d categories ending with %d", count, categoryID)
+	}
+
+	if rr := postForm(MovePostHandler, "/mod/post/move", "1", url.Values{"post_id": {"99"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing post, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// notificationsPageSize is the number of notification groups per page.
+const notificationsPageSize = 30
+
+// NotificationsHandler lists the current user's notifications, grouped so that
+// likes and comments on the same post show as one entry, unread first.
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/notifications" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	pageNum, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+
+	// Fetch one extra entry to know whether there is a next page
+	notifications, err := db.Notifications(auth.GetCurrentUserID(r), notificationsPageSize+1, (pageNum-1)*notificationsPageSize)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch notifications")
+		return
+	}
+	hasNext := len(notifications) > notificationsPageSize
+	if hasNext {
+		notifications = notifications[:notificationsPageSize]
+	}
+	for i := range notifications {
+		notifications[i].CreatedAt = utils.FormatTime(notifications[i].Created)
+	}
+	frequency, err := db.DigestFrequency(auth.GetCurrentUserID(r))
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch email preferences")
+		return
+	}
+	verified, err := db.EmailVerified(auth.GetCurrentUserID(r))
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch email preferences")
+		return
+	}
+
+	data := struct {
+		page
+		Groups      []models.Notification
+		PageNum     int
+		PrevPage    int
+		NextPage    int
+		Frequency   string
+		Frequencies []string
+		Verified    bool
+	}{
+		page:        newPage(r),
+		Groups:      notifications,
+		PageNum:     pageNum,
+		PrevPage:    pageNum - 1,
+		Frequency:   frequency,
+		Frequencies: models.DigestFrequencies,
+		Verified:    verified,
+	}
+	if hasNext {
+		data.NextPage = pageNum + 1
+	}
+
+	renderPage(w, "notifications.html", data)
+}
+
+// MarkNotificationsReadHandler marks a group of notifications read, given the
+// notification_id of its latest one, or all of them when all is set.
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/notifications/read" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	if r.FormValue("all") != "" {
+		err := db.MarkAllNotificationsRead(userID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to update notifications")
+			return
+		}
+	} else {
+		notificationID, err := strconv.Atoi(r.FormValue("notification_id"))
+		if err != nil {
+			utils.DisplayError(w, http.StatusBadRequest, "Invalid notification ID")
+			return
+		}
+		if err := db.MarkNotificationRead(userID, notificationID); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to update notifications")
+			return
+		}
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
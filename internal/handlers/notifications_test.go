@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+)
+
+// react sends a reaction to LikeHandler as userID.
+func react(t *testing.T, userID string, target string, likeType string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"user_id": %s, %s, "like_type": %q}`, userID, target, likeType)
+	req := httptest.NewRequest(http.MethodPost, "/like", strings.NewReader(body))
+	req = auth.SetUserID(req, userID)
+	rr := httptest.NewRecorder()
+	LikeHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reaction by %s failed with status %d: %s", userID, rr.Code, rr.Body.String())
+	}
+}
+
+func unreadNotifications(t *testing.T, userID int) int {
+	t.Helper()
+	count, err := db.UnreadNotifications(userID)
+	if err != nil {
+		t.Fatalf("Failed to count notifications: %v", err)
+	}
+	return count
+}
+
+func TestNotifications(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+	for i := 2; i <= 6; i++ {
+		testDB.Exec(`INSERT INTO users (username, email) VALUES (?, ?)`, fmt.Sprintf("u%d", i), fmt.Sprintf("u%d@test.com", i))
+	}
+
+	// Likes from five users are grouped, and taking one back removes it
+	for i := 2; i <= 6; i++ {
+		react(t, fmt.Sprint(i), `"post_id": 1`, "like")
+	}
+	react(t, "1", `"post_id": 1`, "like")
+	react(t, "6", `"post_id": 1`, "like")
+	if got := unreadNotifications(t, 1); got != 1 {
+		t.Fatalf("expected 1 notification group, got %d", got)
+	}
+	body := getAs(NotificationsHandler, "/notifications", "1").Body.String()
+	if !strings.Contains(body, "4 people liked your post") || !strings.Contains(body, "1 new") {
+		t.Errorf("expected the likes to be grouped, got:\n%s", body)
+	}
+
+	// Comments notify the author, and earlier commenters of replies
+	for _, userID := range []string{"2", "3"} {
+		rr := postForm(CreateCommentHandler, "/comment/create", userID, url.Values{"post_id": {"1"}, "content": {"Nice"}})
+		if rr.Code != http.StatusSeeOther {
+			t.Fatalf("comment by %s failed with status %d", userID, rr.Code)
+		}
+	}
+	body = getAs(NotificationsHandler, "/notifications", "1").Body.String()
+	if !strings.Contains(body, "u2 and u3 commented on your post") {
+		t.Errorf("expected the comments to be grouped, got:\n%s", body)
+	}
+	if !strings.Contains(getAs(NotificationsHandler, "/notifications", "2").Body.String(), "u3 also commented on") {
+		t.Error("expected u2 to be told of u3's reply")
+	}
+	if got := unreadNotifications(t, 3); got != 0 {
+		t.Errorf("expected no notifications for u3's own comment, got %d", got)
+	}
+
+	// Likes on comments go to their author
+	react(t, "1", `"comment_id": 2`, "like")
+	if !strings.Contains(getAs(NotificationsHandler, "/notifications", "2").Body.String(), "testuser liked your comment on") {
+		t.Error("expected u2 to be told of the like on their comment")
+	}
+
+	// Notifications from blocked users are hidden
+	db.BlockUser(1, 3)
+	body = getAs(NotificationsHandler, "/notifications", "1").Body.String()
+	if !strings.Contains(body, "u2 commented on your post") {
+		t.Errorf("expected u3's comment to be hidden, got:\n%s", body)
+	}
+	db.UnblockUser(1, 3)
+
+	// Marking one group read leaves the others
+	if got := unreadNotifications(t, 1); got != 2 {
+		t.Fatalf("expected 2 notification groups, got %d", got)
+	}
+	var likeID int
+	testDB.QueryRow(`SELECT MAX(notification_id) FROM notifications WHERE user_id = 1 AND type = 'like'`).Scan(&likeID)
+	rr := postForm(MarkNotificationsReadHandler, "/notifications/read", "1", url.Values{"notification_id": {fmt.Sprint(likeID)}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect, got %d", rr.Code)
+	}
+	if got := unreadNotifications(t, 1); got != 1 {
+		t.Errorf("expected 1 notification group left, got %d", got)
+	}
+
+	// Marking all read leaves other users' notifications
+	postForm(MarkNotificationsReadHandler, "/notifications/read", "1", url.Values{"all": {"1"}})
+	if got := unreadNotifications(t, 1); got != 0 {
+		t.Errorf("expected all notifications read, got %d", got)
+	}
+	if got := unreadNotifications(t, 2); got == 0 {
+		t.Error("expected u2's notifications to stay unread")
+	}
+}
+
+func TestLockoutNotification(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+
+	// Parallel failures can skip past the threshold, the owner is still told once
+	for i := 0; i < 11; i++ {
+		testDB.Exec(`INSERT INTO login_attempts (account_key, ip_address, attempted_at) VALUES ('user:1', '127.0.0.1', ?)`, time.Now().UTC())
+	}
+	for i := 0; i < 2; i++ {
+		if err := auth.RecordLoginFailure("user:1", 1); err != nil {
+			t.Fatalf("Failed to record login failure: %v", err)
+		}
+	}
+	if got := unreadNotifications(t, 1); got != 1 {
+		t.Errorf("expected 1 notification, got %d", got)
+	}
+	if body := getAs(NotificationsHandler, "/notifications", "1").Body.String(); !strings.Contains(body, "Your account was locked") {
+		t.Error("expected the lockout to be listed")
+	}
+}
+
+func TestMentions(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+	testDB.Exec(`INSERT INTO users (username, email) VALUES ('outsider', 'outsider@test.com')`)
+
+	// Another Post is in the private category, which outsider cannot see
+	content := "Ping @outsider and @Admin, or mail me@testuser.com"
+	rr := postForm(CreateCommentHandler, "/comment/create", "3", url.Values{"post_id": {"2"}, "content": {content}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the comment to be saved, got %d", rr.Code)
+	}
+	if !strings.Contains(getAs(NotificationsHandler, "/notifications", "2").Body.String(), "staffer mentioned you in") {
+		t.Error("expected admin to be told of the mention")
+	}
+	if got := unreadNotifications(t, 4); got != 0 {
+		t.Errorf("expected no notification for a post outsider cannot see, got %d", got)
+	}
+	var emailed int
+	testDB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = 1 AND type = 'mention'`).Scan(&emailed)
+	if emailed != 0 {
+		t.Error("expected the email address not to count as a mention")
+	}
+
+	body := getAs(HomeHandler, "/", "2").Body.String()
+	for _, want := range []string{`<a class="mention" href="/u/outsider">@outsider</a>`, `<a class="mention" href="/u/admin">@Admin</a>`, "mail me@testuser.com"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the rendered comment", want)
+		}
+	}
+}
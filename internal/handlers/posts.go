@@ -1,18 +1,14 @@
 package handlers
 
 import (
-	"html/template"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"forum/internal/auth"
 	"forum/internal/db"
-	"forum/internal/models"
+	"forum/internal/events"
 	"forum/internal/utils"
 )
 
@@ -21,8 +17,6 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		utils.DisplayError(w, http.StatusNotFound, " page not found")
 		return
 	}
-	currentUserID := auth.GetCurrentUserID(r)
-
 	// Retrieve the user ID from the context
 	userID, ok := auth.GetUserID(r)
 	if !ok || userID == "" || userID == " " {
@@ -31,34 +25,8 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodGet {
-		// Fetch categories to display in the form
-		categories := utils.FetchCategories()
-		userDetails, _ := db.GetUser(currentUserID)
-
-		data := struct {
-			CurrentUserID int
-			Categories    []models.Categories
-			Name          string
-			UserImage string
-			Bio string
-		}{
-			CurrentUserID: currentUserID,
-			Categories:    categories,
-			Name:          userDetails[0],
-			Bio: userDetails[1],
-			UserImage: userDetails[2],
-		}
-
-		// Render the form
-		tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/post.html", "web/templates/sidebar.html", "web/templates/profile.html")
-		if err != nil {
-			utils.DisplayError(w, http.StatusInternalServerError, "server error")
-			return
-		}
-		if err = tmpl.Execute(w, data); err != nil {
-			utils.DisplayError(w, http.StatusInternalServerError, "server error")
-			return
-		}
+		// Render the form, the shared page data includes the categories to choose from
+		renderPage(w, "post.html", newPage(r))
 	} else if r.Method == http.MethodPost {
 		// Parse form input
 		err := r.ParseMultipartForm(20)
@@ -71,25 +39,6 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		title := r.FormValue("title")
 		content := r.FormValue("content")
 		categories := r.Form["category"]
-		file, headers, err := r.FormFile("img")
-		imgurl := ""
-
-		if err == nil {
-			dst, err := os.Create(filepath.Join("web/static/images", headers.Filename))
-			if err != nil {
-				utils.DisplayError(w, http.StatusInternalServerError, "server error")
-				return
-			}
-			_, err = io.Copy(dst, file)
-			if err != nil {
-				utils.DisplayError(w, http.StatusInternalServerError, "server error")
-				return
-			}
-			imgurl = dst.Name()
-			imgurl = strings.Replace(imgurl, "web", "..", 1)
-
-		}
-
 		// Validate inputs
 		if title == "" || content == "" {
 			utils.DisplayError(w, http.StatusBadRequest, "All fields are required")
@@ -100,41 +49,51 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Insert post into the database
-		query := `
-			INSERT INTO posts (user_id, title, content)
-			VALUES (?, ?, ?)`
-		if imgurl != "" {
-			query = `
-			INSERT INTO posts (user_id, title, content, imgurl)
-			VALUES (?, ?, ?,?)`
-		}
-		result, err := db.DB.Exec(query, userID, title, content, imgurl)
-		if err != nil {
-			log.Println(err)
-			utils.DisplayError(w, http.StatusInternalServerError, "Unable to create post")
-			return
-		}
-
-		// Get the newly created post's ID
-		postID, err := result.LastInsertId()
-		if err != nil {
-			utils.DisplayError(w, http.StatusInternalServerError, "Failed to retrieve post ID")
-			return
-		}
-
-		// Insert each selected category into post_categories
+		// Validate the categories before anything is stored. Archived categories and
+		// private ones the user has no post permission in do not take new posts.
+		categoryIDs := []int{}
 		for _, catIDStr := range categories {
 			catID, err := strconv.Atoi(catIDStr)
 			if err != nil {
 				utils.DisplayError(w, http.StatusBadRequest, "Invalid category ID: "+catIDStr)
 				return
 			}
-			_, err = db.DB.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, catID)
+			access, err := db.CategoryAccess(auth.GetCurrentUserID(r), catID)
 			if err != nil {
-				utils.DisplayError(w, http.StatusInternalServerError, "Failed to link category to post: "+err.Error())
+				log.Println(err)
+				utils.DisplayError(w, http.StatusInternalServerError, "Unable to create post")
 				return
 			}
+			if !access.View {
+				utils.DisplayError(w, http.StatusBadRequest, "Invalid category ID: "+catIDStr)
+				return
+			}
+			if !access.Post {
+				utils.DisplayError(w, http.StatusForbidden, "You are not allowed to post in this category")
+				return
+			}
+			categoryIDs = append(categoryIDs, catID)
+		}
+
+		imgurl, err := utils.SaveImage(r, "img")
+		if utils.IsUploadError(err) {
+			utils.DisplayError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "server error")
+			return
+		}
+
+		postID, err := db.CreatePost(auth.GetCurrentUserID(r), title, content, imgurl, categoryIDs)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to create post")
+			return
+		}
+		events.PublishPost(events.PostCreated, postID)
+		if err := db.NotifyMentions(auth.GetCurrentUserID(r), postID, nil, utils.Mentions(content)); err != nil {
+			log.Println(err)
 		}
 
 		// Redirect to homepage or posts page
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/feed"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// profilePageSize is the number of posts or comments per page of a profile.
+const profilePageSize = 20
+
+// ProfileHandler shows the public profile of a user at /u/{username}: their bio,
+// avatar, join date and reaction totals, and their posts, or their comments with
+// ?tab=comments, a page at a time.
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimPrefix(r.URL.Path, "/u/")
+	if username == "" || strings.Contains(username, "/") {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, err := db.UserByUsername(username)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch user")
+		return
+	}
+
+	currentUserID := auth.GetCurrentUserID(r)
+	query := r.URL.Query()
+	tab := query.Get("tab")
+	if tab != "comments" {
+		tab = "posts"
+	}
+	pageNum, err := strconv.Atoi(query.Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	offset := (pageNum - 1) * profilePageSize
+
+	likes, dislikes, err := db.ReactionTotals(user.UserID, currentUserID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch user")
+		return
+	}
+	followers, following, err := db.FollowCounts(user.UserID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch user")
+		return
+	}
+	var isFollowing bool
+	if currentUserID != 0 && currentUserID != user.UserID {
+		if isFollowing, err = db.FollowsUser(currentUserID, user.UserID); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch user")
+			return
+		}
+	}
+
+	// Both counts are shown on the tabs; only the open tab's entries are fetched
+	opts := feed.Options{ViewerID: currentUserID, AuthorID: user.UserID}
+	postCount, err := feed.CountPosts(opts)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch posts")
+		return
+	}
+	commentCount, err := feed.CountAuthorComments(user.UserID, currentUserID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch comments")
+		return
+	}
+
+	var posts []models.Post
+	var comments []models.Comment
+	total := postCount
+	if tab == "posts" {
+		opts.Limit, opts.Offset = profilePageSize, offset
+		posts, err = feed.ListPosts(opts)
+	} else {
+		total = commentCount
+		comments, err = feed.AuthorComments(user.UserID, currentUserID, profilePageSize, offset)
+	}
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch "+tab)
+		return
+	}
+
+	data := struct {
+		page
+		User         models.User
+		Joined       string
+		Likes        int
+		Dislikes     int
+		Followers    int
+		Following    int
+		IsFollowing  bool
+		PostCount    int
+		CommentCount int
+		Tab          string
+		Posts        []models.Post
+		Comments     []models.Comment
+		Reasons      map[string]string
+		PageNum      int
+		PrevPage     int
+		NextPage     int
+	}{
+		page:         newPage(r),
+		User:         user,
+		Joined:       user.CreatedAt.Format("January 2, 2006"),
+		Likes:        likes,
+		Dislikes:     dislikes,
+		Followers:    followers,
+		Following:    following,
+		IsFollowing:  isFollowing,
+		PostCount:    postCount,
+		CommentCount: commentCount,
+		Tab:          tab,
+		Posts:        posts,
+		Comments:     comments,
+		Reasons:      models.ReportReasons,
+		PageNum:      pageNum,
+		PrevPage:     pageNum - 1,
+	}
+	if offset+profilePageSize < total {
+		data.NextPage = pageNum + 1
+	}
+
+	renderPage(w, "user.html", data)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+	testDB.Exec(`UPDATE users SET bio = 'Gopher <3' WHERE user_id = 1`)
+	testDB.Exec(`INSERT INTO comments (post_id, user_id, content) VALUES (2, 1, 'A private reply')`)
+	react(t, "2", `"post_id": 1`, "like")
+	react(t, "3", `"comment_id": 1`, "like")
+	react(t, "3", `"post_id": 3`, "dislike")
+	react(t, "3", `"post_id": 2`, "like")
+
+	rr := getAs(ProfileHandler, "/u/testuser", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"Gopher &lt;3", "3 likes | 1 dislikes", "Posts (2)", "Comments (1)", "Test Post", "Liked Post"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q on the profile", want)
+		}
+	}
+	if strings.Contains(body, "Another Post") {
+		t.Error("expected posts in private categories to be hidden from visitors")
+	}
+
+	// Those who may see the private category see its posts, comments and reactions too
+	body = getAs(ProfileHandler, "/u/testuser?tab=comments", "3").Body.String()
+	for _, want := range []string{"4 likes | 1 dislikes", "Posts (3)", "Comments (2)", "A private reply", `href="/post/2">Another Post</a>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q on the comments tab", want)
+		}
+	}
+
+	if rr := getAs(ProfileHandler, "/u/nobody", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown user, got %d", rr.Code)
+	}
+}
+
+func TestProfilePagination(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+	for i := 0; i < profilePageSize; i++ {
+		testDB.Exec(`INSERT INTO posts (user_id, title, content) VALUES (1, 'Filler', 'More content')`)
+	}
+
+	body := getAs(ProfileHandler, "/u/testuser", "").Body.String()
+	if got := strings.Count(body, `<div class="post">`); got != profilePageSize {
+		t.Errorf("expected %d posts on the first page, got %d", profilePageSize, got)
+	}
+	if !strings.Contains(body, "tab=posts&page=2") {
+		t.Error("expected a link to the next page")
+	}
+
+	body = getAs(ProfileHandler, "/u/testuser?page=2", "").Body.String()
+	if got := strings.Count(body, `<div class="post">`); got != 3 {
+		t.Errorf("expected 3 posts on the second page, got %d", got)
+	}
+	if strings.Contains(body, "page=3") {
+		t.Error("expected no link past the last page")
+	}
+}
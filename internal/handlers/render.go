@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// page holds the data layout.html, sidebar.html and profile.html need. Handlers
+// embed it in the data they pass to their content template.
+type page struct {
+	CurrentUserID int
+	Categories    []models.Categories
+	Name          string
+	UserImage     string
+	Bio           string
+	CanModerate   bool
+	IsAdmin       bool
+	Unread        int    // unread private messages
+	Notifications int    // unread notification groups
+	DeletionDate  string // when the account is scheduled to be deleted, if it is
+}
+
+// newPage fills in the shared page data for the user making the request.
+func newPage(r *http.Request) page {
+	currentUserID := auth.GetCurrentUserID(r)
+	user, _ := db.UserByID(currentUserID)
+	role := auth.UserRole(currentUserID)
+
+	var unread, notifications int
+	var deletionDate string
+	if currentUserID != 0 {
+		var err error
+		if unread, err = db.UnreadMessages(currentUserID); err != nil {
+			log.Println(err)
+		}
+		if notifications, err = db.UnreadNotifications(currentUserID); err != nil {
+			log.Println(err)
+		}
+		if deleteAt, err := db.AccountDeletion(currentUserID); err != nil {
+			log.Println(err)
+		} else if !deleteAt.IsZero() {
+			deletionDate = deleteAt.Format("January 2, 2006")
+		}
+	}
+
+	return page{
+		CurrentUserID: currentUserID,
+		Categories:    utils.FetchCategories(currentUserID),
+		Name:          user.Username,
+		Bio:           user.Bio,
+		UserImage:     user.ProfilePicture,
+		CanModerate:   role.Can(auth.PermModeratePosts),
+		IsAdmin:       role.Can(auth.PermManageUsers),
+		Unread:        unread,
+		Notifications: notifications,
+		DeletionDate:  deletionDate,
+	}
+}
+
+// templateFuncs are the functions available to page templates.
+var templateFuncs = template.FuncMap{
+	"mentions": utils.LinkMentions, // content with @mentions linked to profiles
+	"postLink": models.PostLink,
+}
+
+// renderPage renders the named content template inside the shared layout.
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/"+name, "web/templates/sidebar.html", "web/templates/profile.html", "web/templates/posts.html")
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "server error")
+		return
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "server error")
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/events"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+const maxReportDetails = 500
+
+// ReportHandler lets a user flag a post or a comment for moderators to review.
+func ReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/report" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	postID, _ := strconv.Atoi(r.FormValue("post_id"))
+	commentID, _ := strconv.Atoi(r.FormValue("comment_id"))
+	if (postID == 0) == (commentID == 0) {
+		utils.DisplayError(w, http.StatusBadRequest, "Report either a post or a comment")
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if _, ok := models.ReportReasons[reason]; !ok {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid report reason")
+		return
+	}
+	details := strings.TrimSpace(r.FormValue("details"))
+	if utf8.RuneCountInString(details) > maxReportDetails {
+		utils.DisplayError(w, http.StatusBadRequest, fmt.Sprintf("Report details are limited to %d characters", maxReportDetails))
+		return
+	}
+
+	// Only content that is still visible can be reported
+	var exists bool
+	var err error
+	if postID != 0 {
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE post_id = ? AND removed = 0)", postID).Scan(&exists)
+	} else {
+		err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE comment_id = ? AND removed = 0)", commentID).Scan(&exists)
+	}
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load reported content")
+		return
+	}
+	if !exists {
+		utils.DisplayError(w, http.StatusNotFound, "Reported content not found")
+		return
+	}
+
+	// Content in categories the user may not see cannot be reported either
+	visible, err := canViewContent(userID, postID, commentID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to load reported content")
+		return
+	}
+	if !visible {
+		utils.DisplayError(w, http.StatusNotFound, "Reported content not found")
+		return
+	}
+
+	// A user only has one open report per post or comment
+	var alreadyReported bool
+	err = db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM reports WHERE reporter_id = ? AND post_id IS ? AND comment_id IS ? AND status = 'open')`,
+		userID, nullableID(postID), nullableID(commentID)).Scan(&alreadyReported)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to save report")
+		return
+	}
+
+	if !alreadyReported {
+		_, err = db.DB.Exec(`INSERT INTO reports (reporter_id, post_id, comment_id, reason, details) VALUES (?, ?, ?, ?, ?)`,
+			userID, nullableID(postID), nullableID(commentID), reason, details)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Failed to save report")
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// nullableID turns a zero ID into NULL for optional foreign keys.
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// canViewContent reports whether a user may see a post, or the post a comment
+// belongs to when postID is 0.
+func canViewContent(userID, postID, commentID int) (bool, error) {
+	if postID == 0 {
+		id, err := db.CommentPostID(commentID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		postID = id
+	}
+	access, err := db.PostAccess(userID, postID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return access.View, err
+}
+
+// removedPostsShown is how many of the latest removed posts the moderation queue
+// lists for restoring.
+const removedPostsShown = 50
+
+// ReportsQueueHandler lists the open reports together with the reported content,
+// and the latest removed posts with a button to restore them.
+func ReportsQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/mod/reports" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermModeratePosts) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to review reports")
+		return
+	}
+
+	query := `
+	SELECT r.report_id, u.username, COALESCE(r.post_id, 0), COALESCE(r.comment_id, 0), r.reason, COALESCE(r.details, ''), r.created_at,
+		COALESCE(p.title, cp.title, ''), COALESCE(p.content, c.content, ''), COALESCE(pu.username, cu.username, '')
+	FROM reports r
+	JOIN users u ON r.reporter_id = u.user_id
+	LEFT JOIN posts p ON r.post_id = p.post_id
+	LEFT JOIN users pu ON p.user_id = pu.user_id
+	LEFT JOIN comments c ON r.comment_id = c.comment_id
+	LEFT JOIN posts cp ON c.post_id = cp.post_id
+	LEFT JOIN users cu ON c.user_id = cu.user_id
+	WHERE r.status = 'open'
+	ORDER BY r.created_at ASC`
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch reports")
+		return
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+	for rows.Next() {
+		var report models.Report
+		var createdAt time.Time
+		err := rows.Scan(&report.ReportID, &report.ReporterName, &report.PostID, &report.CommentID, &report.Reason, &report.Details, &createdAt,
+			&report.Title, &report.Content, &report.ContentAuthor)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Error retrieving report data")
+			return
+		}
+		report.CreatedAt = utils.FormatTime(createdAt)
+		reports = append(reports, report)
+	}
+
+	removed, err := db.RemovedPosts(removedPostsShown)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch removed posts")
+		return
+	}
+
+	data := struct {
+		page
+		Reports      []models.Report
+		RemovedPosts []models.Post
+	}{
+		page:         newPage(r),
+		Reports:      reports,
+		RemovedPosts: removed,
+	}
+
+	renderPage(w, "mod_reports.html", data)
+}
+
+// reportStatuses maps the review actions to the status they close a report with.
+var reportStatuses = map[string]string{
+	"resolve": "resolved",
+	"dismiss": "dismissed",
+}
+
+// ReviewReportHandler closes a report from the moderation queue. Resolving can also
+// remove the reported content. All open reports on the same content are closed
+// together and the decision is written to the audit log.
+func ReviewReportHandler(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/mod/reports/")
+	status, ok := reportStatuses[action]
+	if !ok {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !auth.Can(r, auth.PermModeratePosts) {
+		utils.DisplayError(w, http.StatusForbidden, "You are not allowed to review reports")
+		return
+	}
+
+	reportID, err := strconv.Atoi(r.FormValue("report_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+	note := strings.TrimSpace(r.FormValue("note"))
+	removeContent := action == "resolve" && r.FormValue("remove") == "1"
+	moderatorID := auth.GetCurrentUserID(r)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+		return
+	}
+	defer tx.Rollback()
+
+	var postID, commentID sql.NullInt64
+	var currentStatus string
+	err = tx.QueryRow(`SELECT post_id, comment_id, status FROM reports WHERE report_id = ?`, reportID).Scan(&postID, &commentID, &currentStatus)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Report not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+		return
+	}
+	if currentStatus != "open" {
+		utils.DisplayError(w, http.StatusConflict, "Report has already been reviewed")
+		return
+	}
+
+	if removeContent {
+		table, targetType, targetID := "posts", "post", postID.Int64
+		if commentID.Valid {
+			table, targetType, targetID = "comments", "comment", commentID.Int64
+		}
+		if _, err := tx.Exec("UPDATE "+table+" SET removed = 1, updated_at = CURRENT_TIMESTAMP WHERE "+targetType+"_id = ?", targetID); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Failed to remove content")
+			return
+		}
+		err = db.RecordAudit(tx, models.AuditEntry{
+			ActorID:    moderatorID,
+			Action:     targetType + ".remove",
+			TargetType: targetType,
+			TargetID:   int(targetID),
+			Before:     db.Snapshot(map[string]bool{"removed": false}),
+			After:      db.Snapshot(map[string]bool{"removed": true}),
+			Reason:     note,
+		})
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+		WHERE status = 'open' AND post_id IS ? AND comment_id IS ?`,
+		status, moderatorID, postID, commentID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+		return
+	}
+
+	err = db.RecordAudit(tx, models.AuditEntry{
+		ActorID:    moderatorID,
+		Action:     "report." + action,
+		TargetType: "report",
+		TargetID:   reportID,
+		Before:     db.Snapshot(map[string]string{"status": currentStatus}),
+		After:      db.Snapshot(map[string]interface{}{"status": status, "content_removed": removeContent}),
+		Reason:     note,
+	})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Failed to review report")
+		return
+	}
+	if removeContent {
+		if commentID.Valid {
+			// Comment reports only name the comment
+			if id, err := db.CommentPostID(int(commentID.Int64)); err != nil {
+				log.Println(err)
+			} else {
+				events.PublishComment(events.CommentDeleted, id, int(commentID.Int64))
+			}
+		} else {
+			events.PublishPost(events.PostDeleted, int(postID.Int64))
+		}
+	}
+
+	http.Redirect(w, r, "/mod/reports", http.StatusSeeOther)
+}
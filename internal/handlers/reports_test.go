@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+)
+
+func TestReportHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+
+	report := url.Values{"post_id": {"1"}, "reason": {"spam"}}
+	for i := 0; i < 2; i++ {
+		if rr := postForm(ReportHandler, "/report", "1", report); rr.Code != http.StatusSeeOther {
+			t.Fatalf("Expected status 303, got %d", rr.Code)
+		}
+	}
+
+	var count int
+	testDB.QueryRow(`SELECT COUNT(*) FROM reports WHERE post_id = 1 AND status = 'open'`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected duplicate reports to be ignored, got %d open reports", count)
+	}
+
+	// The limit counts characters, not bytes
+	details := strings.Repeat("€", maxReportDetails)
+	if rr := postForm(ReportHandler, "/report", "1", url.Values{"comment_id": {"1"}, "reason": {"spam"}, "details": {details}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303 for details at the limit, got %d", rr.Code)
+	}
+	var stored string
+	testDB.QueryRow(`SELECT details FROM reports WHERE comment_id = 1`).Scan(&stored)
+	if stored != details {
+		t.Errorf("Expected the details to be stored whole, got %d bytes", len(stored))
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want int
+	}{
+		{"unknown reason", url.Values{"post_id": {"1"}, "reason": {"boring"}}, http.StatusBadRequest},
+		{"no target", url.Values{"reason": {"spam"}}, http.StatusBadRequest},
+		{"both targets", url.Values{"post_id": {"1"}, "comment_id": {"1"}, "reason": {"spam"}}, http.StatusBadRequest},
+		{"missing comment", url.Values{"comment_id": {"42"}, "reason": {"spam"}}, http.StatusNotFound},
+		{"long details", url.Values{"comment_id": {"1"}, "reason": {"spam"}, "details": {strings.Repeat("é", maxReportDetails+1)}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := postForm(ReportHandler, "/report", "1", tt.form); rr.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+}
+
+func TestReviewReportHandler(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('mod', 'mod@test.com', 'moderator')`)
+	postForm(ReportHandler, "/report", "1", url.Values{"comment_id": {"1"}, "reason": {"harassment"}, "details": {"rude"}})
+	postForm(ReportHandler, "/report", "2", url.Values{"comment_id": {"1"}, "reason": {"spam"}})
+	postForm(ReportHandler, "/report", "1", url.Values{"post_id": {"2"}, "reason": {"off_topic"}})
+
+	req := auth.SetUserID(httptest.NewRequest("GET", "/mod/reports", nil), "2")
+	rr := httptest.NewRecorder()
+	ReportsQueueHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "Test Comment") || !strings.Contains(body, "Another content") {
+		t.Error("Expected reported content to be shown inline")
+	}
+
+	// Resolving closes every open report on the comment and removes it
+	rr = postForm(ReviewReportHandler, "/mod/reports/resolve", "2", url.Values{"report_id": {"1"}, "remove": {"1"}, "note": {"abuse"}})
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	var open, removed int
+	testDB.QueryRow(`SELECT COUNT(*) FROM reports WHERE comment_id = 1 AND status = 'open'`).Scan(&open)
+	testDB.QueryRow(`SELECT removed FROM comments WHERE comment_id = 1`).Scan(&removed)
+	if open != 0 || removed != 1 {
+		t.Errorf("Expected reports closed and comment removed, got %d open and removed=%d", open, removed)
+	}
+
+	rr = postForm(ReviewReportHandler, "/mod/reports/dismiss", "2", url.Values{"report_id": {"1"}})
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a reviewed report, got %d", rr.Code)
+	}
+
+	postForm(ReviewReportHandler, "/mod/reports/dismiss", "2", url.Values{"report_id": {"3"}})
+	var status string
+	testDB.QueryRow(`SELECT status FROM reports WHERE report_id = 3`).Scan(&status)
+	if status != "dismissed" {
+		t.Errorf("Expected report to be dismissed, got %q", status)
+	}
+
+	var actions []string
+	rows, _ := testDB.Query(`SELECT action FROM audit_log WHERE actor_id = 2 ORDER BY audit_id`)
+	for rows.Next() {
+		var action string
+		rows.Scan(&action)
+		actions = append(actions, action)
+	}
+	rows.Close()
+	if strings.Join(actions, ",") != "comment.remove,report.resolve,report.dismiss" {
+		t.Errorf("Unexpected audit log entries: %v", actions)
+	}
+
+	// Regular users cannot review reports
+	if rr := postForm(ReviewReportHandler, "/mod/reports/dismiss", "1", url.Values{"report_id": {"2"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rr.Code)
+	}
+}
+
+func TestRestoreRemovedPost(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, role) VALUES ('mod', 'mod@test.com', 'moderator')`)
+	postForm(ModeratePostHandler, "/mod/post/remove", "2", url.Values{"post_id": {"1"}})
+
+	// Removed posts are left out of every feed, so the queue lists them for restoring
+	body := getAs(ReportsQueueHandler, "/mod/reports", "2").Body.String()
+	if !strings.Contains(body, "<strong>Test Post</strong> by testuser") || !strings.Contains(body, "Restore") {
+		t.Fatal("Expected the removed post with a restore button")
+	}
+
+	if rr := postForm(ModeratePostHandler, "/mod/post/remove", "2", url.Values{"post_id": {"1"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status 303, got %d", rr.Code)
+	}
+	if body := getAs(ReportsQueueHandler, "/mod/reports", "2").Body.String(); !strings.Contains(body, "No removed posts") {
+		t.Error("Expected the restored post to leave the list")
+	}
+	if body := getAs(HomeHandler, "/", "1").Body.String(); !strings.Contains(body, "Test Post") {
+		t.Error("Expected the restored post back in the feed")
+	}
+}
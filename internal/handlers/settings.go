@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+
+	"forum/internal/account"
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/digest"
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// maxBioLength is the longest bio, in bytes, a user can set.
+const maxBioLength = 500
+
+// settingsNotices are shown after a settings form was saved, keyed by the form.
+var settingsNotices = map[string]string{
+	"profile":  "Your profile was saved.",
+	"account":  "Your account was saved.",
+	"email":    "Follow the link we emailed to your new address to confirm it. Until then your current address stays in use.",
+	"password": "Your password was changed.",
+	"verified": "Your new email address is confirmed.",
+	"kept":     "Your account will not be deleted.",
+}
+
+// SettingsHandler shows the current user's account settings.
+func SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	renderSettings(w, r, http.StatusOK, nil, settingsNotices[r.URL.Query().Get("saved")])
+}
+
+// UpdateProfileHandler saves the bio and profile picture of the current user.
+// Checking remove_picture goes back to the default avatar.
+func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/profile" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	user, err := db.UserByID(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save profile")
+		return
+	}
+
+	bio := strings.TrimSpace(r.FormValue("bio"))
+	if len(bio) > maxBioLength {
+		renderSettings(w, r, http.StatusBadRequest, map[string]string{"bio": fmt.Sprintf("Your bio can be at most %d characters", maxBioLength)}, "")
+		return
+	}
+
+	picture := user.ProfilePicture
+	if r.FormValue("remove_picture") != "" {
+		picture = ""
+	}
+	uploaded, err := utils.SaveImage(r, "img")
+	if utils.IsUploadError(err) {
+		renderSettings(w, r, http.StatusBadRequest, map[string]string{"img": err.Error()}, "")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save profile")
+		return
+	}
+	if uploaded != "" {
+		picture = uploaded
+	}
+
+	if err := db.UpdateProfile(userID, bio, picture); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save profile")
+		return
+	}
+	http.Redirect(w, r, "/settings?saved=profile", http.StatusSeeOther)
+}
+
+// UpdateAccountHandler changes the username and email address of the current
+// user. Changing the email address takes the current password, when the account
+// has one, and only takes effect once it is confirmed through the link sent to it.
+func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/account" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	user, err := db.UserByID(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to save account")
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	email := strings.TrimSpace(r.FormValue("email"))
+	errors := make(map[string]string)
+	if !utils.ValidUsername(username) {
+		errors["username"] = "Usernames are 3 to 30 letters, digits or underscores, with single dots or dashes between them"
+	}
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email {
+		errors["email"] = "Enter a valid email address"
+	}
+	emailChanged := !strings.EqualFold(email, user.Email)
+	if emailChanged {
+		storedHash, err := db.PasswordHash(userID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save account")
+			return
+		}
+		if hasLocalPassword(storedHash) && !checkPassword(storedHash, r.FormValue("current_password")) {
+			errors["account_password"] = "Enter your current password to change your email address"
+		}
+	}
+	if len(errors) == 0 && emailChanged {
+		// Checked up front so that a taken address does not leave the username half saved
+		taken, err := db.EmailTaken(email, userID)
+		if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save account")
+			return
+		}
+		if taken {
+			errors["email"] = db.ErrEmailTaken.Error()
+		}
+	}
+	if len(errors) > 0 {
+		renderSettings(w, r, http.StatusBadRequest, errors, "")
+		return
+	}
+
+	saved := "account"
+	if username != user.Username {
+		err := db.ChangeUsername(userID, username)
+		if err == db.ErrUsernameTaken {
+			renderSettings(w, r, http.StatusBadRequest, map[string]string{"username": err.Error()}, "")
+			return
+		} else if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save account")
+			return
+		}
+	}
+	if emailChanged {
+		token, err := db.RequestEmailChange(userID, email)
+		if err == db.ErrEmailTaken {
+			renderSettings(w, r, http.StatusBadRequest, map[string]string{"email": err.Error()}, "")
+			return
+		} else if err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to save account")
+			return
+		}
+		if err := digest.Mailer.Send(emailChangeMessage(email, username, token)); err != nil {
+			log.Println(err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Unable to send the confirmation email")
+			return
+		}
+		saved = "email"
+	}
+	http.Redirect(w, r, "/settings?saved="+saved, http.StatusSeeOther)
+}
+
+// emailChangeMessage is the email asking to confirm a new address.
+func emailChangeMessage(email, username, token string) mail.Message {
+	link := digest.BaseURL + "/settings/email/verify?token=" + url.QueryEscape(token)
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm that this is your new forum email address by opening this link within a day:\n\n%s\n\nIf you did not ask for this, ignore this email and nothing will change.\n",
+			username, link),
+		HTML: fmt.Sprintf("<p>Hi %s,</p><p>Confirm that this is your new forum email address by opening <a href=\"%s\">this link</a> within a day.</p><p>If you did not ask for this, ignore this email and nothing will change.</p>",
+			template.HTMLEscapeString(username), template.HTMLEscapeString(link)),
+	}
+}
+
+// VerifyEmailHandler confirms a new email address from the link sent to it. GET
+// asks first, so that link scanners in mail clients do not confirm it; POST
+// changes the address.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/email/verify" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.FormValue("token")
+	if r.Method == http.MethodGet {
+		data := struct {
+			page
+			Token string
+		}{
+			page:  newPage(r),
+			Token: token,
+		}
+		renderPage(w, "verify_email.html", data)
+		return
+	}
+
+	_, err := db.ConfirmEmailChange(token)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusBadRequest, "This link is invalid or has expired")
+		return
+	} else if err == db.ErrEmailTaken {
+		utils.DisplayError(w, http.StatusConflict, "That email address is now used by another account")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to confirm email address")
+		return
+	}
+	http.Redirect(w, r, "/settings?saved=verified", http.StatusSeeOther)
+}
+
+// ChangePasswordHandler changes the password of the current user, who has to give
+// their current one. Accounts made through GitHub or Google have no password yet
+// and can set one without. Every other session of the user ends and their API
+// tokens are revoked.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/password" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	storedHash, err := db.PasswordHash(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to change password")
+		return
+	}
+
+	password := r.FormValue("password")
+	errors := make(map[string]string)
+	if hasLocalPassword(storedHash) && !checkPassword(storedHash, r.FormValue("current_password")) {
+		errors["current_password"] = "Your current password is incorrect"
+	}
+	if !utils.ValidatePassword(password) {
+		errors["password"] = "Invalid password, please use at least one of lower case, uppercase, digits and special characters"
+	}
+	if password != r.FormValue("confirmpassword") {
+		errors["confirmpassword"] = "Passwords do not match"
+	}
+	if len(errors) > 0 {
+		renderSettings(w, r, http.StatusBadRequest, errors, "")
+		return
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("Password hashing error: %v", err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to change password")
+		return
+	}
+	var sessionID string
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		sessionID = cookie.Value
+	}
+	if err := db.SetPassword(userID, hash, sessionID); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to change password")
+		return
+	}
+	http.Redirect(w, r, "/settings?saved=password", http.StatusSeeOther)
+}
+
+// renderSettings shows the settings page with the errors of a rejected form, or a
+// notice about a saved one.
+func renderSettings(w http.ResponseWriter, r *http.Request, status int, errors map[string]string, notice string) {
+	userID := auth.GetCurrentUserID(r)
+	user, err := db.UserByID(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch settings")
+		return
+	}
+	storedHash, err := db.PasswordHash(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch settings")
+		return
+	}
+	pending, err := db.PendingEmail(userID)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch settings")
+		return
+	}
+
+	data := struct {
+		page
+		User         models.User
+		HasPassword  bool
+		PendingEmail string
+		Errors       map[string]string
+		Notice       string
+		GraceDays    int
+	}{
+		page:         newPage(r),
+		User:         user,
+		HasPassword:  hasLocalPassword(storedHash),
+		PendingEmail: pending,
+		Errors:       errors,
+		Notice:       notice,
+		GraceDays:    int(account.GracePeriod.Hours() / 24),
+	}
+	w.WriteHeader(status)
+	renderPage(w, "settings.html", data)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/digest"
+	"forum/internal/mail"
+	"forum/internal/utils"
+)
+
+// sentMail is a Mailer that keeps what it is given.
+type sentMail []mail.Message
+
+func (s *sentMail) Send(msg mail.Message) error {
+	*s = append(*s, msg)
+	return nil
+}
+
+func TestAccountSettings(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`INSERT INTO users (username, email, password) VALUES ('other', 'other@example.com', 'x')`)
+
+	var sent sentMail
+	saved := digest.Mailer
+	digest.Mailer = &sent
+	defer func() { digest.Mailer = saved }()
+
+	for _, form := range []url.Values{
+		{"username": {"no spaces"}, "email": {"test@example.com"}},
+		{"username": {"OTHER"}, "email": {"test@example.com"}},
+		{"username": {"renamed"}, "email": {"not an email"}},
+		{"username": {"renamed"}, "email": {"other@example.com"}},
+	} {
+		if rr := postForm(UpdateAccountHandler, "/settings/account", "1", form); rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", form, rr.Code)
+		}
+	}
+	if user, _ := db.UserByID(1); user.Username != "testuser" {
+		t.Fatalf("expected rejected changes to leave the username alone, got %q", user.Username)
+	}
+
+	// Changing the email address takes the current password
+	hash, _ := utils.HashPassword("Secret-passw0rd")
+	testDB.Exec(`UPDATE users SET password = ? WHERE user_id = 1`, hash)
+	form := url.Values{"username": {"renamed"}, "email": {"new@example.com"}, "current_password": {"wrong"}}
+	rr := postForm(UpdateAccountHandler, "/settings/account", "1", form)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Enter your current password") {
+		t.Fatalf("expected status 400 without the current password, got %d", rr.Code)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("expected no confirmation email, got %d", len(sent))
+	}
+
+	form.Set("current_password", "Secret-passw0rd")
+	rr = postForm(UpdateAccountHandler, "/settings/account", "1", form)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/settings?saved=email" {
+		t.Fatalf("expected the account to be saved, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	user, _ := db.UserByID(1)
+	if user.Username != "renamed" || user.Email != "test@example.com" {
+		t.Errorf("expected the new username and the old email until confirmed, got %q %q", user.Username, user.Email)
+	}
+	if body := getAs(SettingsHandler, "/settings", "1").Body.String(); !strings.Contains(body, "Waiting for you to confirm new@example.com") {
+		t.Error("expected the pending address on the settings page")
+	}
+
+	if len(sent) != 1 || sent[0].To != "new@example.com" {
+		t.Fatalf("expected a confirmation email to the new address, got %+v", sent)
+	}
+	token := sent[0].Text[strings.Index(sent[0].Text, "token=")+len("token=") : strings.Index(sent[0].Text, "\n\nIf you")]
+
+	// Opening the link asks first, the form confirms
+	if body := getAs(VerifyEmailHandler, "/settings/email/verify?token="+token, "").Body.String(); !strings.Contains(body, `value="`+token+`"`) {
+		t.Fatal("expected a confirmation form")
+	}
+	if user, _ := db.UserByID(1); user.Email != "test@example.com" {
+		t.Errorf("expected GET to leave the email alone, got %q", user.Email)
+	}
+	if rr := postForm(VerifyEmailHandler, "/settings/email/verify", "", url.Values{"token": {token}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the email to be confirmed, got %d", rr.Code)
+	}
+	if user, _ := db.UserByID(1); user.Email != "new@example.com" {
+		t.Errorf("expected the new email, got %q", user.Email)
+	}
+	if rr := postForm(VerifyEmailHandler, "/settings/email/verify", "", url.Values{"token": {token}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected the link to work once, got %d", rr.Code)
+	}
+}
+
+func TestPasswordSettings(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+	testDB.Exec(`UPDATE users SET password = 'oauth_placeholder' WHERE user_id = 1`)
+
+	// Accounts made through OAuth set a password without giving one
+	if body := getAs(SettingsHandler, "/settings", "1").Body.String(); strings.Contains(body, "current_password") {
+		t.Error("expected no current password field for an OAuth account")
+	}
+	form := url.Values{"password": {"N3w-password"}, "confirmpassword": {"N3w-password"}}
+	if rr := postForm(ChangePasswordHandler, "/settings/password", "1", form); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the password to be set, got %d", rr.Code)
+	}
+	hash, _ := db.PasswordHash(1)
+	if !checkPassword(hash, "N3w-password") {
+		t.Fatal("expected the new password to log in")
+	}
+
+	// From then on the current password is needed
+	form = url.Values{"password": {"Other-passw0rd"}, "confirmpassword": {"Other-passw0rd"}}
+	if rr := postForm(ChangePasswordHandler, "/settings/password", "1", form); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without the current password, got %d", rr.Code)
+	}
+	form.Set("current_password", "N3w-password")
+	form.Set("confirmpassword", "Other-passw0rd!")
+	if rr := postForm(ChangePasswordHandler, "/settings/password", "1", form); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a mismatched confirmation, got %d", rr.Code)
+	}
+	form.Set("confirmpassword", "Other-passw0rd")
+	if rr := postForm(ChangePasswordHandler, "/settings/password", "1", form); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the password to be changed, got %d", rr.Code)
+	}
+	if hash, _ := db.PasswordHash(1); !checkPassword(hash, "Other-passw0rd") {
+		t.Error("expected the changed password to log in")
+	}
+
+	// Changing it signs out everywhere else and revokes the API tokens
+	testDB.Exec(`INSERT INTO sessions (session_id, user_id, expires_at) VALUES ('current', 1, datetime('now', '+1 day')), ('stolen', 1, datetime('now', '+1 day'))`)
+	testDB.Exec(`INSERT INTO api_tokens (user_id, name, token_hash, prefix) VALUES (1, 'script', 'hash', 'forum_ab')`)
+	form = url.Values{"current_password": {"Other-passw0rd"}, "password": {"Th1rd-password"}, "confirmpassword": {"Th1rd-password"}}
+	req := httptest.NewRequest(http.MethodPost, "/settings/password", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "current"})
+	req = auth.SetUserID(req, "1")
+	rr := httptest.NewRecorder()
+	ChangePasswordHandler(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the password to be changed, got %d", rr.Code)
+	}
+	var sessions, tokens int
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 1 AND session_id = 'current'`).Scan(&sessions)
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = 1`).Scan(&tokens)
+	if sessions != 1 || tokens != 0 {
+		t.Errorf("expected only the current session to stay and no tokens, got session %d and %d tokens", sessions, tokens)
+	}
+	testDB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = 1`).Scan(&sessions)
+	if sessions != 1 {
+		t.Errorf("expected the other session to end, got %d sessions", sessions)
+	}
+}
+
+func TestProfileSettings(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+	insertHomeTestData(t, testDB)
+
+	dir := t.TempDir()
+	saved := utils.UploadDir
+	utils.UploadDir = dir
+	defer func() { utils.UploadDir = saved }()
+
+	// A 1x1 PNG
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+	if rr := uploadProfile(t, "Hello there", "avatar.exe", []byte("MZ not an image")); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a file that is not an image, got %d", rr.Code)
+	}
+	if rr := uploadProfile(t, "Hello there", "../../avatar.png", png); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the profile to be saved, got %d", rr.Code)
+	}
+
+	user, _ := db.UserByID(1)
+	if user.Bio != "Hello there" {
+		t.Errorf("expected the new bio, got %q", user.Bio)
+	}
+	name := strings.TrimPrefix(user.ProfilePicture, "/static/images/")
+	if name == user.ProfilePicture || !strings.HasSuffix(name, ".png") || strings.Contains(name, "avatar") {
+		t.Fatalf("expected the picture under a generated name, got %q", user.ProfilePicture)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		t.Errorf("expected the picture to be stored: %v", err)
+	}
+
+	// Saving without a file keeps the picture unless asked to remove it
+	if rr := postForm(UpdateProfileHandler, "/settings/profile", "1", url.Values{"bio": {"Bye"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the profile to be saved, got %d", rr.Code)
+	}
+	if user, _ := db.UserByID(1); user.ProfilePicture == "" || user.Bio != "Bye" {
+		t.Errorf("expected the picture to stay, got %q %q", user.ProfilePicture, user.Bio)
+	}
+	postForm(UpdateProfileHandler, "/settings/profile", "1", url.Values{"bio": {"Bye"}, "remove_picture": {"1"}})
+	if user, _ := db.UserByID(1); user.ProfilePicture != "" {
+		t.Errorf("expected the default picture, got %q", user.ProfilePicture)
+	}
+}
+
+func uploadProfile(t *testing.T, bio, filename string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("bio", bio)
+	part, err := form.CreateFormFile("img", filename)
+	if err != nil {
+		t.Fatalf("Failed to build form: %v", err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/settings/profile", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req = auth.SetUserID(req, "1")
+	rr := httptest.NewRecorder()
+	UpdateProfileHandler(rr, req)
+	return rr
+}
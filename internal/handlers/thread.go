@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/feed"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// PostHandler shows a post at /post/{id} with all of its comments, marking the
+// comments new to the current user, and then records that they have read them.
+func PostHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post/"))
+	if err != nil || postID <= 0 {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID := auth.GetCurrentUserID(r)
+	posts, err := feed.ListPosts(feed.Options{ViewerID: userID, PostID: postID})
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch post")
+		return
+	}
+	if len(posts) == 0 {
+		utils.DisplayError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if userID != 0 {
+		if err := db.MarkPostRead(userID, postID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	data := struct {
+		page
+		Post    models.Post
+		Posts   []models.Post
+		Reasons map[string]string
+	}{
+		page:    newPage(r),
+		Post:    posts[0],
+		Posts:   posts,
+		Reasons: models.ReportReasons,
+	}
+	renderPage(w, "thread.html", data)
+}
+
+// MarkPostsReadHandler marks every post as read by the current user, clearing
+// their new comment badges.
+func MarkPostsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/posts/read" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := db.MarkAllPostsRead(auth.GetCurrentUserID(r)); err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to mark posts read")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
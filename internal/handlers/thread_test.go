@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadTracking(t *testing.T) {
+	testDB := setupPrivateCategory(t)
+	defer testDB.Close()
+
+	rr := getAs(PostHandler, "/post/1", "3")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Test Post") {
+		t.Fatalf("expected the post page, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "Another Post") {
+		t.Error("expected only the one post on its page")
+	}
+
+	testDB.Exec(`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (2, 1, 2, 'Fresh reply'), (3, 1, 3, 'My own reply')`)
+	body := getAs(HomeHandler, "/", "3").Body.String()
+	if !strings.Contains(body, `href="/post/1#comment-2">1 new comments</a>`) {
+		t.Error("expected a badge for the comment by someone else since the last visit")
+	}
+	if body := getAs(HomeHandler, "/", "1").Body.String(); strings.Contains(body, "new comments</a>") {
+		t.Error("expected no badges on posts the user never opened")
+	}
+
+	body = getAs(PostHandler, "/post/1", "3").Body.String()
+	if !strings.Contains(body, "1 new comments since your last visit") || !strings.Contains(body, `href="#comment-2"`) {
+		t.Error("expected a link to the first unread comment")
+	}
+	if strings.Count(body, `class="comment unread"`) != 1 {
+		t.Error("expected only the comment by someone else to be marked unread")
+	}
+	if body := getAs(HomeHandler, "/", "3").Body.String(); strings.Contains(body, "new comments</a>") {
+		t.Error("expected opening the post to mark its comments read")
+	}
+
+	// Mark all read catches up on every post at once, without a row per post
+	testDB.Exec(`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (4, 1, 2, 'Later reply')`)
+	if body := getAs(HomeHandler, "/", "3").Body.String(); !strings.Contains(body, `href="/post/1#comment-4"`) {
+		t.Error("expected a badge for the later reply")
+	}
+	if rr := postForm(MarkPostsReadHandler, "/posts/read", "3", nil); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect, got %d", rr.Code)
+	}
+	if body := getAs(HomeHandler, "/", "3").Body.String(); strings.Contains(body, "new comments</a>") {
+		t.Error("expected no badges after marking all read")
+	}
+	var reads int
+	testDB.QueryRow(`SELECT COUNT(*) FROM post_reads WHERE user_id = 3`).Scan(&reads)
+	if reads != 1 {
+		t.Errorf("expected only the opened post to be tracked, got %d", reads)
+	}
+
+	// Afterwards new comments show on the opened post, never opened ones still have none
+	testDB.Exec(`INSERT INTO comments (comment_id, post_id, user_id, content) VALUES (5, 3, 2, 'On another post'), (6, 1, 2, 'Newest reply')`)
+	body = getAs(HomeHandler, "/", "3").Body.String()
+	if !strings.Contains(body, `href="/post/1#comment-6">1 new comments</a>`) {
+		t.Error("expected a badge for the comment after marking all read")
+	}
+	if strings.Contains(body, `href="/post/3#comment-5"`) {
+		t.Error("expected no badge on a post the user never opened")
+	}
+
+	if rr := getAs(PostHandler, "/post/2", "1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a post in a private category, got %d", rr.Code)
+	}
+	if rr := getAs(PostHandler, "/post/abc", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an invalid ID, got %d", rr.Code)
+	}
+	if rr := getAs(PostHandler, "/post/1", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected visitors to see the post, got %d", rr.Code)
+	}
+}
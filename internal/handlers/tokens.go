@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/db"
+	"forum/internal/models"
+	"forum/internal/utils"
+)
+
+// tokenLifetimes are the expiries a token can be given, zero meaning never.
+var tokenLifetimes = map[string]time.Duration{
+	"30d":   30 * 24 * time.Hour,
+	"90d":   90 * 24 * time.Hour,
+	"1y":    365 * 24 * time.Hour,
+	"never": 0,
+}
+
+// TokensHandler lists the API tokens of the current user.
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tokens" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	renderTokens(w, r, "")
+}
+
+// CreateTokenHandler creates an API token and shows it, the only time it can be seen.
+func CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tokens/create" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	scope := r.FormValue("scope")
+	lifetime, ok := tokenLifetimes[r.FormValue("expires")]
+	if name == "" || (scope != models.ScopeRead && scope != models.ScopeWrite) || !ok {
+		utils.DisplayError(w, http.StatusBadRequest, "Name, scope and a valid expiry are required")
+		return
+	}
+
+	var expiresAt *time.Time
+	if lifetime > 0 {
+		t := time.Now().Add(lifetime)
+		expiresAt = &t
+	}
+
+	token, err := db.CreateAPIToken(auth.GetCurrentUserID(r), name, scope, expiresAt)
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to create token")
+		return
+	}
+	renderTokens(w, r, token)
+}
+
+// RevokeTokenHandler deletes an API token of the current user.
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tokens/revoke" {
+		utils.DisplayError(w, http.StatusNotFound, " page not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		utils.DisplayError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		utils.DisplayError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	err = db.RevokeAPIToken(auth.GetCurrentUserID(r), tokenID)
+	if err == sql.ErrNoRows {
+		utils.DisplayError(w, http.StatusNotFound, "Token not found")
+		return
+	} else if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to revoke token")
+		return
+	}
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
+
+// renderTokens renders the token page, showing newToken when one was just created.
+func renderTokens(w http.ResponseWriter, r *http.Request, newToken string) {
+	tokens, err := db.APITokens(auth.GetCurrentUserID(r))
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Unable to fetch tokens")
+		return
+	}
+
+	data := struct {
+		page
+		Tokens   []models.APIToken
+		NewToken string
+	}{
+		page:     newPage(r),
+		Tokens:   tokens,
+		NewToken: newToken,
+	}
+
+	renderPage(w, "tokens.html", data)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTokenHandlers(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	testDB.Exec(`INSERT INTO users (username, email, password) VALUES ('alice', 'alice@test.com', ''), ('bob', 'bob@test.com', '')`)
+
+	rr := postForm(CreateTokenHandler, "/tokens/create", "1", url.Values{"name": {"backup script"}, "scope": {"read"}, "expires": {"30d"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	token := regexp.MustCompile(`forum_[0-9a-f]{40}`).FindString(rr.Body.String())
+	if token == "" {
+		t.Fatal("Expected the new token to be shown once")
+	}
+
+	var hash, prefix string
+	testDB.QueryRow(`SELECT token_hash, prefix FROM api_tokens WHERE user_id = 1`).Scan(&hash, &prefix)
+	if hash == "" || hash == token || !strings.HasPrefix(token, prefix) {
+		t.Errorf("Expected only a hash and prefix of the token to be stored, got hash %q prefix %q", hash, prefix)
+	}
+
+	rr = getAs(TokensHandler, "/tokens", "1")
+	if body := rr.Body.String(); !strings.Contains(body, "backup script") || strings.Contains(body, token) {
+		t.Error("Expected the token list to name the token without showing it")
+	}
+
+	if rr := postForm(CreateTokenHandler, "/tokens/create", "1", url.Values{"name": {"x"}, "scope": {"admin"}, "expires": {"30d"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown scope, got %d", rr.Code)
+	}
+
+	// Users can only revoke their own tokens
+	if rr := postForm(RevokeTokenHandler, "/tokens/revoke", "2", url.Values{"token_id": {"1"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 revoking someone else's token, got %d", rr.Code)
+	}
+	if rr := postForm(RevokeTokenHandler, "/tokens/revoke", "1", url.Values{"token_id": {"1"}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected status 303 revoking own token, got %d", rr.Code)
+	}
+	var count int
+	testDB.QueryRow(`SELECT COUNT(*) FROM api_tokens`).Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected the token to be deleted, %d left", count)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 
 	"forum/internal/db"
@@ -160,3 +161,83 @@ func TestLogoutHandler_POST(t *testing.T) {
 		t.Error("Session cookie not cleared")
 	}
 }
+
+func postLogin(identifier, password string) *httptest.ResponseRecorder {
+	form := url.Values{"identifier": {identifier}, "password": {password}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, req)
+	return rr
+}
+
+func TestLoginHandler_POST_Backoff(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	hashedPass, _ := bcrypt.GenerateFromPassword([]byte("Secret1!"), bcrypt.MinCost)
+	testDB.Exec("INSERT INTO users (username, email, password) VALUES (?, ?, ?)", "victim", "victim@test.com", hashedPass)
+
+	for i := 0; i < 3; i++ {
+		if rr := postLogin("victim", "wrong"); rr.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected status 200, got %d", i+1, rr.Code)
+		}
+	}
+
+	// Further attempts are rejected without checking the password, even a correct one,
+	// and the counter is shared between username and email.
+	rr := postLogin("victim@test.com", "Secret1!")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "Too many failed login attempts") {
+		t.Error("Expected backoff message in response")
+	}
+}
+
+func TestLoginHandler_POST_BackoffUnknownUser(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	for i := 0; i < 3; i++ {
+		postLogin("nobody", "wrong")
+	}
+
+	// Unknown identifiers are throttled the same way so they cannot be told apart.
+	if rr := postLogin("nobody", "wrong"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+}
+
+func TestLoginHandler_POST_BackoffParallel(t *testing.T) {
+	testDB := setupTestDB(t)
+	defer testDB.Close()
+
+	// Parallel guesses are counted before any password is checked, so no more
+	// than the free attempts get through
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- postLogin("target", "wrong").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	checked := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("expected every attempt to be checked or refused, got %d", code)
+		}
+	}
+	if checked > 3 {
+		t.Errorf("expected at most 3 attempts to be checked, got %d", checked)
+	}
+}
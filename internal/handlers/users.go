@@ -4,14 +4,13 @@ import (
 	"database/sql"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"forum/internal/auth"
 	"forum/internal/db"
 	"forum/internal/utils"
 
@@ -25,11 +24,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method == http.MethodGet {
-		tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/login.html", "web/templates/sidebar.html", "web/templates/profile.html"))
-		if err := tmpl.Execute(w, nil); err != nil {
-			log.Println(err)
-			utils.DisplayError(w, http.StatusInternalServerError, "Internal server error")
-		}
+		renderLoginPage(w, http.StatusOK, nil)
 		return
 	}
 
@@ -50,31 +45,48 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(errors) > 0 {
-			tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/login.html", "web/templates/sidebar.html", "web/templates/profile.html"))
-			if err := tmpl.Execute(w, errors); err != nil {
-				log.Println(err)
-			}
+			renderLoginPage(w, http.StatusOK, errors)
 			return
 		}
 
-		var storedHash, userID string
+		var storedHash string
+		var userID int
 		query := `SELECT user_id, password FROM users WHERE email = ? OR username = ?`
 		err := db.DB.QueryRow(query, identifier, identifier).Scan(&userID, &storedHash)
-		if err == sql.ErrNoRows {
-			errors["password"] = "Invalid username or password"
-		} else if err != nil {
+		if err != nil && err != sql.ErrNoRows {
 			log.Printf("Database query error: %v", err)
 			utils.DisplayError(w, http.StatusInternalServerError, "Server error")
 			return
-		} else if bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)) != nil {
-			errors["password"] = "Invalid username or password"
 		}
 
-		if len(errors) > 0 {
-			tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/login.html", "web/templates/sidebar.html", "web/templates/profile.html"))
-			if err := tmpl.Execute(w, errors); err != nil {
-				log.Println(err)
+		accountKey := auth.AccountKey(userID, identifier)
+		ip := utils.ClientIP(r)
+		wait, err := auth.BeginLoginAttempt(accountKey, ip)
+		if err != nil {
+			log.Printf("Login backoff error: %v", err)
+			utils.DisplayError(w, http.StatusInternalServerError, "Server error")
+			return
+		}
+		if wait > 0 {
+			errors["password"] = "Too many failed login attempts. Try again in " + formatWait(wait)
+			renderLoginPage(w, http.StatusTooManyRequests, errors)
+			return
+		}
+
+		if !checkPassword(storedHash, password) {
+			if err := auth.RecordLoginFailure(accountKey, userID); err != nil {
+				log.Printf("Login attempt error: %v", err)
 			}
+			errors["password"] = "Invalid username or password"
+			renderLoginPage(w, http.StatusOK, errors)
+			return
+		}
+
+		if err := auth.ClearLoginFailures(accountKey); err != nil {
+			log.Printf("Login attempt error: %v", err)
+		}
+
+		if rejectBanned(w, userID) {
 			return
 		}
 
@@ -100,6 +112,64 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rejectBanned shows the ban page instead of logging the user in and reports
+// whether it did so.
+func rejectBanned(w http.ResponseWriter, userID int) bool {
+	ban, err := db.ActiveBan(userID)
+	if err != nil {
+		log.Printf("Ban lookup error: %v", err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Server error")
+		return true
+	}
+	if ban != nil {
+		utils.DisplayBanned(w, ban)
+		return true
+	}
+	return false
+}
+
+// dummyHash is compared against when the identifier matches no local password so
+// that unknown users take as long to reject as known ones.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("forum-dummy-password"), bcrypt.DefaultCost)
+
+// checkPassword compares password with storedHash in constant time with respect to
+// whether the account exists or only has an OAuth placeholder password.
+func checkPassword(storedHash, password string) bool {
+	if !hasLocalPassword(storedHash) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)) == nil
+}
+
+// hasLocalPassword reports whether a stored password can be logged in with, as
+// opposed to the placeholder of accounts made through GitHub or Google.
+func hasLocalPassword(storedHash string) bool {
+	_, err := bcrypt.Cost([]byte(storedHash))
+	return err == nil
+}
+
+// formatWait rounds a backoff duration up to something readable.
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int(math.Ceil(d.Seconds())))
+	}
+	return fmt.Sprintf("%d minutes", int(math.Ceil(d.Minutes())))
+}
+
+func renderLoginPage(w http.ResponseWriter, status int, errors map[string]string) {
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/login.html", "web/templates/sidebar.html", "web/templates/profile.html")
+	if err != nil {
+		log.Println(err)
+		utils.DisplayError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, errors); err != nil {
+		log.Println(err)
+	}
+}
+
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/register" {
 		utils.DisplayError(w, http.StatusNotFound, " page not found")
@@ -115,7 +185,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodPost {
-		if err := r.ParseMultipartForm(20); err != nil {
+		if err := r.ParseMultipartForm(20); err != nil && err != http.ErrNotMultipart {
 			utils.DisplayError(w, http.StatusBadRequest, "Failed to parse form")
 			return
 		}
@@ -148,19 +218,8 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			errors["password"] = "Invalid password, please use at least one of lower case, uppercase, digits and special characters"
 		}
 
-		file, headers, err := r.FormFile("img")
-		imgurl := ""
-		if err == nil {
-			dst, err := os.Create(filepath.Join("web/static/images", headers.Filename))
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-			io.Copy(dst, file)
-			imgurl = strings.Replace(dst.Name(), "web", "..", 1)
-		}
-
 		var exists bool
-		err = db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ? OR username = ?)`, email, username).Scan(&exists)
+		err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ? OR username = ?)`, email, username).Scan(&exists)
 		if err != nil && err != sql.ErrNoRows {
 			log.Printf("Database query error: %v", err)
 			utils.DisplayError(w, http.StatusInternalServerError, "Server error")
@@ -170,6 +229,19 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			errors["username"] = "Username or email already exists"
 		}
 
+		// The picture is only stored once the rest of the form is valid
+		imgurl := ""
+		if len(errors) == 0 {
+			imgurl, err = utils.SaveImage(r, "img")
+			if utils.IsUploadError(err) {
+				errors["img"] = err.Error()
+			} else if err != nil {
+				log.Println(err)
+				utils.DisplayError(w, http.StatusInternalServerError, "Server error")
+				return
+			}
+		}
+
 		if len(errors) > 0 {
 			tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/register.html", "web/templates/sidebar.html", "web/templates/profile.html"))
 			if err := tmpl.Execute(w, errors); err != nil {
@@ -0,0 +1,403 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/db"
+	"forum/internal/models"
+)
+
+const (
+	// historySize is how many earlier messages a client gets when it joins.
+	historySize = 50
+	// sendBuffer is how many messages a client may fall behind before it is
+	// disconnected.
+	sendBuffer = 32
+	// maxMessageLength is the longest chat message, in characters.
+	maxMessageLength = 1000
+	// maxFrameSize is the largest frame a client may send: a message of
+	// maxMessageLength characters escaped as \uXXXX surrogate pairs, 12 bytes each
+	// in the worst case, and the JSON object around it.
+	maxFrameSize = 12*maxMessageLength + 256
+	// messageBurst messages may be sent within messageWindow.
+	messageBurst  = 5
+	messageWindow = 10 * time.Second
+)
+
+// Timing of the keep-alive pings and of the checks that a connected user may
+// still be in the room. Variables so tests can shorten them.
+var (
+	pingInterval   = 30 * time.Second
+	readTimeout    = 60 * time.Second
+	accessInterval = 30 * time.Second
+)
+
+// Outgoing chat frame types.
+const (
+	TypeHistory  = "history"
+	TypeMessage  = "message"
+	TypePresence = "presence"
+	TypeError    = "error"
+)
+
+// Frame is what clients receive, as JSON text messages.
+type Frame struct {
+	Type     string               `json:"type"`
+	Messages []models.ChatMessage `json:"messages,omitempty"`
+	Message  *models.ChatMessage  `json:"message,omitempty"`
+	Users    []string             `json:"users,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// incoming is what clients send.
+type incoming struct {
+	Content string `json:"content"`
+}
+
+// Hub holds the chat rooms, one per category, and the clients connected to them.
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[int]map[*Client]struct{}
+}
+
+// Client is a user connected to a chat room.
+type Client struct {
+	hub        *Hub
+	conn       *Conn
+	categoryID int
+	userID     int
+	username   string
+	send       chan []byte
+	closeCode  int
+	closed     bool // guarded by hub.mu
+	sent       []time.Time
+}
+
+// New returns a hub without rooms.
+func New() *Hub {
+	return &Hub{rooms: make(map[int]map[*Client]struct{})}
+}
+
+// Default is the hub of the running server.
+var Default = New()
+
+// Serve runs a chat connection until it closes: the user joins the room of the
+// category, gets its recent history, and their messages are saved and relayed to
+// everyone in the room. The caller checks that the user may see the category;
+// whether they may write is checked for every message. Users who are banned or
+// lose access to the category are disconnected within accessInterval.
+func (h *Hub) Serve(conn *Conn, categoryID int, user models.User) {
+	conn.MaxSize = maxFrameSize
+	conn.ReadTimeout = readTimeout
+	c := &Client{
+		hub:        h,
+		conn:       conn,
+		categoryID: categoryID,
+		userID:     user.UserID,
+		username:   user.Username,
+		send:       make(chan []byte, sendBuffer),
+		closeCode:  CloseNormal,
+	}
+
+	history, err := db.ChatHistory(categoryID, historySize)
+	if err != nil {
+		log.Printf("chat: %v", err)
+		conn.Close(CloseGoingAway, "failed to load history")
+		return
+	}
+	c.send <- encode(Frame{Type: TypeHistory, Messages: history})
+
+	h.join(c)
+	go c.writeLoop()
+	defer h.leave(c, CloseNormal)
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *CloseError
+			if !errors.As(err, &closeErr) && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+				log.Printf("chat: read failed: %v", err)
+			}
+			return
+		}
+		if frame, ok := c.handle(data); !ok {
+			return
+		} else if frame != nil {
+			h.deliver(c, encode(*frame))
+		}
+	}
+}
+
+// handle processes one message from the client. It returns an error frame for the
+// client alone, if any, and false when the client must be disconnected.
+func (c *Client) handle(data []byte) (*Frame, bool) {
+	var in incoming
+	if err := json.Unmarshal(data, &in); err != nil {
+		return &Frame{Type: TypeError, Error: "Invalid message"}, true
+	}
+	content := strings.TrimSpace(in.Content)
+	if content == "" {
+		return &Frame{Type: TypeError, Error: "Message is empty"}, true
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return &Frame{Type: TypeError, Error: "Message is too long"}, true
+	}
+	if !c.allowMessage(time.Now()) {
+		return &Frame{Type: TypeError, Error: "You are sending messages too fast"}, true
+	}
+
+	// Bans and permissions may change while the connection is open
+	access, err := c.access()
+	if err != nil {
+		log.Printf("chat: %v", err)
+		return &Frame{Type: TypeError, Error: "Failed to send message"}, true
+	}
+	if !access.View {
+		c.hub.leave(c, ClosePolicyViolation)
+		return nil, false
+	}
+	if !access.Comment {
+		return &Frame{Type: TypeError, Error: "You may not write in this room"}, true
+	}
+
+	message, err := db.SaveChatMessage(c.categoryID, c.userID, content)
+	if err != nil {
+		log.Printf("chat: %v", err)
+		return &Frame{Type: TypeError, Error: "Failed to send message"}, true
+	}
+	c.hub.broadcast(c.categoryID, encode(Frame{Type: TypeMessage, Message: &message}))
+	return nil, true
+}
+
+// access returns what the client's user may currently do in the room. Banned
+// users may do nothing.
+func (c *Client) access() (models.Access, error) {
+	ban, err := db.ActiveBan(c.userID)
+	if err != nil || ban != nil {
+		return models.Access{}, err
+	}
+	return db.CategoryAccess(c.userID, c.categoryID)
+}
+
+// allowMessage reports whether the client may send another message now, allowing
+// messageBurst messages per messageWindow.
+func (c *Client) allowMessage(now time.Time) bool {
+	recent := c.sent[:0]
+	for _, t := range c.sent {
+		if now.Sub(t) < messageWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.sent = recent
+	if len(c.sent) >= messageBurst {
+		return false
+	}
+	c.sent = append(c.sent, now)
+	return true
+}
+
+// writeLoop sends queued messages and keep-alive pings until the client is
+// closed, then closes the connection. In between it disconnects users who may no
+// longer see the room, including those who stay silent.
+func (c *Client) writeLoop() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	check := time.NewTicker(accessInterval)
+	defer check.Stop()
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				c.conn.Close(c.closeCode, closeReason(c.closeCode))
+				return
+			}
+			if err := c.conn.WriteText(data); err != nil {
+				c.hub.leave(c, CloseGoingAway)
+				c.conn.Close(CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.Ping(); err != nil {
+				c.hub.leave(c, CloseGoingAway)
+				c.conn.Close(CloseGoingAway, "")
+				return
+			}
+		case <-check.C:
+			// Leaving closes the send channel, which ends the loop above
+			if access, err := c.access(); err != nil {
+				log.Printf("chat: %v", err)
+			} else if !access.View {
+				c.hub.leave(c, ClosePolicyViolation)
+			}
+		}
+	}
+}
+
+func closeReason(code int) string {
+	switch code {
+	case CloseTryAgainLater:
+		return "too slow"
+	case ClosePolicyViolation:
+		return "not allowed"
+	}
+	return ""
+}
+
+// join adds the client to its room and tells the room who is there.
+func (h *Hub) join(c *Client) {
+	h.mu.Lock()
+	room := h.rooms[c.categoryID]
+	if room == nil {
+		room = make(map[*Client]struct{})
+		h.rooms[c.categoryID] = room
+	}
+	room[c] = struct{}{}
+	h.mu.Unlock()
+
+	h.broadcastPresence(c.categoryID)
+}
+
+// leave removes the client from its room and stops its writer, which closes the
+// connection with code. It is safe to call more than once.
+func (h *Hub) leave(c *Client, code int) {
+	h.mu.Lock()
+	removed := h.remove(c, code)
+	h.mu.Unlock()
+
+	if removed {
+		h.broadcastPresence(c.categoryID)
+	}
+}
+
+// remove takes the client out of its room. It must be called with h.mu held and
+// reports whether the client was still there.
+func (h *Hub) remove(c *Client, code int) bool {
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	c.closeCode = code
+	close(c.send)
+
+	room := h.rooms[c.categoryID]
+	delete(room, c)
+	if len(room) == 0 {
+		delete(h.rooms, c.categoryID)
+	}
+	return true
+}
+
+// Disconnect closes every chat connection of a user, in all rooms.
+func (h *Hub) Disconnect(userID int) {
+	h.mu.Lock()
+	rooms := make(map[int]bool)
+	for categoryID, room := range h.rooms {
+		for c := range room {
+			if c.userID == userID && h.remove(c, ClosePolicyViolation) {
+				rooms[categoryID] = true
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	for categoryID := range rooms {
+		h.broadcastPresence(categoryID)
+	}
+}
+
+// CloseRoom closes every connection to the chat room of a category, for rooms that
+// no longer exist.
+func (h *Hub) CloseRoom(categoryID int) {
+	h.mu.Lock()
+	for c := range h.rooms[categoryID] {
+		h.remove(c, CloseGoingAway)
+	}
+	h.mu.Unlock()
+}
+
+// deliver queues a frame for a single client.
+func (h *Hub) deliver(c *Client, data []byte) {
+	h.mu.Lock()
+	dropped := !c.closed && !h.enqueue(c, data)
+	h.mu.Unlock()
+
+	if dropped {
+		h.broadcastPresence(c.categoryID)
+	}
+}
+
+// broadcast queues a frame for everyone in a room. Clients too far behind to take
+// it are disconnected rather than holding up the room.
+func (h *Hub) broadcast(categoryID int, data []byte) {
+	h.mu.Lock()
+	dropped := false
+	for c := range h.rooms[categoryID] {
+		if !h.enqueue(c, data) {
+			dropped = true
+		}
+	}
+	h.mu.Unlock()
+
+	if dropped {
+		h.broadcastPresence(categoryID)
+	}
+}
+
+// enqueue hands data to the client's writer without blocking, or disconnects the
+// client when its buffer is full. It must be called with h.mu held.
+func (h *Hub) enqueue(c *Client, data []byte) bool {
+	select {
+	case c.send <- data:
+		return true
+	default:
+		h.remove(c, CloseTryAgainLater)
+		return false
+	}
+}
+
+// broadcastPresence sends the room the names of the users in it.
+func (h *Hub) broadcastPresence(categoryID int) {
+	users := h.Presence(categoryID)
+	if len(users) == 0 {
+		return
+	}
+	h.broadcast(categoryID, encode(Frame{Type: TypePresence, Users: users}))
+}
+
+// Presence returns the sorted names of the users in a room. Users connected more
+// than once are listed once.
+func (h *Hub) Presence(categoryID int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var users []string
+	for c := range h.rooms[categoryID] {
+		if !seen[c.username] {
+			seen[c.username] = true
+			users = append(users, c.username)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+func encode(f Frame) []byte {
+	// Frames only hold plain data, which always marshals
+	data, _ := json.Marshal(f)
+	return data
+}
+
+func isTimeout(err error) bool {
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
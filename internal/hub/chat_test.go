@@ -0,0 +1,247 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"forum/internal/db"
+)
+
+// setupChat opens a fresh database with users alice (1) and bob (2), and serves a
+// hub on it with the room of the first default category. Clients pick their user with ?user=.
+func setupChat(t *testing.T) (*Hub, *httptest.Server) {
+	t.Helper()
+	if err := db.Init("file:" + t.Name() + "?mode=memory&cache=shared"); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	_, err := db.DB.Exec(`INSERT INTO users (user_id, username, email, password) VALUES
+		(1, 'alice', 'alice@example.com', 'x'), (2, 'bob', 'bob@example.com', 'x')`)
+	if err != nil {
+		t.Fatalf("Failed to insert users: %v", err)
+	}
+
+	h := New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.URL.Query().Get("user"))
+		user, err := db.UserByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		h.Serve(conn, 1, user)
+	}))
+	t.Cleanup(server.Close)
+	return h, server
+}
+
+// readChat reads the next chat frame, skipping pings.
+func (c *testClient) readChat() Frame {
+	c.t.Helper()
+	for {
+		opcode, payload := c.readFrame()
+		if opcode != opText {
+			continue
+		}
+		var f Frame
+		if err := json.Unmarshal(payload, &f); err != nil {
+			c.t.Fatalf("invalid frame %q: %v", payload, err)
+		}
+		return f
+	}
+}
+
+func (c *testClient) expectPresence(users ...string) {
+	c.t.Helper()
+	f := c.readChat()
+	if f.Type != TypePresence || !reflect.DeepEqual(f.Users, users) {
+		c.t.Fatalf("expected presence %v, got %+v", users, f)
+	}
+}
+
+func TestChatRoom(t *testing.T) {
+	h, server := setupChat(t)
+
+	alice := dial(t, server, "/?user=1")
+	if f := alice.readChat(); f.Type != TypeHistory || len(f.Messages) != 0 {
+		t.Fatalf("expected empty history, got %+v", f)
+	}
+	alice.expectPresence("alice")
+
+	bob := dial(t, server, "/?user=2")
+	if f := bob.readChat(); f.Type != TypeHistory {
+		t.Fatalf("expected history, got %+v", f)
+	}
+	bob.expectPresence("alice", "bob")
+	alice.expectPresence("alice", "bob")
+
+	bob.send(`{"content": "  hi alice  "}`)
+	for _, c := range []*testClient{alice, bob} {
+		f := c.readChat()
+		if f.Type != TypeMessage || f.Message.Username != "bob" || f.Message.Content != "hi alice" {
+			t.Fatalf("expected bob's message, got %+v", f)
+		}
+	}
+
+	bob.send(`{"content": ""}`)
+	if f := bob.readChat(); f.Type != TypeError {
+		t.Errorf("expected an error for an empty message, got %+v", f)
+	}
+
+	// Later arrivals get the history
+	late := dial(t, server, "/?user=1")
+	f := late.readChat()
+	if f.Type != TypeHistory || len(f.Messages) != 1 || f.Messages[0].Content != "hi alice" {
+		t.Fatalf("expected the message in history, got %+v", f)
+	}
+	late.expectPresence("alice", "bob")
+
+	bob.writeFrame(true, opClose, []byte{0x03, 0xE8})
+	bob.expectClose(CloseNormal)
+	alice.expectPresence("alice", "bob") // from the late join
+	alice.expectPresence("alice")
+
+	if got := h.Presence(1); !reflect.DeepEqual(got, []string{"alice"}) {
+		t.Errorf("expected alice alone in the room, got %v", got)
+	}
+}
+
+func TestChatRateLimit(t *testing.T) {
+	_, server := setupChat(t)
+
+	alice := dial(t, server, "/?user=1")
+	alice.readChat()
+	alice.expectPresence("alice")
+
+	for i := 0; i < messageBurst; i++ {
+		alice.send(`{"content": "spam"}`)
+		if f := alice.readChat(); f.Type != TypeMessage {
+			t.Fatalf("message %d: expected it to be sent, got %+v", i, f)
+		}
+	}
+	alice.send(`{"content": "spam"}`)
+	if f := alice.readChat(); f.Type != TypeError {
+		t.Errorf("expected to be slowed down, got %+v", f)
+	}
+}
+
+func TestChatDisconnectsBannedUsers(t *testing.T) {
+	_, server := setupChat(t)
+
+	bob := dial(t, server, "/?user=2")
+	bob.readChat()
+	bob.expectPresence("bob")
+
+	if _, err := db.DB.Exec(`INSERT INTO bans (user_id, banned_by, reason) VALUES (2, 1, 'spam')`); err != nil {
+		t.Fatalf("Failed to ban bob: %v", err)
+	}
+	bob.send(`{"content": "still here?"}`)
+	bob.expectClose(ClosePolicyViolation)
+
+	var count int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM chat_messages`).Scan(&count)
+	if count != 0 {
+		t.Errorf("expected no saved messages, got %d", count)
+	}
+}
+
+func TestChatDisconnectsSilentBannedUsers(t *testing.T) {
+	interval := accessInterval
+	t.Cleanup(func() { accessInterval = interval })
+	accessInterval = 20 * time.Millisecond
+	_, server := setupChat(t)
+
+	bob := dial(t, server, "/?user=2")
+	bob.readChat()
+	bob.expectPresence("bob")
+
+	if _, err := db.DB.Exec(`INSERT INTO bans (user_id, banned_by, reason) VALUES (2, 1, 'spam')`); err != nil {
+		t.Fatalf("Failed to ban bob: %v", err)
+	}
+	bob.expectClose(ClosePolicyViolation)
+}
+
+func TestChatAcceptsEscapedMessages(t *testing.T) {
+	_, server := setupChat(t)
+
+	alice := dial(t, server, "/?user=1")
+	alice.readChat()
+	alice.expectPresence("alice")
+
+	// Every character escaped as a surrogate pair, at the length limit
+	alice.send(`{"content": "` + strings.Repeat(`\ud83d\ude00`, maxMessageLength) + `"}`)
+	if f := alice.readChat(); f.Type != TypeMessage || utf8.RuneCountInString(f.Message.Content) != maxMessageLength {
+		t.Errorf("expected the message to be relayed, got %+v", f.Type)
+	}
+}
+
+func TestDisconnectUser(t *testing.T) {
+	h, server := setupChat(t)
+
+	alice := dial(t, server, "/?user=1")
+	alice.readChat()
+	alice.expectPresence("alice")
+	bob := dial(t, server, "/?user=2")
+	bob.readChat()
+	bob.expectPresence("alice", "bob")
+	alice.expectPresence("alice", "bob")
+
+	h.Disconnect(2)
+	bob.expectClose(ClosePolicyViolation)
+	alice.expectPresence("alice")
+}
+
+func TestCloseRoom(t *testing.T) {
+	h, server := setupChat(t)
+
+	alice := dial(t, server, "/?user=1")
+	alice.readChat()
+	alice.expectPresence("alice")
+
+	h.CloseRoom(1)
+	alice.expectClose(CloseGoingAway)
+	if got := h.Presence(1); len(got) != 0 {
+		t.Errorf("expected the room to be empty, got %v", got)
+	}
+}
+
+func TestSlowClientsAreDropped(t *testing.T) {
+	h := New()
+	slow := &Client{hub: h, categoryID: 1, username: "slow", send: make(chan []byte, 1)}
+	fast := &Client{hub: h, categoryID: 1, username: "fast", send: make(chan []byte, sendBuffer)}
+	h.join(slow) // fills the slow client's buffer with the presence frame
+	h.join(fast)
+
+	if slow.closed != true || slow.closeCode != CloseTryAgainLater {
+		t.Fatalf("expected the slow client to be dropped, got closed=%v code=%d", slow.closed, slow.closeCode)
+	}
+	if got := h.Presence(1); !reflect.DeepEqual(got, []string{"fast"}) {
+		t.Errorf("expected only the fast client in the room, got %v", got)
+	}
+
+	// The fast client saw itself join, then the slow one leave
+	var last Frame
+	for len(fast.send) > 0 {
+		json.Unmarshal(<-fast.send, &last)
+	}
+	if last.Type != TypePresence || !reflect.DeepEqual(last.Users, []string{"fast"}) {
+		t.Errorf("expected a presence update without the slow client, got %+v", last)
+	}
+
+	h.leave(fast, CloseNormal)
+	h.leave(fast, CloseNormal)
+	if len(h.rooms) != 0 {
+		t.Errorf("expected empty rooms to be removed, got %d", len(h.rooms))
+	}
+}
@@ -38,7 +38,7 @@ func FindOrCreateUser(githubUser *GitHubUser) (int, error) {
 	if err == nil {
 		// Update existing user with Github info
 		_, err = db.DB.Exec(
-			"UPDATE users SET provider_id = ?, auth_type = 'github' WHERE user_id = ?",
+			"UPDATE users SET provider_id = ?, auth_type = 'github', email_verified = 1 WHERE user_id = ?",
 			githubUser.ID,
 			userID,
 		)
@@ -46,7 +46,7 @@ func FindOrCreateUser(githubUser *GitHubUser) (int, error) {
 	}
 
 	result, err := db.DB.Exec(
-		"INSERT INTO users (email, username, password, auth_type, provider_id) VALUES (?,?,?, 'github', ?)",
+		"INSERT INTO users (email, username, password, auth_type, provider_id, email_verified) VALUES (?,?,?, 'github', ?, 1)",
 		githubUser.Email,
 		username,
 		"oauth_placeholder", // Password placeholder
@@ -0,0 +1,243 @@
+package hub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// db.Init reads the schema relative to the project root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// testClient is the client side of a WebSocket connection, just enough to talk
+// to Conn.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dial opens a WebSocket connection to path on server.
+func dial(t *testing.T, server *httptest.Server, path string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n",
+		path, strings.TrimPrefix(server.URL, "http://"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", got)
+	}
+	return &testClient{t: t, conn: conn, br: br}
+}
+
+// writeFrame sends a masked frame.
+func (c *testClient) writeFrame(fin bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("write failed: %v", err)
+	}
+}
+
+func (c *testClient) send(message string) {
+	c.t.Helper()
+	c.writeFrame(true, opText, []byte(message))
+}
+
+// readFrame reads the next frame from the server, failing the test if none comes.
+func (c *testClient) readFrame() (byte, []byte) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatalf("read failed: %v", err)
+	}
+	if header[1]&0x80 != 0 {
+		c.t.Fatal("server frames must not be masked")
+	}
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("read failed: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// expectClose reads frames until a close frame and checks its code.
+func (c *testClient) expectClose(code int) {
+	c.t.Helper()
+	for {
+		opcode, payload := c.readFrame()
+		if opcode != opClose {
+			continue
+		}
+		if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+			c.t.Fatalf("expected close code %d, got %v", code, payload)
+		}
+		return
+	}
+}
+
+// echoServer echoes every text message back until the connection fails.
+func echoServer(t *testing.T, maxSize int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.MaxSize = maxSize
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteText(message)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpgradeRejectsInvalidRequests(t *testing.T) {
+	server := echoServer(t, 0)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"Plain request", map[string]string{}, http.StatusBadRequest},
+		{"Wrong version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"Missing key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest},
+		{"Other origin", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			if tt.name != "Plain request" {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Sec-WebSocket-Version", "13")
+				req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestConnMessages(t *testing.T) {
+	server := echoServer(t, 100)
+
+	t.Run("Echoes fragmented messages and answers pings", func(t *testing.T) {
+		c := dial(t, server, "/")
+		c.writeFrame(false, opText, []byte("hel"))
+		c.writeFrame(true, opPing, []byte("are you there"))
+		c.writeFrame(true, opContinuation, []byte("lo"))
+
+		if opcode, payload := c.readFrame(); opcode != opPong || string(payload) != "are you there" {
+			t.Errorf("expected pong, got opcode %d %q", opcode, payload)
+		}
+		if opcode, payload := c.readFrame(); opcode != opText || string(payload) != "hello" {
+			t.Errorf("expected hello, got opcode %d %q", opcode, payload)
+		}
+	})
+
+	t.Run("Handles long frames", func(t *testing.T) {
+		long := strings.Repeat("a", 100)
+		c := dial(t, server, "/")
+		c.send(long)
+		if _, payload := c.readFrame(); string(payload) != long {
+			t.Errorf("expected the long message back, got %d bytes", len(payload))
+		}
+	})
+
+	t.Run("Answers close", func(t *testing.T) {
+		c := dial(t, server, "/")
+		c.writeFrame(true, opClose, []byte{0x03, 0xE8})
+		c.expectClose(CloseNormal)
+	})
+
+	failures := []struct {
+		name  string
+		write func(c *testClient)
+		code  int
+	}{
+		{"Binary message", func(c *testClient) { c.writeFrame(true, opBinary, []byte{1}) }, CloseUnsupportedData},
+		{"Too big", func(c *testClient) { c.send(strings.Repeat("a", 101)) }, CloseTooBig},
+		{"Invalid UTF-8", func(c *testClient) { c.send("\xff") }, CloseInvalidPayload},
+		{"Stray continuation", func(c *testClient) { c.writeFrame(true, opContinuation, []byte("a")) }, CloseProtocolError},
+		{"Unmasked frame", func(c *testClient) { c.conn.Write([]byte{0x81, 0x01, 'a'}) }, CloseProtocolError},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, server, "/")
+			tt.write(c)
+			c.expectClose(tt.code)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package mail sends email through a Mailer: SMTP when it is configured, the
+// server log otherwise.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML version of its body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // extra headers, such as List-Unsubscribe
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTP sends messages through an SMTP server.
+type SMTP struct {
+	Addr string // host:port
+	From string
+	Auth smtp.Auth // nil when the server needs no login
+}
+
+// Send delivers msg to its recipient.
+func (s SMTP) Send(msg Message) error {
+	data, err := Build(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("failed to send email to %s: %v", msg.To, err)
+	}
+	return nil
+}
+
+// Log writes messages to the server log instead of sending them, for when no
+// SMTP server is configured.
+type Log struct{}
+
+// Send logs the recipient, subject and text of msg.
+func (Log) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// FromEnv returns an SMTP mailer for the server in SMTP_HOST and SMTP_PORT
+// (587 by default), logging in with SMTP_USERNAME and SMTP_PASSWORD when set and
+// sending from MAIL_FROM. Without SMTP_HOST it returns Log.
+func FromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("Warning: SMTP_HOST not configured, emails will only be logged")
+		return Log{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "forum@" + host
+	}
+
+	s := SMTP{Addr: host + ":" + port, From: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		s.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return s
+}
+
+// Build formats msg as a multipart/alternative email from the given sender.
+func Build(from string, msg Message, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + body.Boundary(),
+	}
+	for name, value := range msg.Headers {
+		headers[name] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&out, "%s: %s\r\n", name, headers[name])
+	}
+	out.WriteString("\r\n")
+
+	// Clients show the last part they can display, so HTML goes last
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %v", err)
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
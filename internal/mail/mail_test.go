@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	msg := Message{
+		To:      "alice@example.com",
+		Subject: "Your weekly digest ✉",
+		Text:    "Hello alice",
+		HTML:    "<p>Hello alice</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://forum.example/unsubscribe?token=x>"},
+	}
+	data, err := Build("forum@example.com", msg, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to build email: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse email: %v", err)
+	}
+	if got := parsed.Header.Get("To"); got != msg.To {
+		t.Errorf("expected To %q, got %q", msg.To, got)
+	}
+	if got, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); got != msg.Subject {
+		t.Errorf("expected the subject %q, got %q", msg.Subject, got)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe"); got != msg.Headers["List-Unsubscribe"] {
+		t.Errorf("expected the extra header to be kept, got %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative email, got %q", parsed.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Errorf("expected a text then an HTML part, got %v", types)
+	}
+	if len(bodies) == 2 && (bodies[0] != msg.Text || bodies[1] != msg.HTML) {
+		t.Errorf("expected the bodies to be kept, got %q", bodies)
+	}
+}
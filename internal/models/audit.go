@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditEntry is a privileged action recorded in the audit log. Before and After
+// hold JSON snapshots of the target.
+type AuditEntry struct {
+	AuditID    int
+	ActorID    int
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   int
+	Before     string
+	After      string
+	Reason     string
+	CreatedAt  time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Ban struct {
+	BanID     int
+	UserID    int
+	Username  string
+	BannedBy  string
+	Reason    string
+	ExpiresAt *time.Time // nil for permanent bans
+	CreatedAt time.Time
+}
+
+// Permanent reports whether the ban never expires.
+func (b Ban) Permanent() bool {
+	return b.ExpiresAt == nil
+}
@@ -1,6 +1,53 @@
 package models
 
+import "strings"
+
 type Categories struct {
-	CategoryID int
-	Name       string
+	CategoryID     int    `json:"category_id"`
+	ParentID       int    `json:"parent_id,omitempty"` // 0 for top level categories
+	Name           string `json:"name"`
+	Slug           string `json:"slug"`
+	Description    string `json:"description"`
+	SortOrder      int    `json:"sort_order"`
+	Archived       bool   `json:"archived"`
+	Private        bool   `json:"private"`
+	PostCount      int    `json:"-"`
+	LatestActivity string `json:"-"`
+	Depth          int    `json:"depth"` // nesting level once ordered by SortTree
+}
+
+// Label is the name indented by depth, for flat lists such as select options.
+func (c Categories) Label() string {
+	return strings.Repeat("— ", c.Depth) + c.Name
+}
+
+// SortTree orders categories so every category is followed by its subcategories,
+// keeping the given order among siblings, and sets their Depth. Categories whose
+// parent is not in the list are treated as top level.
+func SortTree(categories []Categories) []Categories {
+	present := make(map[int]bool, len(categories))
+	for _, c := range categories {
+		present[c.CategoryID] = true
+	}
+
+	children := make(map[int][]Categories)
+	for _, c := range categories {
+		parent := c.ParentID
+		if !present[parent] {
+			parent = 0
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	sorted := make([]Categories, 0, len(categories))
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		for _, c := range children[parent] {
+			c.Depth = depth
+			sorted = append(sorted, c)
+			walk(c.CategoryID, depth+1)
+		}
+	}
+	walk(0, 0)
+	return sorted
 }
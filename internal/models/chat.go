@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ChatMessage is a message in the chat room of a category.
+type ChatMessage struct {
+	MessageID  int       `json:"message_id"`
+	CategoryID int       `json:"category_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -3,13 +3,15 @@ package models
 import "time"
 
 type Comment struct {
-	CommentID    int       `db:"comment_id"`
-	PostID       int       `db:"post_id"`
-	UserID       int       `db:"user_id"`
-	Content      string    `db:"content"`
-	Username     string    `db:"user_name"`
-	CreatedAt    string    `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
-	LikeCount    int
-	DislikeCount int
+	CommentID    int       `db:"comment_id" json:"comment_id"`
+	PostID       int       `db:"post_id" json:"post_id"`
+	UserID       int       `db:"user_id" json:"user_id"`
+	Content      string    `db:"content" json:"content"`
+	Username     string    `db:"user_name" json:"username"`
+	CreatedAt    string    `db:"created_at" json:"created_ago"` // humanized, as shown on the pages
+	Created      time.Time `json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	LikeCount    int       `json:"like_count"`
+	DislikeCount int       `json:"dislike_count"`
+	PostTitle    string    `json:"-"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Email digest frequencies.
+const (
+	DigestImmediate = "immediate" // each new notification, within minutes
+	DigestDaily     = "daily"
+	DigestWeekly    = "weekly"
+	DigestOff       = "off"
+)
+
+// DigestFrequencies lists the frequencies a user may choose, in the order they
+// are offered.
+var DigestFrequencies = []string{DigestImmediate, DigestDaily, DigestWeekly, DigestOff}
+
+// DigestSubscriber is a user who gets email digests.
+type DigestSubscriber struct {
+	UserID             int
+	Username           string
+	Email              string
+	Frequency          string
+	SentAt             time.Time // when the last digest was sent, or the user subscribed
+	LastNotificationID int       // the latest notification already sent
+}
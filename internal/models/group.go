@@ -0,0 +1,28 @@
+package models
+
+// Group is a named set of users that can be granted access to categories.
+type Group struct {
+	GroupID     int
+	Name        string
+	Description string
+	Members     []string
+}
+
+// CategoryGrant is what the members of a group may do in a category.
+type CategoryGrant struct {
+	CategoryID  int
+	GroupID     int
+	GroupName   string
+	CanView     bool
+	CanPost     bool
+	CanComment  bool
+	CanModerate bool
+}
+
+// Access is what a user may do with a category or a post.
+type Access struct {
+	View     bool
+	Post     bool
+	Comment  bool
+	Moderate bool
+}
@@ -1,8 +1,15 @@
 package models
 
 type LikeRequest struct {
-	UserID    int    `json:"user_id"`
+	UserID    int    `json:"user_id,omitempty"`
 	PostID    *int   `json:"post_id,omitempty"`
 	CommentID *int   `json:"comment_id,omitempty"`
 	LikeType  string `json:"like_type"`
 }
+
+// BookmarkRequest saves or unsaves a post. Without Folder it toggles whether the
+// post is saved; with one it saves the post into that folder.
+type BookmarkRequest struct {
+	PostID int     `json:"post_id"`
+	Folder *string `json:"folder,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// MaxConversationMembers is the largest conversation, its creator included.
+const MaxConversationMembers = 10
+
+// Conversation is a private conversation as one of its members sees it.
+type Conversation struct {
+	ConversationID int
+	Title          string
+	Members        []string // the other members, by username
+	LastMessage    string
+	LastSender     string
+	Updated        time.Time
+	LatestActivity string
+	Unread         int
+	Muted          bool
+}
+
+// Message is a message in a private conversation.
+type Message struct {
+	MessageID      int
+	ConversationID int
+	UserID         int
+	Username       string
+	Content        string
+	Created        time.Time
+	CreatedAt      string
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Notification types.
+const (
+	NotifyComment = "comment" // a comment on the user's post
+	NotifyReply   = "reply"   // a comment on a post the user commented on
+	NotifyLike    = "like"    // a like of the user's post or comment
+	NotifyMention = "mention" // an @mention of the user
+	NotifyLockout = "lockout" // the user's account was locked after failed logins
+)
+
+// Notification is a group of notifications of the same type about the same post
+// or comment, such as all the likes of a post.
+type Notification struct {
+	NotificationID int // the latest in the group
+	Type           string
+	PostID         int
+	CommentID      int
+	PostTitle      string
+	Actors         []string // some of the users who acted
+	ActorCount     int      // how many users acted
+	Unread         bool
+	Created        time.Time
+	CreatedAt      string
+}
+
+// Summary describes what happened, to be followed by the post title.
+func (n Notification) Summary() string {
+	actors := n.actorNames()
+	switch n.Type {
+	case NotifyComment:
+		return actors + " commented on your post"
+	case NotifyReply:
+		return actors + " also commented on"
+	case NotifyLike:
+		if n.CommentID != 0 {
+			return actors + " liked your comment on"
+		}
+		return actors + " liked your post"
+	case NotifyMention:
+		return actors + " mentioned you in"
+	case NotifyLockout:
+		return "Your account was locked for a while after too many failed logins. If that was not you, consider changing your password."
+	}
+	return actors + " acted on"
+}
+
+// Link is where the notification leads, empty for those not about a post.
+func (n Notification) Link() string {
+	if n.PostID == 0 {
+		return ""
+	}
+	return PostLink(n.PostID)
+}
+
+func (n Notification) actorNames() string {
+	switch {
+	case n.ActorCount == 1 && len(n.Actors) == 1:
+		return n.Actors[0]
+	case n.ActorCount == 2 && len(n.Actors) == 2:
+		return n.Actors[0] + " and " + n.Actors[1]
+	}
+	return fmt.Sprintf("%d people", n.ActorCount)
+}
@@ -1,19 +1,35 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type Post struct {
-	PostID       int
-	UserID       int
-	Title        string
-	Content      string
-	Username     string
-	Categories   []string
-	CreatedAt    string
-	UpdatedAt    time.Time
-	Comments     []Comment
-	LikeCount    int
-	DislikeCount int
-	CommentCount int
-	Imgurl string
+	PostID       int       `json:"post_id"`
+	UserID       int       `json:"user_id"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	Username     string    `json:"username"`
+	Categories   []string  `json:"categories"`
+	CreatedAt    string    `json:"created_ago"` // humanized, as shown on the pages
+	Created      time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Comments     []Comment `json:"comments,omitempty"`
+	LikeCount    int       `json:"like_count"`
+	DislikeCount int       `json:"dislike_count"`
+	CommentCount int       `json:"comment_count"`
+	Imgurl       string    `json:"image_url,omitempty"`
+	Pinned       bool      `json:"pinned"`
+	Locked       bool      `json:"locked"`
+	CanModerate  bool      `json:"can_moderate"`     // the viewer moderates one of the post's categories
+	Saved        bool      `json:"saved"`            // the viewer bookmarked the post
+	Folder       string    `json:"folder,omitempty"` // the viewer's bookmark folder for the post
+	NewComments  int       `json:"new_comments"`     // comments by others since the viewer last read the post
+	FirstUnread  int       `json:"first_unread_comment_id,omitempty"`
+}
+
+// PostLink is where a post is shown.
+func PostLink(postID int) string {
+	return fmt.Sprintf("/post/%d", postID)
 }
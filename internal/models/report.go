@@ -0,0 +1,32 @@
+package models
+
+// ReportReasons maps the reason codes a report can be filed with to their labels.
+var ReportReasons = map[string]string{
+	"spam":           "Spam or advertising",
+	"harassment":     "Harassment or bullying",
+	"hate":           "Hate speech",
+	"misinformation": "Misinformation",
+	"off_topic":      "Off topic",
+	"other":          "Something else",
+}
+
+type Report struct {
+	ReportID      int
+	ReporterName  string
+	PostID        int
+	CommentID     int
+	Reason        string
+	Details       string
+	CreatedAt     string
+	Title         string
+	Content       string
+	ContentAuthor string
+}
+
+// ReasonLabel returns the human readable reason of the report.
+func (r Report) ReasonLabel() string {
+	if label, ok := ReportReasons[r.Reason]; ok {
+		return label
+	}
+	return r.Reason
+}
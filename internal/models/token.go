@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Token scopes. Read tokens may only make GET requests.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIToken is a personal token for the JSON API. The token itself is only known
+// when it is created; Prefix is its start.
+type APIToken struct {
+	TokenID    int
+	UserID     int
+	Name       string
+	Prefix     string
+	Scope      string
+	ExpiresAt  *time.Time // nil for tokens that never expire
+	LastUsedAt *time.Time // nil until first used
+	CreatedAt  time.Time
+}
+
+// Expired reports whether the token can no longer be used.
+func (t APIToken) Expired() bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type User struct {
+	UserID         int       `json:"user_id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	Bio            string    `json:"bio"`
+	ProfilePicture string    `json:"profile_picture"` // empty for the default avatar
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps token buckets in memory. It is only suitable for a single
+// server instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	idle    time.Duration
+	now     func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore. Buckets untouched for longer than
+// idle are dropped by Cleanup.
+func NewMemoryStore(idle time.Duration) *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		idle:    idle,
+		now:     time.Now,
+	}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.refill(now, limit)
+
+	if b.tokens < 1 {
+		return false, b.retryAfter(limit), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// Cleanup drops idle buckets so the map does not grow without bound.
+func (s *MemoryStore) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-s.idle)
+	for key, b := range s.buckets {
+		if b.updated.Before(cutoff) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
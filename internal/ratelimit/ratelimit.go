@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forum/internal/auth"
+	"forum/internal/utils"
+)
+
+// Limit describes a token bucket: Burst requests may be made at once, after which
+// tokens are refilled at Rate per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a Limit allowing n requests per minute with the given burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Store takes tokens from buckets identified by key. MemoryStore keeps buckets in
+// process; a backend shared between instances only has to implement this interface.
+type Store interface {
+	// Take removes a token from the bucket for key. When the bucket is empty it
+	// reports false along with how long until a token becomes available.
+	Take(key string, limit Limit) (bool, time.Duration, error)
+}
+
+// Middleware limits requests to route with limit. Requests are counted per user when
+// the session middleware has run before it, and per client IP otherwise.
+func Middleware(store Store, route string, limit Limit) func(http.Handler) http.Handler {
+	return MiddlewareWithError(store, route, limit, utils.DisplayError)
+}
+
+// MiddlewareWithError is Middleware answering limited requests with displayError
+// instead of the HTML error page, for routes such as the JSON API.
+func MiddlewareWithError(store Store, route string, limit Limit, displayError func(w http.ResponseWriter, code int, message string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter, err := store.Take(route+":"+clientKey(r), limit)
+			if err != nil {
+				// Fail open, a broken limiter should not take the forum down.
+				log.Printf("Rate limiter error on %s: %v", route, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				displayError(w, http.StatusTooManyRequests, "Too many requests, please slow down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies who a request is counted against.
+func clientKey(r *http.Request) string {
+	if userID, ok := auth.GetUserID(r); ok && userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + utils.ClientIP(r)
+}
+
+// bucket is the state of a single token bucket.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update.
+func (b *bucket) refill(now time.Time, limit Limit) {
+	b.tokens += now.Sub(b.updated).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.updated = now
+}
+
+// retryAfter returns how long until the bucket holds a whole token again.
+func (b *bucket) retryAfter(limit Limit) time.Duration {
+	if limit.Rate <= 0 {
+		return time.Hour
+	}
+	missing := 1 - b.tokens
+	return time.Duration(missing / limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"forum/internal/auth"
+)
+
+func TestMain(m *testing.M) {
+	// Change working directory to project root so error templates can be found
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take("k", limit); !ok {
+			t.Fatalf("expected request %d within burst to be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter, _ := store.Take("k", limit)
+	if ok {
+		t.Fatal("expected request over burst to be rejected")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("expected retry after within a second, got %v", retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if ok, _, _ := store.Take("other", limit); !ok {
+		t.Error("expected a different key to be allowed")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _, _ := store.Take("k", limit); !ok {
+		t.Error("expected a token to be refilled after a second")
+	}
+}
+
+func TestMemoryStoreCleanup(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Take("k", Limit{Rate: 1, Burst: 1})
+	now = now.Add(2 * time.Minute)
+	store.Cleanup()
+
+	if len(store.buckets) != 0 {
+		t.Errorf("expected idle bucket to be removed, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	handler := Middleware(store, "test", Limit{Rate: 0.01, Burst: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/comment/create", nil)
+		if userID != "" {
+			req = auth.SetUserID(req, userID)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rr.Code)
+	}
+
+	rr := send("1")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header to be set")
+	}
+
+	// Another user from the same IP is counted separately
+	if rr := send("2"); rr.Code != http.StatusOK {
+		t.Errorf("expected other user to pass, got %d", rr.Code)
+	}
+
+	// Anonymous requests are counted per IP
+	send("")
+	if rr := send(""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected anonymous request to be limited, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"forum/internal/models"
+)
+
+// DisplayBanned explains to a banned user why they cannot use the forum and until when.
+func DisplayBanned(w http.ResponseWriter, ban *models.Ban) {
+	tmpl, err := template.ParseFiles("web/templates/banned.html")
+	if err != nil {
+		log.Printf("Error loading template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	if err := tmpl.Execute(w, ban); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
@@ -7,8 +7,14 @@ import (
 	"forum/internal/models"
 )
 
-func FetchCategories() []models.Categories {
-	rows, err := db.DB.Query("SELECT category_id, name FROM categories")
+// FetchCategories returns the categories the user may see, each followed by its
+// subcategories. Archived categories are left out.
+func FetchCategories(userID int) []models.Categories {
+	rows, err := db.DB.Query(`
+		SELECT category_id, COALESCE(parent_id, 0), name, COALESCE(slug, ''), COALESCE(description, ''), sort_order
+		FROM categories
+		WHERE archived = 0 AND category_id IN (`+db.VisibleCategoryIDs+`)
+		ORDER BY sort_order, name`, db.VisibilityArgs(userID)...)
 	if err != nil {
 		log.Println("err executing query", err)
 
@@ -19,15 +25,12 @@ func FetchCategories() []models.Categories {
 	var categories []models.Categories
 
 	for rows.Next() {
-		var category struct {
-			CategoryID int
-			Name       string
-		}
-		if err := rows.Scan(&category.CategoryID, &category.Name); err != nil {
+		var category models.Categories
+		if err := rows.Scan(&category.CategoryID, &category.ParentID, &category.Name, &category.Slug, &category.Description, &category.SortOrder); err != nil {
 			log.Println("Error scanning categories", err)
 			return nil
 		}
 		categories = append(categories, category)
 	}
-	return categories
+	return models.SortTree(categories)
 }
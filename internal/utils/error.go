@@ -22,9 +22,8 @@ func DisplayError(w http.ResponseWriter, code int, message string) {
 		return
 	}
 
-
+	w.WriteHeader(code)
 	if err := tmpl.Execute(w, data); err != nil {
 		log.Printf("Error executing template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
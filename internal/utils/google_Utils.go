@@ -50,7 +50,7 @@ func FindOrCreateGoogleUser(googleUser *models.GoogleUser) (int, error) {
 	if err == nil {
 		// Update existing user with Goole info
 		_, err = db.DB.Exec(
-			"UPDATE users SET provider_id = ?, auth_type = 'google' WHERE user_id = ?",
+			"UPDATE users SET provider_id = ?, auth_type = 'google', email_verified = 1 WHERE user_id = ?",
 			googleUser.ID,
 			userID,
 		)
@@ -64,7 +64,7 @@ func FindOrCreateGoogleUser(googleUser *models.GoogleUser) (int, error) {
 	}
 
 	result, err := db.DB.Exec(
-		"INSERT INTO users (email, username, password, auth_type, provider_id) VALUES (?,?,?, 'google', ?)",
+		"INSERT INTO users (email, username, password, auth_type, provider_id, email_verified) VALUES (?,?,?, 'google', ?, 1)",
 		googleUser.Email,
 		username,
 		"oauth_placeholder",
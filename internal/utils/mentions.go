@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"html/template"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"forum/internal/db"
+)
+
+// maxMentions is how many users one post or comment can notify.
+const maxMentions = 10
+
+// mentionPattern matches @username where the @ does not follow a word character,
+// so that email addresses are not mentions. Usernames may contain dots and
+// dashes, but not end with them, so that "@bob." mentions bob.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([A-Za-z0-9_]+(?:[.-][A-Za-z0-9_]+)*)`)
+
+// usernamePattern matches the usernames mentionPattern can mention in full.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+(?:[.-][A-Za-z0-9_]+)*$`)
+
+// ValidUsername reports whether name can be chosen as a username: 3 to 30
+// letters, digits and underscores, with single dots or dashes between them, so
+// that it can be mentioned and used in profile links.
+func ValidUsername(name string) bool {
+	return len(name) >= 3 && len(name) <= 30 && usernamePattern.MatchString(name)
+}
+
+// Mentions returns the usernames mentioned in content, each once whatever its
+// case, in the order they first appear and at most maxMentions of them.
+func Mentions(content string) []string {
+	names := mentionedNames(content)
+	if len(names) > maxMentions {
+		names = names[:maxMentions]
+	}
+	return names
+}
+
+func mentionedNames(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if name := m[2]; !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// LinkMentions escapes content for HTML and links the mentions of existing users
+// to their profiles.
+func LinkMentions(content string) template.HTML {
+	escaped := template.HTMLEscapeString(content)
+	names := mentionedNames(content)
+	if len(names) == 0 {
+		return template.HTML(escaped)
+	}
+	existing, err := db.ExistingUsernames(names)
+	if err != nil {
+		log.Println(err)
+		return template.HTML(escaped)
+	}
+
+	linked := mentionPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+		at := strings.IndexByte(match, '@')
+		name := match[at+1:]
+		username, ok := existing[strings.ToLower(name)]
+		if !ok {
+			return match
+		}
+		return match[:at] + `<a class="mention" href="/u/` + url.PathEscape(username) + `">@` + name + `</a>`
+	})
+	return template.HTML(linked)
+}
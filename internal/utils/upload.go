@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// MaxImageSize is the largest image that can be uploaded.
+const MaxImageSize = 20 << 20
+
+// UploadDir is where uploaded images are stored, served under /static/images.
+var UploadDir = "web/static/images"
+
+var (
+	ErrImageTooLarge    = errors.New("images can be at most 20 MB")
+	ErrUnsupportedImage = errors.New("only JPEG, PNG, GIF and WebP images can be uploaded")
+)
+
+// imageTypes maps the content types accepted for uploads to their file extensions.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// SaveImage stores the image uploaded in the given form field under a random name
+// and returns the URL to show it at, or "" when no file was uploaded. The type is
+// detected from the content rather than trusted from the client. It returns
+// ErrImageTooLarge or ErrUnsupportedImage for files it refuses.
+func SaveImage(r *http.Request, field string) (string, error) {
+	file, header, err := r.FormFile(field)
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read upload: %v", err)
+	}
+	defer file.Close()
+
+	if header.Size > MaxImageSize {
+		return "", ErrImageTooLarge
+	}
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read upload: %v", err)
+	}
+	ext, ok := imageTypes[http.DetectContentType(sniff[:n])]
+	if !ok {
+		return "", ErrUnsupportedImage
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read upload: %v", err)
+	}
+
+	name := uuid.New().String() + ext
+	dst, err := os.Create(filepath.Join(UploadDir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to store upload: %v", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, file); err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to store upload: %v", err)
+	}
+	return "/static/images/" + name, nil
+}
+
+// IsUploadError reports whether err is a refused upload, to be shown to the user,
+// rather than a failure to store it.
+func IsUploadError(err error) bool {
+	return err == ErrImageTooLarge || err == ErrUnsupportedImage
+}
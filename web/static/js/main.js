@@ -107,6 +107,63 @@ function updateReactionUI(postId, commentId, likes, dislikes, userReaction) {
   }
 }
 
+// Save a post for later, or unsave it when it was saved
+async function bookmarkPost(userId, postId) {
+  if (userId == 0) {
+    window.location.href = "/login";
+    return;
+  }
+
+  try {
+    const response = await fetch("/bookmark", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ post_id: postId }),
+    });
+
+    const result = await response.json();
+
+    if (response.ok) {
+      updateBookmarkUI(postId, result.saved, result.folder);
+    }
+  } catch (error) {
+    console.error("Error:", error);
+  }
+}
+
+// Move a saved post into a folder; an empty name is the default folder
+async function moveBookmark(postId, folder) {
+  try {
+    const response = await fetch("/bookmark", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ post_id: postId, folder: folder }),
+    });
+
+    const result = await response.json();
+
+    if (response.ok) {
+      updateBookmarkUI(postId, result.saved, result.folder);
+    }
+  } catch (error) {
+    console.error("Error:", error);
+  }
+}
+
+function updateBookmarkUI(postId, saved, folder) {
+  const button = document.querySelector(`#bookmark-post-${postId}`);
+  const label = document.querySelector(`#bookmark-label-${postId}`);
+  const input = document.querySelector(`#bookmark-folder-${postId}`);
+  if (!button || !label || !input) {
+    return;
+  }
+
+  button.classList.toggle("active", saved);
+  label.innerText = saved ? "Saved" : "Save";
+  input.hidden = !saved;
+  input.value = folder;
+}
+
 document.addEventListener("DOMContentLoaded", function () {
   document.querySelectorAll(".toggle-comments").forEach((button) => {
     button.addEventListener("click", function () {
@@ -124,3 +181,204 @@ function OpenComments(id) {
 }
 
 
+
+// Update the counts of a post or comment changed by someone else, leaving the
+// buttons of the current user as they are
+function setReactionCounts(postId, commentId, likes, dislikes) {
+  const likeCount = commentId
+    ? document.querySelector(`#comment-like-count-${commentId}`)
+    : document.querySelector(`#post-like-count-${postId}`);
+  const dislikeCount = commentId
+    ? document.querySelector(`#comment-dislike-count-${commentId}`)
+    : document.querySelector(`#post-dislike-count-${postId}`);
+  if (likeCount) likeCount.innerText = likes;
+  if (dislikeCount) dislikeCount.innerText = dislikes;
+}
+
+// Add a comment posted by someone else to its post
+function addLiveComment(comment) {
+  const container = document.getElementById(String(comment.post_id));
+  if (!container) {
+    return;
+  }
+
+  const div = document.createElement("div");
+  div.className = "comment";
+  const header = document.createElement("p");
+  const author = document.createElement("strong");
+  author.textContent = comment.username;
+  header.append(author, " just now");
+  const content = document.createElement("p");
+  content.textContent = comment.content;
+  div.append(header, content);
+  container.appendChild(div);
+
+  const count = document.getElementById(`post-comment-count-${comment.post_id}`);
+  if (count) count.innerText = Number(count.innerText) + 1;
+}
+
+// Show a moderator's pin or lock of a post, closing its comment form when locked
+function setPostState(post) {
+  const toggle = (id, hidden) => {
+    const element = document.getElementById(id);
+    if (element) element.hidden = hidden;
+  };
+  toggle(`pinned-badge-${post.post_id}`, !post.pinned);
+  toggle(`locked-badge-${post.post_id}`, !post.locked);
+  toggle(`locked-notice-${post.post_id}`, !post.locked);
+  toggle(`comment-form-${post.post_id}`, post.locked);
+}
+
+// Pages listing posts follow the event stream named by their #new-posts notice
+document.addEventListener("DOMContentLoaded", function () {
+  const notice = document.getElementById("new-posts");
+  if (!notice || !window.EventSource) {
+    return;
+  }
+
+  const source = new EventSource(notice.dataset.events);
+  source.addEventListener("reaction", (msg) => {
+    const event = JSON.parse(msg.data);
+    setReactionCounts(event.post_id, event.comment_id, event.data.likes, event.data.dislikes);
+  });
+  source.addEventListener("comment.created", (msg) => {
+    const event = JSON.parse(msg.data);
+    if (event.data) addLiveComment(event.data);
+  });
+  source.addEventListener("post.created", () => {
+    notice.hidden = false;
+  });
+  source.addEventListener("post.updated", (msg) => {
+    const event = JSON.parse(msg.data);
+    if (event.data) setPostState(event.data);
+  });
+  source.addEventListener("post.deleted", (msg) => {
+    const event = JSON.parse(msg.data);
+    document.getElementById(`post-${event.post_id}`)?.closest(".post")?.remove();
+  });
+  source.addEventListener("comment.deleted", (msg) => {
+    const event = JSON.parse(msg.data);
+    const comment = document.getElementById(`comment-${event.comment_id}`);
+    if (!comment) return;
+    comment.remove();
+    const count = document.getElementById(`post-comment-count-${event.post_id}`);
+    if (count) count.innerText = Math.max(Number(count.innerText) - 1, 0);
+  });
+});
+
+// Add a chat message to the room
+function addChatMessage(message) {
+  const messages = document.getElementById("chat-messages");
+  const p = document.createElement("p");
+  const author = document.createElement("strong");
+  author.textContent = message.username;
+  const time = document.createElement("small");
+  time.textContent = new Date(message.created_at).toLocaleTimeString();
+  p.append(time, " ", author, ": ", message.content);
+  messages.appendChild(p);
+  messages.scrollTop = messages.scrollHeight;
+}
+
+// Chat rooms talk to their WebSocket, reconnecting when it drops
+document.addEventListener("DOMContentLoaded", function () {
+  const chat = document.getElementById("chat");
+  if (!chat || !window.WebSocket) {
+    return;
+  }
+  const status = document.getElementById("chat-status");
+  const form = document.getElementById("chat-form");
+  let socket;
+
+  function connect() {
+    const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+    socket = new WebSocket(`${scheme}//${location.host}${chat.dataset.socket}`);
+    socket.onopen = () => {
+      status.textContent = "";
+    };
+    socket.onmessage = (msg) => {
+      const frame = JSON.parse(msg.data);
+      if (frame.type === "history") {
+        document.getElementById("chat-messages").replaceChildren();
+        (frame.messages || []).forEach(addChatMessage);
+      } else if (frame.type === "message") {
+        addChatMessage(frame.message);
+      } else if (frame.type === "presence") {
+        document.getElementById("chat-presence").textContent = (frame.users || []).join(", ");
+      } else if (frame.type === "error") {
+        status.textContent = frame.error;
+      }
+    };
+    socket.onclose = (event) => {
+      if (event.code === 1008) {
+        status.textContent = "You can no longer use this room.";
+        return;
+      }
+      status.textContent = "Disconnected, reconnecting...";
+      setTimeout(connect, 3000);
+    };
+  }
+
+  if (form) {
+    form.addEventListener("submit", (e) => {
+      e.preventDefault();
+      if (socket.readyState !== WebSocket.OPEN) {
+        return;
+      }
+      socket.send(JSON.stringify({ content: form.content.value }));
+      form.reset();
+    });
+  }
+  connect();
+});
+
+// Suggest usernames while an @mention is typed in textareas marked data-mentions
+document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll("textarea[data-mentions]").forEach((textarea) => {
+    const list = document.createElement("ul");
+    list.className = "mention-suggestions";
+    list.hidden = true;
+    textarea.after(list);
+    let timer;
+
+    // The partial @mention right before the caret, if any
+    const partial = () => textarea.value.slice(0, textarea.selectionStart).match(/(^|[^\w@])@([\w.-]+)$/);
+
+    textarea.addEventListener("input", () => {
+      clearTimeout(timer);
+      const match = partial();
+      if (!match) {
+        list.hidden = true;
+        return;
+      }
+      timer = setTimeout(async () => {
+        const res = await fetch(`/api/v1/users?prefix=${encodeURIComponent(match[2])}`);
+        if (!res.ok) {
+          list.hidden = true;
+          return;
+        }
+        const users = (await res.json()).data;
+        list.replaceChildren(
+          ...users.map((user) => {
+            const item = document.createElement("li");
+            item.textContent = user.username;
+            item.addEventListener("mousedown", (e) => {
+              e.preventDefault();
+              const current = partial();
+              if (!current) return;
+              const caret = textarea.selectionStart;
+              const start = caret - current[2].length;
+              textarea.value = textarea.value.slice(0, start) + user.username + " " + textarea.value.slice(caret);
+              textarea.selectionStart = textarea.selectionEnd = start + user.username.length + 1;
+              list.hidden = true;
+            });
+            return item;
+          })
+        );
+        list.hidden = users.length === 0;
+      }, 200);
+    });
+    textarea.addEventListener("blur", () => {
+      list.hidden = true;
+    });
+  });
+});